@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/operator"
+)
+
+// Renders the CRDs into the helm chart, the chart only installs them if the
+// operator does not apply them itself.
+func main() {
+	crd := operator.QuarksStatefulSetCRD()
+	crd.APIVersion = "apiextensions.k8s.io/v1"
+	crd.Kind = "CustomResourceDefinition"
+
+	// drop the empty creationTimestamp and status
+	data, err := json.Marshal(crd)
+	if err != nil {
+		panic(err)
+	}
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		panic(err)
+	}
+	delete(obj["metadata"].(map[string]interface{}), "creationTimestamp")
+	delete(obj, "status")
+
+	out, err := yaml.Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+
+	content := fmt.Sprintf("{{- if not .Values.applyCRD }}\n%s{{- end }}\n", out)
+	if err := ioutil.WriteFile(os.Args[1], []byte(content), 0644); err != nil {
+		panic(err)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/statefulset"
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/operator"
 	"code.cloudfoundry.org/quarks-statefulset/version"
 	"code.cloudfoundry.org/quarks-utils/pkg/cmd"
@@ -65,6 +66,7 @@ var rootCmd = &cobra.Command{
 		cfg.WebhookServerPort = servicePort
 		cfg.WebhookUseServiceRef = useServiceRef
 		cfg.MaxQuarksStatefulSetWorkers = viper.GetInt("max-quarks-statefulset-workers")
+		statefulset.PrometheusAddresses = viper.GetStringSlice("rollout-analysis-prometheus-addresses")
 
 		cmd.CtxTimeOut(cfg)
 
@@ -125,12 +127,14 @@ func init() {
 	pf.StringP("operator-webhook-service-host", "w", "", "Hostname/IP under which the webhook server can be reached from the cluster")
 	pf.StringP("operator-webhook-service-port", "p", "2999", "Port the webhook server listens on")
 	pf.BoolP("operator-webhook-use-service-reference", "x", false, "If true the webhook service is targeted using a service reference instead of a URL")
+	pf.StringSlice("rollout-analysis-prometheus-addresses", []string{}, "Addresses of the Prometheus compatible APIs, which rollout analysis gates may query")
 
 	for _, name := range []string{
 		"max-quarks-statefulset-workers",
 		"operator-webhook-service-host",
 		"operator-webhook-service-port",
 		"operator-webhook-use-service-reference",
+		"rollout-analysis-prometheus-addresses",
 	} {
 		viper.BindPFlag(name, pf.Lookup(name))
 	}
@@ -139,6 +143,7 @@ func init() {
 	argToEnv["operator-webhook-service-host"] = "QUARKS_STS_WEBHOOK_SERVICE_HOST"
 	argToEnv["operator-webhook-service-port"] = "QUARKS_STS_WEBHOOK_SERVICE_PORT"
 	argToEnv["operator-webhook-use-service-reference"] = "QUARKS_STS_WEBHOOK_USE_SERVICE_REFERENCE"
+	argToEnv["rollout-analysis-prometheus-addresses"] = "QUARKS_STS_PROMETHEUS_ADDRESSES"
 
 	// Add env variables to help
 	cmd.AddEnvToUsage(rootCmd, argToEnv)
@@ -19,6 +19,7 @@ require (
 	go.uber.org/zap v1.16.0
 	golang.org/x/tools v0.0.0-20200708183856-df98bc6d456c // indirect
 	gomodules.xyz/jsonpatch/v2 v2.1.0
+	google.golang.org/grpc v1.27.1
 	k8s.io/api v0.20.4
 	k8s.io/apiextensions-apiserver v0.20.1
 	k8s.io/apimachinery v0.20.4
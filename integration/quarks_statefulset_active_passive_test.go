@@ -65,6 +65,54 @@ var _ = Describe("QuarksStatefulSetActivePassive", func() {
 		})
 	})
 
+	When("an active pod is elected and all probes pass", func() {
+		sleepCMD := []string{"/bin/sh", "-c", "sleep 2"}
+		It("should label only the pod with the lowest ordinal", func() {
+			By("Creating a QuarksStatefulSet with an election")
+			qsts := env.QstsWithProbeMultiplePods(qStsName, sleepCMD)
+			qsts.Spec.ActivePassiveElection = &qstsv1a1.ActivePassiveElectionSpec{}
+			qSts, tearDown, err := env.CreateQuarksStatefulSet(env.Namespace, qsts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(qSts).NotTo(Equal(nil))
+			defer func(tdf machine.TearDownFunc) { Expect(tdf()).To(Succeed()) }(tearDown)
+
+			By("Waiting for all pods owned by the qsts to be ready")
+			err = env.WaitForPodReady(env.Namespace, podNameByIndex(qStsName, "2"))
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Waiting for pod with index 0 to become active")
+			err = env.WaitForPodLabelToExist(env.Namespace, podNameByIndex(qStsName, "0"), labelKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the other pods stay passive")
+			Consistently(func() (bool, error) {
+				for _, index := range []string{"1", "2"} {
+					p, err := env.GetPod(env.Namespace, podNameByIndex(qStsName, index))
+					if err != nil {
+						return false, err
+					}
+					if _, ok := p.Labels[labelKey]; ok {
+						return true, nil
+					}
+				}
+				return false, nil
+			}, 10*time.Second, time.Second).Should(BeFalse())
+
+			p, err := env.GetPod(env.Namespace, podNameByIndex(qStsName, "0"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationActiveTerm, "1"))
+
+			By("Checking the active pod in the status")
+			Eventually(func() ([]string, error) {
+				q, err := env.GetQuarksStatefulSet(env.Namespace, qStsName)
+				if err != nil {
+					return nil, err
+				}
+				return q.Status.ActivePods, nil
+			}, 30*time.Second, time.Second).Should(ConsistOf(podNameByIndex(qStsName, "0")))
+		})
+	})
+
 	When("pod-active label is present in one pod and probe fails", func() {
 
 		cmdSleepTypo := []string{"/bin/sh", "-c", "sleeps 2"}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	. "github.com/onsi/ginkgo"
@@ -117,6 +118,37 @@ var _ = Describe("QuarksStatefulSet", func() {
 			})
 		})
 
+		When("changing the spec without changing the statefulSet", func() {
+			BeforeEach(func() {
+				qSts = &quarksStatefulSet
+			})
+
+			It("stops progressing once the generation is observed", func() {
+				err = env.WaitForPods(env.Namespace, "testpod=yes")
+				Expect(err).NotTo(HaveOccurred())
+
+				qSts, err = env.GetQuarksStatefulSet(env.Namespace, qSts.GetName())
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Updating the QuarksStatefulSet")
+				qSts.Spec.ZoneFailover = &qstsv1a1.ZoneFailoverSpec{}
+				qStsUpdated, tearDown, err := env.UpdateQuarksStatefulSet(env.Namespace, *qSts)
+				Expect(err).NotTo(HaveOccurred())
+				tearDowns = append(tearDowns, tearDown)
+
+				By("Checking the progressing condition")
+				err = wait.PollImmediate(5*time.Second, 60*time.Second, func() (bool, error) {
+					qSts, err := env.GetQuarksStatefulSet(env.Namespace, qStsUpdated.GetName())
+					if err != nil {
+						return false, err
+					}
+					return qSts.Status.ObservedGeneration == qStsUpdated.Generation &&
+						meta.IsStatusConditionFalse(qSts.Status.Conditions, qstsv1a1.ConditionProgressing), nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
 		When("updating a non-running statefulest", func() {
 			BeforeEach(func() {
 				qSts = &wrongQuarksStatefulSet
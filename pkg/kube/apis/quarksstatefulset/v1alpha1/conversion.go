@@ -0,0 +1,5 @@
+package v1alpha1
+
+// Hub marks v1alpha1 as the conversion hub. It is the storage version of
+// QuarksStatefulSet, all other versions are converted from and to it.
+func (*QuarksStatefulSet) Hub() {}
@@ -3,13 +3,14 @@ package v1alpha1
 import (
 	"fmt"
 
-	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis"
-	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/openapi"
 )
 
 // This file looks almost the same for all controllers
@@ -32,63 +33,11 @@ var (
 	// QuarksStatefulSetResourceShortNames is the short names of QuarksStatefulSet
 	QuarksStatefulSetResourceShortNames = []string{"qsts"}
 
-	// QuarksStatefulSetValidation is the validation method for QuarksStatefulSet
+	// QuarksStatefulSetValidation is the validation method for QuarksStatefulSet.
+	// The schema is generated from the Go types, including the embedded
+	// StatefulSet and probes, so invalid manifests are rejected on apply.
 	QuarksStatefulSetValidation = extv1.CustomResourceValidation{
-		OpenAPIV3Schema: &extv1.JSONSchemaProps{
-			Type: "object",
-			Properties: map[string]extv1.JSONSchemaProps{
-				"spec": {
-					Type: "object",
-					Properties: map[string]extv1.JSONSchemaProps{
-						"template": {
-							Type:                   "object",
-							Description:            "A template for a regular StatefulSet",
-							XPreserveUnknownFields: pointers.Bool(true),
-						},
-						"updateOnConfigChange": {
-							Type:        "boolean",
-							Description: "Indicate whether to update Pods in the StatefulSet when an env value or mount changes",
-						},
-						"activePassiveProbes": {
-							Type:                   "object",
-							Description:            "Defines probes to determine active/passive component instances",
-							XPreserveUnknownFields: pointers.Bool(true),
-						},
-						"injectReplicasEnv": {
-							Type:        "boolean",
-							Description: "Determines if the REPLICAS env var is injected into pod containers.",
-						},
-						"zoneNodeLabel": {
-							Type:        "string",
-							Description: "Indicates the node label that a node locates",
-						},
-						"zones": {
-							Type:        "array",
-							Description: "Indicates the availability zones that the QuarksStatefulSet needs to span",
-							Items: &extv1.JSONSchemaPropsOrArray{
-								Schema: &extv1.JSONSchemaProps{
-									Type: "string",
-								},
-							},
-						},
-					},
-					Required: []string{
-						"template",
-					},
-				},
-				"status": {
-					Type: "object",
-					Properties: map[string]extv1.JSONSchemaProps{
-						"lastReconcile": {
-							Type: "string",
-						},
-						"ready": {
-							Type: "boolean",
-						},
-					},
-				},
-			},
-		},
+		OpenAPIV3Schema: quarksStatefulSetSchema(),
 	}
 
 	// QuarksStatefulSetAdditionalPrinterColumns are used by `kubectl get`
@@ -128,3 +77,71 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
 }
+
+// quarksStatefulSetSchema generates the OpenAPI schema from the Go types and
+// marks the fields the API server has to require
+func quarksStatefulSetSchema() *extv1.JSONSchemaProps {
+	schema := openapi.CustomResourceSchema(QuarksStatefulSet{})
+
+	spec := schema.Properties["spec"]
+	spec.Required = []string{"template"}
+	spec.Properties["zoneReplicas"].Properties["zones"].Items.Schema.Required = []string{"name"}
+	zoneRemoval := spec.Properties["zoneRemoval"]
+	policy := zoneRemoval.Properties["persistentVolumeClaimPolicy"]
+	policy.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + PersistentVolumeClaimRetain + `"`)},
+		{Raw: []byte(`"` + PersistentVolumeClaimDelete + `"`)},
+	}
+	zoneRemoval.Properties["persistentVolumeClaimPolicy"] = policy
+	spec.Properties["zoneRemoval"] = zoneRemoval
+	zonePlacement := spec.Properties["zonePlacement"]
+	mode := zonePlacement.Properties["mode"]
+	mode.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + ZonePlacementRequiredAffinity + `"`)},
+		{Raw: []byte(`"` + ZonePlacementPreferredAffinity + `"`)},
+		{Raw: []byte(`"` + ZonePlacementTopologySpread + `"`)},
+	}
+	zonePlacement.Properties["mode"] = mode
+	whenUnsatisfiable := zonePlacement.Properties["whenUnsatisfiable"]
+	whenUnsatisfiable.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + corev1.DoNotSchedule + `"`)},
+		{Raw: []byte(`"` + corev1.ScheduleAnyway + `"`)},
+	}
+	zonePlacement.Properties["whenUnsatisfiable"] = whenUnsatisfiable
+	spec.Properties["zonePlacement"] = zonePlacement
+	election := spec.Properties["activePassiveElection"]
+	scope := election.Properties["scope"]
+	scope.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + ActivePassiveElectionGlobal + `"`)},
+		{Raw: []byte(`"` + ActivePassiveElectionPerZone + `"`)},
+		{Raw: []byte(`"` + ActivePassiveElectionPerStatefulSet + `"`)},
+	}
+	election.Properties["scope"] = scope
+	spec.Properties["activePassiveElection"] = election
+	probePolicy := spec.Properties["activePassiveProbePolicy"]
+	probePolicy.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + ActivePassiveProbeAll + `"`)},
+		{Raw: []byte(`"` + ActivePassiveProbeAny + `"`)},
+	}
+	spec.Properties["activePassiveProbePolicy"] = probePolicy
+	spec.Properties["activePassiveGRPCProbes"].AdditionalProperties.Schema.Required = []string{"port"}
+	activeService := spec.Properties["activeService"]
+	activeService.Required = []string{"ports"}
+	serviceType := activeService.Properties["type"]
+	serviceType.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + corev1.ServiceTypeClusterIP + `"`)},
+		{Raw: []byte(`"` + corev1.ServiceTypeNodePort + `"`)},
+		{Raw: []byte(`"` + corev1.ServiceTypeLoadBalancer + `"`)},
+	}
+	activeService.Properties["type"] = serviceType
+	spec.Properties["activeService"] = activeService
+	hooks := spec.Properties["activePassiveHooks"]
+	hooks.Required = []string{"container"}
+	spec.Properties["activePassiveHooks"] = hooks
+	schema.Properties["spec"] = spec
+
+	status := schema.Properties["status"]
+	status.Properties["conditions"].Items.Schema.Required = []string{"type", "status"}
+
+	return schema
+}
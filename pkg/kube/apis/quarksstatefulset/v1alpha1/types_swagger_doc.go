@@ -0,0 +1,220 @@
+package v1alpha1
+
+// The SwaggerDoc methods provide the descriptions in the OpenAPI schema of
+// the CRD. Keep them in sync with the comments in types.go.
+
+// SwaggerDoc describes QuarksStatefulSet
+func (QuarksStatefulSet) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":       "QuarksStatefulSet manages a StatefulSet per availability zone",
+		"spec":   "The desired state of the QuarksStatefulSet",
+		"status": "The observed state of the QuarksStatefulSet",
+	}
+}
+
+// SwaggerDoc describes QuarksStatefulSetSpec
+func (QuarksStatefulSetSpec) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":                         "The desired state of the QuarksStatefulSet",
+		"updateOnConfigChange":     "Indicate whether to update Pods in the StatefulSet when an env value or mount changes",
+		"zoneNodeLabel":            "Indicates the node label that a node locates",
+		"zones":                    "Indicates the availability zones that the QuarksStatefulSet needs to span",
+		"template":                 "A template for a regular StatefulSet",
+		"activePassiveProbes":      "Defines probes to determine active/passive component instances",
+		"injectReplicasEnv":        "Determines if the REPLICAS env var is injected into pod containers.",
+		"zoneReplicas":             "Configures the replicas of the StatefulSet of each zone, by default every zone runs the template replicas",
+		"zoneRemoval":              "Configures the clean up of the StatefulSets of removed zones, zones can only be removed from the end",
+		"zonePlacement":            "Configures how the pods of a zone are placed on the nodes of their zone, by default a required node affinity pins them to the zone",
+		"zoneFailover":             "Moves the replicas of a zone to the other zones, while none of the nodes of the zone are ready. Disabled, unless set",
+		"activePassiveElection":    "Elects a single active pod, instead of marking every pod, which passes the active/passive probe, as active",
+		"activePassiveGRPCProbes":  "Checks the gRPC health service instead of running the handler of the active/passive probe of the same container",
+		"activePassiveProbePolicy": "Either All, if the active/passive probes of all containers have to pass, or Any. Defaults to All",
+		"activeService":            "Creates a Service, which selects the active pod. Requires active/passive probes",
+		"activePassiveHooks":       "Runs hooks in a pod, before the active label is added or removed. Requires active/passive probes",
+	}
+}
+
+// SwaggerDoc describes ZonePlacementSpec
+func (ZonePlacementSpec) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":                  "Configures how the pods of a zone are placed on the nodes of their zone",
+		"mode":              "One of RequiredAffinity, PreferredAffinity or TopologySpread. Defaults to RequiredAffinity",
+		"whenUnsatisfiable": "Configures the topology spread constraint, either DoNotSchedule or ScheduleAnyway. Defaults to DoNotSchedule",
+	}
+}
+
+// SwaggerDoc describes ActivePassiveElectionSpec
+func (ActivePassiveElectionSpec) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":              "Configures the election of a single active pod. The active pod holds a lease, another pod is only elected once the lease expired",
+		"scope":         "Either Global, PerZone or PerStatefulSet. Defaults to Global",
+		"failoverDelay": "The time the active pod may fail its probe, before another pod is elected. Defaults to 0",
+	}
+}
+
+// SwaggerDoc describes ActivePassiveHooks
+func (ActivePassiveHooks) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":               "Hooks, which run in a pod before its active label is added or removed",
+		"container":      "The container exec hooks run in, named ports of the other hooks are looked up in this container",
+		"prePromotion":   "Runs in a pod, before it's labeled as active",
+		"preDemotion":    "Runs in a ready pod, before the active label is removed. With an election, a pod whose hook keeps failing is demoted anyway, once the failover delay, but at least the timeout, passed.",
+		"timeoutSeconds": "The time after which a hook fails. Defaults to 10",
+	}
+}
+
+// SwaggerDoc describes ActiveServiceSpec
+func (ActiveServiceSpec) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":            "Configures a Service, which selects the active pod of the QuarksStatefulSet",
+		"type":        "Either ClusterIP, NodePort or LoadBalancer. Defaults to ClusterIP",
+		"ports":       "Ports exposed by the Service",
+		"annotations": "Annotations of the Service",
+	}
+}
+
+// SwaggerDoc describes GRPCAction
+func (GRPCAction) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":        "Checks the standard gRPC health service of a container",
+		"port":    "Port of the gRPC service",
+		"service": "The service sent in the health check request. Defaults to empty, which checks the health of the server",
+	}
+}
+
+// SwaggerDoc describes ZoneFailoverSpec
+func (ZoneFailoverSpec) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":      "Configures the failover of zones, whose nodes are all not ready",
+		"delay": "The time all nodes of a zone have to be not ready, before the replicas of the zone are moved to the other zones. Defaults to 0",
+	}
+}
+
+// SwaggerDoc describes ZoneRemovalSpec
+func (ZoneRemovalSpec) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":                            "Configures the clean up of the StatefulSets of zones, which were removed from spec.zones",
+		"drain":                       "Scale the StatefulSet down and wait for its pods to terminate, before deleting it. Defaults to true",
+		"persistentVolumeClaimPolicy": "Whether the persistent volume claims of the StatefulSet are retained or deleted, either Retain or Delete. Defaults to Retain",
+	}
+}
+
+// SwaggerDoc describes ZoneReplicasSpec
+func (ZoneReplicasSpec) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":           "Configures the replicas of the StatefulSet of each zone",
+		"distribute": "Distribute the replicas of the template across the zones by weight, instead of running them in every zone",
+		"zones":      "Overrides the replicas or sets the weight of single zones",
+	}
+}
+
+// SwaggerDoc describes ZoneReplicas
+func (ZoneReplicas) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":         "Configures the replicas of a single zone",
+		"name":     "Name of the availability zone, one of spec.zones",
+		"replicas": "Replicas of the zone, overriding the template replicas or the share of the distributed replicas",
+		"weight":   "Weight of the zone when distributing replicas, defaults to 1",
+	}
+}
+
+// SwaggerDoc describes RolloutStep
+func (RolloutStep) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":          "A step of the canary rollout after the canary",
+		"replicas":  "The number or percentage of updated pods after the step, e.g. 25%",
+		"waitTime":  "How long the pods of the previous step have to be ready, before the step starts, e.g. 10m",
+		"watchTime": "The max time for the pods of the step to become ready, e.g. 5m",
+	}
+}
+
+// SwaggerDoc describes AnalysisGate
+func (AnalysisGate) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":             "A check of the freshly updated pod, which has to succeed before the partition of the rollout moves on",
+		"name":         "Name of the gate",
+		"exec":         "Runs a command in a container of the pod",
+		"http":         "Sends a GET request to the pod",
+		"prometheus":   "Runs an instant query against a Prometheus-compatible API",
+		"interval":     "The time between two attempts, defaults to 10s",
+		"timeout":      "The timeout of an attempt, defaults to 5s",
+		"failureLimit": "The number of failed attempts, after which the rollout fails, defaults to 3",
+	}
+}
+
+// SwaggerDoc describes ExecAnalysis
+func (ExecAnalysis) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":               "Succeeds if the command exits with 0 and its output contains the expected output",
+		"container":      "The container to run the command in, defaults to the first container",
+		"command":        "The command to run",
+		"expectedOutput": "Has to be part of the output of the command",
+	}
+}
+
+// SwaggerDoc describes HTTPAnalysis
+func (HTTPAnalysis) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":               "Succeeds if the response has one of the expected status codes and its body contains the expected body",
+		"path":           "The path of the request",
+		"port":           "The port of the container, a number or a name",
+		"scheme":         "Either HTTP or HTTPS, defaults to HTTP",
+		"expectedStatus": "The expected status codes, defaults to 200 to 399",
+		"expectedBody":   "Has to be part of the body of the response",
+	}
+}
+
+// SwaggerDoc describes PrometheusAnalysis
+func (PrometheusAnalysis) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":                 "Succeeds if the result of the query meets the success condition",
+		"address":          "The address of the API, e.g. http://prometheus.monitoring:9090. It has to be one of the addresses the operator allows",
+		"query":            "An instant query, {{pod}} and {{namespace}} are replaced with the name and namespace of the pod",
+		"successCondition": "Compares the first value of the result with a number, e.g. \"< 0.05\". The operators are <, <=, >, >=, == and !=",
+	}
+}
+
+// SwaggerDoc describes QuarksStatefulSetStatus
+func (QuarksStatefulSetStatus) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":                         "The observed state of the QuarksStatefulSet",
+		"lastReconcile":            "Timestamp for the last reconcile",
+		"ready":                    "Determines whether the QuarksStatefulSet is ready to serve",
+		"observedGeneration":       "The most recent generation applied to the StatefulSets",
+		"conditions":               "The latest available observations of the QuarksStatefulSet",
+		"zones":                    "The state of the StatefulSet of each availability zone",
+		"replicas":                 "The number of pods per zone, the scale subresource reports it as the current replicas",
+		"selector":                 "The label selector for the pods of all zones, used by the scale subresource",
+		"activePods":               "The names of the pods labeled as active",
+		"lastActiveTransitionTime": "The last time the active pods changed",
+		"probeHistory":             "The latest changes of the active/passive probe results, the newest last",
+	}
+}
+
+// SwaggerDoc describes ProbeResult
+func (ProbeResult) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":          "A change of the result of the active/passive probe of a container",
+		"time":      "Time of the change",
+		"pod":       "The name of the probed pod",
+		"container": "The name of the probed container",
+		"passing":   "True if the probe passes since then",
+		"message":   "The truncated error of a failing probe",
+	}
+}
+
+// SwaggerDoc describes ZoneStatus
+func (ZoneStatus) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":                "The observed state of the StatefulSet of one availability zone",
+		"name":            "Name of the availability zone",
+		"index":           "Index of the availability zone in spec.zones",
+		"statefulSetName": "The name of the StatefulSet for this zone",
+		"replicas":        "The number of desired replicas",
+		"readyReplicas":   "The number of pods with a Ready condition",
+		"updatedReplicas": "The number of pods running the latest revision",
+		"rolloutState":    "The state of the canary rollout",
+		"version":         "The QuarksStatefulSet version of the StatefulSet",
+		"failedOver":      "True while the replicas of the zone run in the other zones",
+	}
+}
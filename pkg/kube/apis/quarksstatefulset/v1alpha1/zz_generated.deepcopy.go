@@ -11,9 +11,230 @@ package v1alpha1
 
 import (
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActivePassiveElectionSpec) DeepCopyInto(out *ActivePassiveElectionSpec) {
+	*out = *in
+	if in.FailoverDelay != nil {
+		in, out := &in.FailoverDelay, &out.FailoverDelay
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActivePassiveElectionSpec.
+func (in *ActivePassiveElectionSpec) DeepCopy() *ActivePassiveElectionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ActivePassiveElectionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActivePassiveHooks) DeepCopyInto(out *ActivePassiveHooks) {
+	*out = *in
+	if in.PrePromotion != nil {
+		in, out := &in.PrePromotion, &out.PrePromotion
+		*out = new(v1.Handler)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PreDemotion != nil {
+		in, out := &in.PreDemotion, &out.PreDemotion
+		*out = new(v1.Handler)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActivePassiveHooks.
+func (in *ActivePassiveHooks) DeepCopy() *ActivePassiveHooks {
+	if in == nil {
+		return nil
+	}
+	out := new(ActivePassiveHooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActiveServiceSpec) DeepCopyInto(out *ActiveServiceSpec) {
+	*out = *in
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]v1.ServicePort, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActiveServiceSpec.
+func (in *ActiveServiceSpec) DeepCopy() *ActiveServiceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ActiveServiceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnalysisGate) DeepCopyInto(out *AnalysisGate) {
+	*out = *in
+	if in.Exec != nil {
+		in, out := &in.Exec, &out.Exec
+		*out = new(ExecAnalysis)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HTTP != nil {
+		in, out := &in.HTTP, &out.HTTP
+		*out = new(HTTPAnalysis)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(PrometheusAnalysis)
+		**out = **in
+	}
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.FailureLimit != nil {
+		in, out := &in.FailureLimit, &out.FailureLimit
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalysisGate.
+func (in *AnalysisGate) DeepCopy() *AnalysisGate {
+	if in == nil {
+		return nil
+	}
+	out := new(AnalysisGate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecAnalysis) DeepCopyInto(out *ExecAnalysis) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecAnalysis.
+func (in *ExecAnalysis) DeepCopy() *ExecAnalysis {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecAnalysis)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GRPCAction) DeepCopyInto(out *GRPCAction) {
+	*out = *in
+	if in.Service != nil {
+		in, out := &in.Service, &out.Service
+		*out = new(string)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GRPCAction.
+func (in *GRPCAction) DeepCopy() *GRPCAction {
+	if in == nil {
+		return nil
+	}
+	out := new(GRPCAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPAnalysis) DeepCopyInto(out *HTTPAnalysis) {
+	*out = *in
+	out.Port = in.Port
+	if in.ExpectedStatus != nil {
+		in, out := &in.ExpectedStatus, &out.ExpectedStatus
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPAnalysis.
+func (in *HTTPAnalysis) DeepCopy() *HTTPAnalysis {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPAnalysis)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProbeResult) DeepCopyInto(out *ProbeResult) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProbeResult.
+func (in *ProbeResult) DeepCopy() *ProbeResult {
+	if in == nil {
+		return nil
+	}
+	out := new(ProbeResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusAnalysis) DeepCopyInto(out *PrometheusAnalysis) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusAnalysis.
+func (in *PrometheusAnalysis) DeepCopy() *PrometheusAnalysis {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusAnalysis)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QuarksStatefulSet) DeepCopyInto(out *QuarksStatefulSet) {
 	*out = *in
@@ -96,6 +317,48 @@ func (in *QuarksStatefulSetSpec) DeepCopyInto(out *QuarksStatefulSetSpec) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.ZoneReplicas != nil {
+		in, out := &in.ZoneReplicas, &out.ZoneReplicas
+		*out = new(ZoneReplicasSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ZoneRemoval != nil {
+		in, out := &in.ZoneRemoval, &out.ZoneRemoval
+		*out = new(ZoneRemovalSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ZonePlacement != nil {
+		in, out := &in.ZonePlacement, &out.ZonePlacement
+		*out = new(ZonePlacementSpec)
+		**out = **in
+	}
+	if in.ZoneFailover != nil {
+		in, out := &in.ZoneFailover, &out.ZoneFailover
+		*out = new(ZoneFailoverSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ActivePassiveElection != nil {
+		in, out := &in.ActivePassiveElection, &out.ActivePassiveElection
+		*out = new(ActivePassiveElectionSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ActivePassiveGRPCProbes != nil {
+		in, out := &in.ActivePassiveGRPCProbes, &out.ActivePassiveGRPCProbes
+		*out = make(map[string]GRPCAction, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.ActiveService != nil {
+		in, out := &in.ActiveService, &out.ActiveService
+		*out = new(ActiveServiceSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ActivePassiveHooks != nil {
+		in, out := &in.ActivePassiveHooks, &out.ActivePassiveHooks
+		*out = new(ActivePassiveHooks)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -116,6 +379,34 @@ func (in *QuarksStatefulSetStatus) DeepCopyInto(out *QuarksStatefulSetStatus) {
 		in, out := &in.LastReconcile, &out.LastReconcile
 		*out = (*in).DeepCopy()
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]ZoneStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.ActivePods != nil {
+		in, out := &in.ActivePods, &out.ActivePods
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastActiveTransitionTime != nil {
+		in, out := &in.LastActiveTransitionTime, &out.LastActiveTransitionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ProbeHistory != nil {
+		in, out := &in.ProbeHistory, &out.ProbeHistory
+		*out = make([]ProbeResult, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -128,3 +419,153 @@ func (in *QuarksStatefulSetStatus) DeepCopy() *QuarksStatefulSetStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStep) DeepCopyInto(out *RolloutStep) {
+	*out = *in
+	out.Replicas = in.Replicas
+	if in.WaitTime != nil {
+		in, out := &in.WaitTime, &out.WaitTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.WatchTime != nil {
+		in, out := &in.WatchTime, &out.WatchTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStep.
+func (in *RolloutStep) DeepCopy() *RolloutStep {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZoneFailoverSpec) DeepCopyInto(out *ZoneFailoverSpec) {
+	*out = *in
+	if in.Delay != nil {
+		in, out := &in.Delay, &out.Delay
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZoneFailoverSpec.
+func (in *ZoneFailoverSpec) DeepCopy() *ZoneFailoverSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ZoneFailoverSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZonePlacementSpec) DeepCopyInto(out *ZonePlacementSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZonePlacementSpec.
+func (in *ZonePlacementSpec) DeepCopy() *ZonePlacementSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ZonePlacementSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZoneRemovalSpec) DeepCopyInto(out *ZoneRemovalSpec) {
+	*out = *in
+	if in.Drain != nil {
+		in, out := &in.Drain, &out.Drain
+		*out = new(bool)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZoneRemovalSpec.
+func (in *ZoneRemovalSpec) DeepCopy() *ZoneRemovalSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ZoneRemovalSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZoneReplicas) DeepCopyInto(out *ZoneReplicas) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZoneReplicas.
+func (in *ZoneReplicas) DeepCopy() *ZoneReplicas {
+	if in == nil {
+		return nil
+	}
+	out := new(ZoneReplicas)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZoneReplicasSpec) DeepCopyInto(out *ZoneReplicasSpec) {
+	*out = *in
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]ZoneReplicas, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZoneReplicasSpec.
+func (in *ZoneReplicasSpec) DeepCopy() *ZoneReplicasSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ZoneReplicasSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZoneStatus) DeepCopyInto(out *ZoneStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZoneStatus.
+func (in *ZoneStatus) DeepCopy() *ZoneStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ZoneStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,362 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+)
+
+var (
+	// v1alpha1 keeps the rollout settings as annotations in the StatefulSet template
+	annotationCanaryWatchTime  = fmt.Sprintf("%s/canary-watch-time-ms", apis.GroupName)
+	annotationUpdateWatchTime  = fmt.Sprintf("%s/update-watch-time-ms", apis.GroupName)
+	annotationCanarySize       = fmt.Sprintf("%s/canary-size", apis.GroupName)
+	annotationRolloutSteps     = fmt.Sprintf("%s/rollout-steps", apis.GroupName)
+	annotationPauseAfterCanary = fmt.Sprintf("%s/pause-after-canary", apis.GroupName)
+	annotationAutoRollback     = fmt.Sprintf("%s/auto-rollback", apis.GroupName)
+	annotationRolloutAnalysis  = fmt.Sprintf("%s/rollout-analysis", apis.GroupName)
+	annotationSequentialZones  = fmt.Sprintf("%s/sequential-zones", apis.GroupName)
+)
+
+// Check that QuarksStatefulSet implements the conversion.Convertible interface
+var _ conversion.Convertible = &QuarksStatefulSet{}
+
+// ConvertTo converts this QuarksStatefulSet to the hub version v1alpha1
+func (src *QuarksStatefulSet) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.QuarksStatefulSet)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	spec := src.Spec.DeepCopy()
+	dst.Spec = v1alpha1.QuarksStatefulSetSpec{
+		UpdateOnConfigChange: spec.UpdateOnConfigChange,
+		ZoneNodeLabel:        spec.ZoneNodeLabel,
+		Zones:                spec.Zones,
+		Template:             spec.Template,
+		InjectReplicasEnv:    spec.InjectReplicasEnv,
+	}
+
+	if spec.Rollout != nil {
+		annotations := dst.Spec.Template.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		if spec.Rollout.CanaryWatchTime != nil {
+			annotations[annotationCanaryWatchTime] = strconv.FormatInt(spec.Rollout.CanaryWatchTime.Milliseconds(), 10)
+		}
+		if spec.Rollout.UpdateWatchTime != nil {
+			annotations[annotationUpdateWatchTime] = strconv.FormatInt(spec.Rollout.UpdateWatchTime.Milliseconds(), 10)
+		}
+		if spec.Rollout.Canary != nil {
+			annotations[annotationCanarySize] = spec.Rollout.Canary.String()
+		}
+		if len(spec.Rollout.Steps) > 0 {
+			steps := make([]v1alpha1.RolloutStep, len(spec.Rollout.Steps))
+			for i, step := range spec.Rollout.Steps {
+				steps[i] = v1alpha1.RolloutStep(step)
+			}
+			raw, err := json.Marshal(steps)
+			if err != nil {
+				return errors.Wrap(err, "could not marshal rollout steps")
+			}
+			annotations[annotationRolloutSteps] = string(raw)
+		}
+		if spec.Rollout.PauseAfterCanary {
+			annotations[annotationPauseAfterCanary] = "true"
+		}
+		if spec.Rollout.AutoRollback {
+			annotations[annotationAutoRollback] = "true"
+		}
+		if len(spec.Rollout.Analysis) > 0 {
+			// The gates have the same JSON representation in both versions
+			raw, err := json.Marshal(spec.Rollout.Analysis)
+			if err != nil {
+				return errors.Wrap(err, "could not marshal rollout analysis")
+			}
+			annotations[annotationRolloutAnalysis] = string(raw)
+		}
+		if spec.Rollout.SequentialZones {
+			annotations[annotationSequentialZones] = "true"
+		}
+		dst.Spec.Template.SetAnnotations(annotations)
+	}
+
+	if spec.ZoneReplicas != nil {
+		dst.Spec.ZoneReplicas = &v1alpha1.ZoneReplicasSpec{Distribute: spec.ZoneReplicas.Distribute}
+		for _, zone := range spec.ZoneReplicas.Zones {
+			dst.Spec.ZoneReplicas.Zones = append(dst.Spec.ZoneReplicas.Zones, v1alpha1.ZoneReplicas(zone))
+		}
+	}
+
+	if spec.ZoneRemoval != nil {
+		dst.Spec.ZoneRemoval = &v1alpha1.ZoneRemovalSpec{
+			Drain:                       spec.ZoneRemoval.Drain,
+			PersistentVolumeClaimPolicy: v1alpha1.PersistentVolumeClaimPolicy(spec.ZoneRemoval.PersistentVolumeClaimPolicy),
+		}
+	}
+
+	if spec.ZonePlacement != nil {
+		dst.Spec.ZonePlacement = &v1alpha1.ZonePlacementSpec{
+			Mode:              v1alpha1.ZonePlacementMode(spec.ZonePlacement.Mode),
+			WhenUnsatisfiable: spec.ZonePlacement.WhenUnsatisfiable,
+		}
+	}
+
+	if spec.ZoneFailover != nil {
+		dst.Spec.ZoneFailover = &v1alpha1.ZoneFailoverSpec{Delay: spec.ZoneFailover.Delay}
+	}
+
+	if spec.ActivePassive != nil {
+		dst.Spec.ActivePassiveProbes = map[string]corev1.Probe{}
+		for _, p := range spec.ActivePassive.Probes {
+			dst.Spec.ActivePassiveProbes[p.Container] = p.Probe
+			if p.GRPC != nil {
+				if dst.Spec.ActivePassiveGRPCProbes == nil {
+					dst.Spec.ActivePassiveGRPCProbes = map[string]v1alpha1.GRPCAction{}
+				}
+				dst.Spec.ActivePassiveGRPCProbes[p.Container] = v1alpha1.GRPCAction{Port: p.GRPC.Port, Service: p.GRPC.Service}
+			}
+		}
+		dst.Spec.ActivePassiveProbePolicy = v1alpha1.ActivePassiveProbePolicy(spec.ActivePassive.Policy)
+		if election := spec.ActivePassive.Election; election != nil {
+			dst.Spec.ActivePassiveElection = &v1alpha1.ActivePassiveElectionSpec{
+				Scope:         v1alpha1.ActivePassiveElectionScope(election.Scope),
+				FailoverDelay: election.FailoverDelay,
+			}
+		}
+		if service := spec.ActivePassive.Service; service != nil {
+			activeService := v1alpha1.ActiveServiceSpec(*service)
+			dst.Spec.ActiveService = &activeService
+		}
+		if hooks := spec.ActivePassive.Hooks; hooks != nil {
+			activePassiveHooks := v1alpha1.ActivePassiveHooks(*hooks)
+			dst.Spec.ActivePassiveHooks = &activePassiveHooks
+		}
+	}
+
+	status := src.Status.DeepCopy()
+	dst.Status = v1alpha1.QuarksStatefulSetStatus{
+		LastReconcile:            status.LastReconcile,
+		Ready:                    status.Ready,
+		ObservedGeneration:       status.ObservedGeneration,
+		Conditions:               status.Conditions,
+		Replicas:                 status.Replicas,
+		Selector:                 status.Selector,
+		ActivePods:               status.ActivePods,
+		LastActiveTransitionTime: status.LastActiveTransitionTime,
+	}
+	for _, zone := range status.Zones {
+		dst.Status.Zones = append(dst.Status.Zones, v1alpha1.ZoneStatus(zone))
+	}
+	for _, result := range status.ProbeHistory {
+		dst.Status.ProbeHistory = append(dst.Status.ProbeHistory, v1alpha1.ProbeResult(result))
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version v1alpha1 to this version
+func (dst *QuarksStatefulSet) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.QuarksStatefulSet)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	spec := src.Spec.DeepCopy()
+	dst.Spec = QuarksStatefulSetSpec{
+		Template:             spec.Template,
+		UpdateOnConfigChange: spec.UpdateOnConfigChange,
+		InjectReplicasEnv:    spec.InjectReplicasEnv,
+		ZoneNodeLabel:        spec.ZoneNodeLabel,
+		Zones:                spec.Zones,
+	}
+
+	annotations := dst.Spec.Template.GetAnnotations()
+	canaryWatchTime, canaryOk := durationFromAnnotation(annotations, annotationCanaryWatchTime)
+	updateWatchTime, updateOk := durationFromAnnotation(annotations, annotationUpdateWatchTime)
+	canarySize, sizeOk := canarySizeFromAnnotation(annotations)
+	steps, stepsOk := rolloutStepsFromAnnotation(annotations)
+	analysis, analysisOk := rolloutAnalysisFromAnnotation(annotations)
+	pause := annotations[annotationPauseAfterCanary] == "true"
+	if pause {
+		delete(annotations, annotationPauseAfterCanary)
+	}
+	autoRollback := annotations[annotationAutoRollback] == "true"
+	if autoRollback {
+		delete(annotations, annotationAutoRollback)
+	}
+	sequentialZones := annotations[annotationSequentialZones] == "true"
+	if sequentialZones {
+		delete(annotations, annotationSequentialZones)
+	}
+	if canaryOk || updateOk || sizeOk || stepsOk || analysisOk || pause || autoRollback || sequentialZones {
+		dst.Spec.Rollout = &RolloutSpec{
+			CanaryWatchTime:  canaryWatchTime,
+			UpdateWatchTime:  updateWatchTime,
+			Canary:           canarySize,
+			Steps:            steps,
+			PauseAfterCanary: pause,
+			AutoRollback:     autoRollback,
+			Analysis:         analysis,
+			SequentialZones:  sequentialZones,
+		}
+		if len(annotations) == 0 {
+			dst.Spec.Template.SetAnnotations(nil)
+		}
+	}
+
+	if spec.ZoneReplicas != nil {
+		dst.Spec.ZoneReplicas = &ZoneReplicasSpec{Distribute: spec.ZoneReplicas.Distribute}
+		for _, zone := range spec.ZoneReplicas.Zones {
+			dst.Spec.ZoneReplicas.Zones = append(dst.Spec.ZoneReplicas.Zones, ZoneReplicas(zone))
+		}
+	}
+
+	if spec.ZoneRemoval != nil {
+		dst.Spec.ZoneRemoval = &ZoneRemovalSpec{
+			Drain:                       spec.ZoneRemoval.Drain,
+			PersistentVolumeClaimPolicy: PersistentVolumeClaimPolicy(spec.ZoneRemoval.PersistentVolumeClaimPolicy),
+		}
+	}
+
+	if spec.ZonePlacement != nil {
+		dst.Spec.ZonePlacement = &ZonePlacementSpec{
+			Mode:              ZonePlacementMode(spec.ZonePlacement.Mode),
+			WhenUnsatisfiable: spec.ZonePlacement.WhenUnsatisfiable,
+		}
+	}
+
+	if spec.ZoneFailover != nil {
+		dst.Spec.ZoneFailover = &ZoneFailoverSpec{Delay: spec.ZoneFailover.Delay}
+	}
+
+	if spec.ActivePassiveProbes != nil || spec.ActivePassiveElection != nil || spec.ActiveService != nil || spec.ActivePassiveHooks != nil {
+		dst.Spec.ActivePassive = &ActivePassiveSpec{
+			Policy: ActivePassiveProbePolicy(spec.ActivePassiveProbePolicy),
+		}
+		for container, probe := range spec.ActivePassiveProbes {
+			containerProbe := ContainerProbe{
+				Container: container,
+				Probe:     probe,
+			}
+			if grpc, ok := spec.ActivePassiveGRPCProbes[container]; ok {
+				containerProbe.GRPC = &GRPCAction{Port: grpc.Port, Service: grpc.Service}
+			}
+			dst.Spec.ActivePassive.Probes = append(dst.Spec.ActivePassive.Probes, containerProbe)
+		}
+		sort.Slice(dst.Spec.ActivePassive.Probes, func(i, j int) bool {
+			return dst.Spec.ActivePassive.Probes[i].Container < dst.Spec.ActivePassive.Probes[j].Container
+		})
+		if election := spec.ActivePassiveElection; election != nil {
+			dst.Spec.ActivePassive.Election = &ActivePassiveElectionSpec{
+				Scope:         ActivePassiveElectionScope(election.Scope),
+				FailoverDelay: election.FailoverDelay,
+			}
+		}
+		if service := spec.ActiveService; service != nil {
+			activeService := ActiveServiceSpec(*service)
+			dst.Spec.ActivePassive.Service = &activeService
+		}
+		if hooks := spec.ActivePassiveHooks; hooks != nil {
+			activePassiveHooks := ActivePassiveHooks(*hooks)
+			dst.Spec.ActivePassive.Hooks = &activePassiveHooks
+		}
+	}
+
+	status := src.Status.DeepCopy()
+	dst.Status = QuarksStatefulSetStatus{
+		LastReconcile:            status.LastReconcile,
+		Ready:                    status.Ready,
+		ObservedGeneration:       status.ObservedGeneration,
+		Conditions:               status.Conditions,
+		Replicas:                 status.Replicas,
+		Selector:                 status.Selector,
+		ActivePods:               status.ActivePods,
+		LastActiveTransitionTime: status.LastActiveTransitionTime,
+	}
+	for _, zone := range status.Zones {
+		dst.Status.Zones = append(dst.Status.Zones, ZoneStatus(zone))
+	}
+	for _, result := range status.ProbeHistory {
+		dst.Status.ProbeHistory = append(dst.Status.ProbeHistory, ProbeResult(result))
+	}
+
+	return nil
+}
+
+// durationFromAnnotation removes a watch time annotation in milliseconds
+// and returns it as a duration. Annotations which are not a number are kept,
+// so they survive a round trip.
+func durationFromAnnotation(annotations map[string]string, key string) (*metav1.Duration, bool) {
+	value, ok := annotations[key]
+	if !ok {
+		return nil, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	delete(annotations, key)
+	return &metav1.Duration{Duration: time.Duration(ms) * time.Millisecond}, true
+}
+
+// canarySizeFromAnnotation removes the canary size annotation and returns
+// it. Annotations which are neither a number nor a percentage are kept.
+func canarySizeFromAnnotation(annotations map[string]string) (*intstr.IntOrString, bool) {
+	value, ok := annotations[annotationCanarySize]
+	if !ok {
+		return nil, false
+	}
+	size := intstr.Parse(value)
+	if _, err := intstr.GetScaledValueFromIntOrPercent(&size, 100, true); err != nil {
+		return nil, false
+	}
+	delete(annotations, annotationCanarySize)
+	return &size, true
+}
+
+// rolloutStepsFromAnnotation removes the JSON list of rollout steps and
+// returns it. Annotations which can't be parsed are kept.
+func rolloutStepsFromAnnotation(annotations map[string]string) ([]RolloutStep, bool) {
+	value, ok := annotations[annotationRolloutSteps]
+	if !ok {
+		return nil, false
+	}
+	steps := []v1alpha1.RolloutStep{}
+	if err := json.Unmarshal([]byte(value), &steps); err != nil {
+		return nil, false
+	}
+	delete(annotations, annotationRolloutSteps)
+
+	var dst []RolloutStep
+	for _, step := range steps {
+		dst = append(dst, RolloutStep(step))
+	}
+	return dst, true
+}
+
+// rolloutAnalysisFromAnnotation removes the JSON list of analysis gates and
+// returns it. Annotations which can't be parsed are kept.
+func rolloutAnalysisFromAnnotation(annotations map[string]string) ([]AnalysisGate, bool) {
+	value, ok := annotations[annotationRolloutAnalysis]
+	if !ok {
+		return nil, false
+	}
+	gates := []AnalysisGate{}
+	if err := json.Unmarshal([]byte(value), &gates); err != nil {
+		return nil, false
+	}
+	delete(annotations, annotationRolloutAnalysis)
+	return gates, true
+}
@@ -0,0 +1,196 @@
+package v1beta1_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1beta1"
+	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
+)
+
+var _ = Describe("Conversion", func() {
+	var (
+		probe  corev1.Probe
+		canary intstr.IntOrString
+		qsts   *v1beta1.QuarksStatefulSet
+	)
+
+	BeforeEach(func() {
+		canary = intstr.FromInt(2)
+		probe = corev1.Probe{
+			Handler: corev1.Handler{
+				Exec: &corev1.ExecAction{Command: []string{"ls"}},
+			},
+			PeriodSeconds: 2,
+		}
+		qsts = &v1beta1.QuarksStatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "foo",
+				Namespace:  "default",
+				Generation: 2,
+			},
+			Spec: v1beta1.QuarksStatefulSetSpec{
+				Template: appsv1.StatefulSet{
+					ObjectMeta: metav1.ObjectMeta{
+						Annotations: map[string]string{"other": "annotation"},
+					},
+					Spec: appsv1.StatefulSetSpec{Replicas: pointers.Int32(2)},
+				},
+				UpdateOnConfigChange: true,
+				InjectReplicasEnv:    pointers.Bool(false),
+				ZoneNodeLabel:        "zone",
+				Zones:                []string{"z1", "z2"},
+				ZoneReplicas: &v1beta1.ZoneReplicasSpec{
+					Distribute: true,
+					Zones: []v1beta1.ZoneReplicas{
+						{Name: "z1", Weight: pointers.Int32(2)},
+						{Name: "z2", Replicas: pointers.Int32(1)},
+					},
+				},
+				ZoneRemoval: &v1beta1.ZoneRemovalSpec{
+					Drain:                       pointers.Bool(false),
+					PersistentVolumeClaimPolicy: v1beta1.PersistentVolumeClaimDelete,
+				},
+				ZonePlacement: &v1beta1.ZonePlacementSpec{
+					Mode:              v1beta1.ZonePlacementTopologySpread,
+					WhenUnsatisfiable: corev1.ScheduleAnyway,
+				},
+				ZoneFailover: &v1beta1.ZoneFailoverSpec{
+					Delay: &metav1.Duration{Duration: 2 * time.Minute},
+				},
+				Rollout: &v1beta1.RolloutSpec{
+					CanaryWatchTime: &metav1.Duration{Duration: 5 * time.Minute},
+					UpdateWatchTime: &metav1.Duration{Duration: 20 * time.Minute},
+					Canary:          &canary,
+					Steps: []v1beta1.RolloutStep{
+						{Replicas: intstr.FromString("25%"), WaitTime: &metav1.Duration{Duration: 10 * time.Minute}},
+						{Replicas: intstr.FromInt(4), WatchTime: &metav1.Duration{Duration: 5 * time.Minute}},
+					},
+					PauseAfterCanary: true,
+					AutoRollback:     true,
+					Analysis: []v1beta1.AnalysisGate{
+						{
+							Name:         "health",
+							HTTP:         &v1beta1.HTTPAnalysis{Path: "/health", Port: intstr.FromString("http"), ExpectedStatus: []int32{200}},
+							FailureLimit: pointers.Int32(5),
+						},
+						{
+							Name:     "errors",
+							Interval: &metav1.Duration{Duration: time.Minute},
+							Prometheus: &v1beta1.PrometheusAnalysis{
+								Address:          "http://prometheus:9090",
+								Query:            `rate(errors_total{pod="{{pod}}"}[1m])`,
+								SuccessCondition: "< 0.05",
+							},
+						},
+					},
+					SequentialZones: true,
+				},
+				ActivePassive: &v1beta1.ActivePassiveSpec{
+					Policy: v1beta1.ActivePassiveProbeAny,
+					Probes: []v1beta1.ContainerProbe{
+						{Container: "a", Probe: probe},
+						{Container: "b", Probe: corev1.Probe{PeriodSeconds: 2}, GRPC: &v1beta1.GRPCAction{Port: 9090}},
+					},
+					Election: &v1beta1.ActivePassiveElectionSpec{
+						Scope:         v1beta1.ActivePassiveElectionPerZone,
+						FailoverDelay: &metav1.Duration{Duration: 10 * time.Second},
+					},
+					Service: &v1beta1.ActiveServiceSpec{
+						Type:        corev1.ServiceTypeLoadBalancer,
+						Ports:       []corev1.ServicePort{{Name: "db", Port: 5432}},
+						Annotations: map[string]string{"example.com/internal": "true"},
+					},
+					Hooks: &v1beta1.ActivePassiveHooks{
+						Container:      "a",
+						PrePromotion:   &corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"promote"}}},
+						TimeoutSeconds: 20,
+					},
+				},
+			},
+			Status: v1beta1.QuarksStatefulSetStatus{
+				Ready:              true,
+				ObservedGeneration: 2,
+				Zones: []v1beta1.ZoneStatus{
+					{Name: "z1", Index: 0, StatefulSetName: "foo-z0", Replicas: 2, ReadyReplicas: 2, FailedOver: true},
+				},
+				Replicas:   2,
+				Selector:   "quarks.cloudfoundry.org/quarks-statefulset-name in (foo-z0,foo-z1)",
+				ActivePods: []string{"foo-z0-0"},
+				ProbeHistory: []v1beta1.ProbeResult{
+					{Pod: "foo-z0-0", Container: "a", Passing: true},
+				},
+			},
+		}
+	})
+
+	Describe("ConvertTo", func() {
+		It("stores the rollout settings as template annotations", func() {
+			hub := &v1alpha1.QuarksStatefulSet{}
+			Expect(qsts.ConvertTo(hub)).To(Succeed())
+
+			annotations := hub.Spec.Template.Annotations
+			Expect(annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-watch-time-ms", "300000"))
+			Expect(annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/update-watch-time-ms", "1200000"))
+			Expect(annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-size", "2"))
+			Expect(annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/rollout-steps", `[{"replicas":"25%","waitTime":"10m0s"},{"replicas":4,"watchTime":"5m0s"}]`))
+			Expect(annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/pause-after-canary", "true"))
+			Expect(annotations).To(HaveKeyWithValue("other", "annotation"))
+		})
+
+		It("converts the probes to a map by container", func() {
+			hub := &v1alpha1.QuarksStatefulSet{}
+			Expect(qsts.ConvertTo(hub)).To(Succeed())
+
+			Expect(hub.Spec.ActivePassiveProbes).To(HaveLen(2))
+			Expect(hub.Spec.ActivePassiveProbes["a"]).To(Equal(probe))
+			Expect(hub.Spec.ActivePassiveGRPCProbes).To(HaveLen(1))
+			Expect(hub.Spec.ActivePassiveGRPCProbes["b"].Port).To(Equal(int32(9090)))
+		})
+
+		It("does not modify the source", func() {
+			hub := &v1alpha1.QuarksStatefulSet{}
+			Expect(qsts.ConvertTo(hub)).To(Succeed())
+
+			Expect(qsts.Spec.Template.Annotations).To(HaveLen(1))
+		})
+	})
+
+	Describe("ConvertFrom", func() {
+		It("round trips through the hub version", func() {
+			hub := &v1alpha1.QuarksStatefulSet{}
+			Expect(qsts.ConvertTo(hub)).To(Succeed())
+
+			converted := &v1beta1.QuarksStatefulSet{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+			Expect(converted).To(Equal(qsts))
+		})
+
+		It("keeps watch time annotations which are not a number", func() {
+			hub := &v1alpha1.QuarksStatefulSet{
+				Spec: v1alpha1.QuarksStatefulSetSpec{
+					Template: appsv1.StatefulSet{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{
+								"quarks.cloudfoundry.org/canary-watch-time-ms": "soon",
+							},
+						},
+					},
+				},
+			}
+
+			converted := &v1beta1.QuarksStatefulSet{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+			Expect(converted.Spec.Rollout).To(BeNil())
+			Expect(converted.Spec.Template.Annotations).To(HaveKey("quarks.cloudfoundry.org/canary-watch-time-ms"))
+		})
+	})
+})
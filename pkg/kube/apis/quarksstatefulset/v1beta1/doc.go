@@ -0,0 +1,5 @@
+// This file is required so that the DeepCopy implementation is generated
+
+// +k8s:deepcopy-gen=package
+
+package v1beta1
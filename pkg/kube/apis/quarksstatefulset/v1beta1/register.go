@@ -0,0 +1,153 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/openapi"
+)
+
+// This file looks almost the same for all controllers
+// Modify the addKnownTypes function, then run `make generate`
+
+var (
+	schemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+
+	// AddToScheme is used for schema registrations in the controller package
+	// and also in the generated kube code
+	AddToScheme = schemeBuilder.AddToScheme
+
+	// QuarksStatefulSetValidation is the validation method for QuarksStatefulSet.
+	// The schema is generated from the Go types, including the embedded
+	// StatefulSet and probes, so invalid manifests are rejected on apply.
+	QuarksStatefulSetValidation = extv1.CustomResourceValidation{
+		OpenAPIV3Schema: quarksStatefulSetSchema(),
+	}
+
+	// QuarksStatefulSetAdditionalPrinterColumns are used by `kubectl get`
+	QuarksStatefulSetAdditionalPrinterColumns = []extv1.CustomResourceColumnDefinition{
+		{
+			Name:        "ready",
+			Type:        "boolean",
+			Description: "",
+			JSONPath:    ".status.ready",
+		},
+	}
+
+	// SchemeGroupVersion is group version used to register these objects
+	SchemeGroupVersion = schema.GroupVersion{Group: apis.GroupName, Version: "v1beta1"}
+)
+
+// Kind takes an unqualified kind and returns back a Group qualified GroupKind
+func Kind(kind string) schema.GroupKind {
+	return SchemeGroupVersion.WithKind(kind).GroupKind()
+}
+
+// Resource takes an unqualified resource and returns a Group qualified GroupResource
+func Resource(resource string) schema.GroupResource {
+	return SchemeGroupVersion.WithResource(resource).GroupResource()
+}
+
+// Adds the list of known types to Scheme.
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&QuarksStatefulSet{},
+		&QuarksStatefulSetList{},
+	)
+
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
+
+// quarksStatefulSetSchema generates the OpenAPI schema from the Go types and
+// marks the fields the API server has to require
+func quarksStatefulSetSchema() *extv1.JSONSchemaProps {
+	schema := openapi.CustomResourceSchema(QuarksStatefulSet{})
+
+	spec := schema.Properties["spec"]
+	spec.Required = []string{"template"}
+	spec.Properties["zoneReplicas"].Properties["zones"].Items.Schema.Required = []string{"name"}
+	zoneRemoval := spec.Properties["zoneRemoval"]
+	policy := zoneRemoval.Properties["persistentVolumeClaimPolicy"]
+	policy.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + PersistentVolumeClaimRetain + `"`)},
+		{Raw: []byte(`"` + PersistentVolumeClaimDelete + `"`)},
+	}
+	zoneRemoval.Properties["persistentVolumeClaimPolicy"] = policy
+	spec.Properties["zoneRemoval"] = zoneRemoval
+	zonePlacement := spec.Properties["zonePlacement"]
+	mode := zonePlacement.Properties["mode"]
+	mode.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + ZonePlacementRequiredAffinity + `"`)},
+		{Raw: []byte(`"` + ZonePlacementPreferredAffinity + `"`)},
+		{Raw: []byte(`"` + ZonePlacementTopologySpread + `"`)},
+	}
+	zonePlacement.Properties["mode"] = mode
+	whenUnsatisfiable := zonePlacement.Properties["whenUnsatisfiable"]
+	whenUnsatisfiable.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + corev1.DoNotSchedule + `"`)},
+		{Raw: []byte(`"` + corev1.ScheduleAnyway + `"`)},
+	}
+	zonePlacement.Properties["whenUnsatisfiable"] = whenUnsatisfiable
+	spec.Properties["zonePlacement"] = zonePlacement
+
+	spec.Properties["rollout"].Properties["steps"].Items.Schema.Required = []string{"replicas"}
+	gate := spec.Properties["rollout"].Properties["analysis"].Items.Schema
+	gate.Required = []string{"name"}
+	for name, required := range map[string][]string{
+		"exec":       {"command"},
+		"http":       {"port"},
+		"prometheus": {"address", "query", "successCondition"},
+	} {
+		analysis := gate.Properties[name]
+		analysis.Required = required
+		gate.Properties[name] = analysis
+	}
+
+	activePassive := spec.Properties["activePassive"]
+	activePassive.Required = []string{"probes"}
+	probe := activePassive.Properties["probes"].Items.Schema
+	probe.Required = []string{"container", "probe"}
+	grpc := probe.Properties["grpc"]
+	grpc.Required = []string{"port"}
+	probe.Properties["grpc"] = grpc
+	probePolicy := activePassive.Properties["policy"]
+	probePolicy.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + ActivePassiveProbeAll + `"`)},
+		{Raw: []byte(`"` + ActivePassiveProbeAny + `"`)},
+	}
+	activePassive.Properties["policy"] = probePolicy
+	election := activePassive.Properties["election"]
+	scope := election.Properties["scope"]
+	scope.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + ActivePassiveElectionGlobal + `"`)},
+		{Raw: []byte(`"` + ActivePassiveElectionPerZone + `"`)},
+		{Raw: []byte(`"` + ActivePassiveElectionPerStatefulSet + `"`)},
+	}
+	election.Properties["scope"] = scope
+	activePassive.Properties["election"] = election
+	service := activePassive.Properties["service"]
+	service.Required = []string{"ports"}
+	serviceType := service.Properties["type"]
+	serviceType.Enum = []extv1.JSON{
+		{Raw: []byte(`"` + corev1.ServiceTypeClusterIP + `"`)},
+		{Raw: []byte(`"` + corev1.ServiceTypeNodePort + `"`)},
+		{Raw: []byte(`"` + corev1.ServiceTypeLoadBalancer + `"`)},
+	}
+	service.Properties["type"] = serviceType
+	activePassive.Properties["service"] = service
+	hooks := activePassive.Properties["hooks"]
+	hooks.Required = []string{"container"}
+	activePassive.Properties["hooks"] = hooks
+	spec.Properties["activePassive"] = activePassive
+	schema.Properties["spec"] = spec
+
+	status := schema.Properties["status"]
+	status.Properties["conditions"].Items.Schema.Required = []string{"type", "status"}
+
+	return schema
+}
@@ -0,0 +1,468 @@
+package v1beta1
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+)
+
+// This file is safe to edit
+// It's used as input for the Kube code generator
+// Run "make generate" after modifying this file
+
+var (
+	// AnnotationVersion is the annotation key for the StatefulSet version
+	AnnotationVersion = v1alpha1.AnnotationVersion
+	// AnnotationZones is an array of all zones
+	AnnotationZones = v1alpha1.AnnotationZones
+	// AnnotationZoneFailedOver marks the StatefulSet of a zone, whose
+	// replicas were moved to the other zones
+	AnnotationZoneFailedOver = v1alpha1.AnnotationZoneFailedOver
+	// AnnotationRolledBackRevision marks a StatefulSet, whose failed
+	// rollout was rolled back. Its value is the failed revision.
+	AnnotationRolledBackRevision = v1alpha1.AnnotationRolledBackRevision
+	// AnnotationTemplateHash is the hash of the desired pod template of a
+	// StatefulSet
+	AnnotationTemplateHash = v1alpha1.AnnotationTemplateHash
+	// AnnotationWaitingForZone marks the StatefulSet of a zone, whose
+	// template update waits for the rollout of the previous zones. Its
+	// value is the StatefulSet it waits for.
+	AnnotationWaitingForZone = v1alpha1.AnnotationWaitingForZone
+
+	// LabelAZIndex is the index of the availability zone of a pod
+	LabelAZIndex = v1alpha1.LabelAZIndex
+	// LabelAZName is the name of the availability zone of a pod
+	LabelAZName = v1alpha1.LabelAZName
+	// LabelPodOrdinal is the ordinal of a pod in its StatefulSet
+	LabelPodOrdinal = v1alpha1.LabelPodOrdinal
+	// LabelStatefulSetName is the name of the StatefulSet a pod belongs
+	// to. It was called LabelQStsName in v1alpha1. The key itself can't
+	// change, since it's part of the immutable selector of existing
+	// StatefulSets.
+	LabelStatefulSetName = v1alpha1.LabelQStsName
+	// LabelQuarksStatefulSet is the name of the QuarksStatefulSet of a pod.
+	// It's only set on the pods of QuarksStatefulSets with zones, without
+	// zones LabelStatefulSetName is the name of the QuarksStatefulSet.
+	LabelQuarksStatefulSet = v1alpha1.LabelQuarksStatefulSet
+	// LabelActivePod marks the active pod in an active/passive setup
+	LabelActivePod = v1alpha1.LabelActivePod
+	// AnnotationActiveTerm is the term of the elected active pod. It
+	// increases with every election and can be used as a fencing token.
+	AnnotationActiveTerm = v1alpha1.AnnotationActiveTerm
+	// LabelActiveScope is the scope of the election of the active pod
+	LabelActiveScope = v1alpha1.LabelActiveScope
+)
+
+// QuarksStatefulSetSpec defines the desired state of QuarksStatefulSet
+type QuarksStatefulSetSpec struct {
+	// Template is the template for the StatefulSets
+	Template appsv1.StatefulSet `json:"template"`
+
+	// UpdateOnConfigChange indicates whether to update pods when a
+	// referenced config map or secret changes
+	UpdateOnConfigChange bool `json:"updateOnConfigChange,omitempty"`
+
+	// InjectReplicasEnv determines whether the REPLICAS env var is
+	// injected into the containers. By default, true.
+	InjectReplicasEnv *bool `json:"injectReplicasEnv,omitempty"`
+
+	// ZoneNodeLabel is the node label containing the availability zone of a node
+	ZoneNodeLabel string `json:"zoneNodeLabel,omitempty"`
+
+	// Zones are the availability zones the QuarksStatefulSet spans,
+	// there is one StatefulSet per zone
+	Zones []string `json:"zones,omitempty"`
+
+	// ZoneReplicas configures the replicas of the StatefulSet of each
+	// zone. By default, every zone runs the replicas of the template.
+	ZoneReplicas *ZoneReplicasSpec `json:"zoneReplicas,omitempty"`
+
+	// ZoneRemoval configures the clean up of the StatefulSets of removed
+	// zones. Zones can only be removed from the end, since the zone index
+	// is part of the StatefulSet name.
+	ZoneRemoval *ZoneRemovalSpec `json:"zoneRemoval,omitempty"`
+
+	// ZonePlacement configures how the pods of a zone are placed on the
+	// nodes of their zone. By default, a required node affinity pins them
+	// to the zone.
+	ZonePlacement *ZonePlacementSpec `json:"zonePlacement,omitempty"`
+
+	// ZoneFailover moves the replicas of a zone to the other zones, while
+	// none of the nodes of the zone are ready. Disabled, unless set.
+	ZoneFailover *ZoneFailoverSpec `json:"zoneFailover,omitempty"`
+
+	// Rollout configures the canary rollout of the StatefulSets
+	Rollout *RolloutSpec `json:"rollout,omitempty"`
+
+	// ActivePassive configures the probes, which determine the active pod
+	ActivePassive *ActivePassiveSpec `json:"activePassive,omitempty"`
+}
+
+// ZonePlacementMode determines how the pods of a zone are placed on the
+// nodes of their zone
+type ZonePlacementMode string
+
+const (
+	// ZonePlacementRequiredAffinity requires the nodes of the zone
+	ZonePlacementRequiredAffinity ZonePlacementMode = "RequiredAffinity"
+	// ZonePlacementPreferredAffinity prefers the nodes of the zone
+	ZonePlacementPreferredAffinity ZonePlacementMode = "PreferredAffinity"
+	// ZonePlacementTopologySpread prefers the nodes of the zone and
+	// spreads the pods of all zones evenly across the zones
+	ZonePlacementTopologySpread ZonePlacementMode = "TopologySpread"
+)
+
+// ZonePlacementSpec configures how the pods of a zone are placed on the
+// nodes of their zone
+type ZonePlacementSpec struct {
+	// Mode is one of RequiredAffinity, PreferredAffinity or
+	// TopologySpread. By default, RequiredAffinity.
+	Mode ZonePlacementMode `json:"mode,omitempty"`
+	// WhenUnsatisfiable configures the topology spread constraint, either
+	// DoNotSchedule or ScheduleAnyway. By default, DoNotSchedule.
+	WhenUnsatisfiable corev1.UnsatisfiableConstraintAction `json:"whenUnsatisfiable,omitempty"`
+}
+
+// ZoneFailoverSpec configures the failover of zones, whose nodes are all
+// not ready
+type ZoneFailoverSpec struct {
+	// Delay is the time all nodes of a zone have to be not ready, before
+	// the replicas of the zone are moved to the other zones. By default, 0.
+	Delay *metav1.Duration `json:"delay,omitempty"`
+}
+
+// PersistentVolumeClaimPolicy determines what happens to the persistent
+// volume claims of a StatefulSet, when it's removed
+type PersistentVolumeClaimPolicy string
+
+const (
+	// PersistentVolumeClaimRetain keeps the persistent volume claims
+	PersistentVolumeClaimRetain PersistentVolumeClaimPolicy = "Retain"
+	// PersistentVolumeClaimDelete deletes the persistent volume claims
+	PersistentVolumeClaimDelete PersistentVolumeClaimPolicy = "Delete"
+)
+
+// ZoneRemovalSpec configures the clean up of the StatefulSets of zones,
+// which were removed from Spec.Zones
+type ZoneRemovalSpec struct {
+	// Drain scales the StatefulSet down and waits for its pods to
+	// terminate, before deleting it. By default, true.
+	Drain *bool `json:"drain,omitempty"`
+	// PersistentVolumeClaimPolicy determines whether the persistent volume
+	// claims of the StatefulSet are retained or deleted. By default, Retain.
+	PersistentVolumeClaimPolicy PersistentVolumeClaimPolicy `json:"persistentVolumeClaimPolicy,omitempty"`
+}
+
+// ZoneReplicasSpec configures the replicas of the StatefulSet of each zone
+type ZoneReplicasSpec struct {
+	// Distribute the replicas of the template across the zones by weight,
+	// instead of running them in every zone
+	Distribute bool `json:"distribute,omitempty"`
+	// Zones overrides the replicas or sets the weight of single zones
+	Zones []ZoneReplicas `json:"zones,omitempty"`
+}
+
+// ZoneReplicas configures the replicas of a single zone
+type ZoneReplicas struct {
+	// Name of the availability zone, one of Spec.Zones
+	Name string `json:"name"`
+	// Replicas of the zone, overriding the template replicas or the share
+	// of the distributed replicas
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Weight of the zone when distributing replicas. By default, 1.
+	Weight *int32 `json:"weight,omitempty"`
+}
+
+// RolloutSpec configures the canary rollout of the StatefulSets
+type RolloutSpec struct {
+	// CanaryWatchTime is the max time for the canary pod to become ready
+	CanaryWatchTime *metav1.Duration `json:"canaryWatchTime,omitempty"`
+	// UpdateWatchTime is the max time for the complete update
+	UpdateWatchTime *metav1.Duration `json:"updateWatchTime,omitempty"`
+	// Canary is the number or percentage of pods updated first. By
+	// default, 1.
+	Canary *intstr.IntOrString `json:"canary,omitempty"`
+	// Steps of the rollout after the canary. Without steps, and after the
+	// last step, the remaining pods are updated one by one.
+	Steps []RolloutStep `json:"steps,omitempty"`
+	// PauseAfterCanary pauses the rollout after the canary, until it's
+	// promoted with the rollout-action annotation of the StatefulSet
+	PauseAfterCanary bool `json:"pauseAfterCanary,omitempty"`
+	// AutoRollback restores the previous pod template, if the rollout
+	// fails, and rolls it out
+	AutoRollback bool `json:"autoRollback,omitempty"`
+	// Analysis gates, which have to succeed for the freshly updated pod,
+	// before the partition moves on
+	Analysis []AnalysisGate `json:"analysis,omitempty"`
+	// SequentialZones updates the StatefulSets of the zones one after the
+	// other. A zone is updated after the rollout of the previous zone is
+	// done, a failed rollout stops the update of the remaining zones.
+	SequentialZones bool `json:"sequentialZones,omitempty"`
+}
+
+// RolloutStep is a step of the canary rollout after the canary
+type RolloutStep struct {
+	// Replicas is the number or percentage of updated pods after the step
+	Replicas intstr.IntOrString `json:"replicas"`
+	// WaitTime is how long the pods of the previous step have to be ready,
+	// before the step starts
+	WaitTime *metav1.Duration `json:"waitTime,omitempty"`
+	// WatchTime is the max time for the pods of the step to become ready
+	WatchTime *metav1.Duration `json:"watchTime,omitempty"`
+}
+
+// AnalysisGate is a check of the freshly updated pod, which has to succeed
+// before the partition of the rollout moves on
+type AnalysisGate struct {
+	// Name of the gate
+	Name string `json:"name"`
+	// Exec runs a command in a container of the pod
+	Exec *ExecAnalysis `json:"exec,omitempty"`
+	// HTTP sends a GET request to the pod
+	HTTP *HTTPAnalysis `json:"http,omitempty"`
+	// Prometheus runs an instant query against a Prometheus-compatible API
+	Prometheus *PrometheusAnalysis `json:"prometheus,omitempty"`
+	// Interval between two attempts. By default, 10s.
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Timeout of an attempt. By default, 5s.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// FailureLimit is the number of failed attempts, after which the
+	// rollout fails. By default, 3.
+	FailureLimit *int32 `json:"failureLimit,omitempty"`
+}
+
+// ExecAnalysis succeeds if the command exits with 0 and its output
+// contains the expected output
+type ExecAnalysis struct {
+	// Container to run the command in. By default, the first container.
+	Container string `json:"container,omitempty"`
+	// Command to run
+	Command []string `json:"command"`
+	// ExpectedOutput has to be part of the output of the command
+	ExpectedOutput string `json:"expectedOutput,omitempty"`
+}
+
+// HTTPAnalysis succeeds if the response has one of the expected status
+// codes and its body contains the expected body
+type HTTPAnalysis struct {
+	// Path of the request
+	Path string `json:"path,omitempty"`
+	// Port of the container, a number or a name
+	Port intstr.IntOrString `json:"port"`
+	// Scheme is either HTTP or HTTPS. By default, HTTP.
+	Scheme corev1.URIScheme `json:"scheme,omitempty"`
+	// ExpectedStatus codes. By default, 200 to 399.
+	ExpectedStatus []int32 `json:"expectedStatus,omitempty"`
+	// ExpectedBody has to be part of the body of the response
+	ExpectedBody string `json:"expectedBody,omitempty"`
+}
+
+// PrometheusAnalysis succeeds if the result of the query meets the success
+// condition
+type PrometheusAnalysis struct {
+	// Address of the API, e.g. http://prometheus.monitoring:9090. It has
+	// to be one of the addresses the operator allows.
+	Address string `json:"address"`
+	// Query is an instant query. {{pod}} and {{namespace}} are replaced
+	// with the name and namespace of the pod.
+	Query string `json:"query"`
+	// SuccessCondition compares the first value of the result with a
+	// number, e.g. "< 0.05". The operators are <, <=, >, >=, == and !=.
+	SuccessCondition string `json:"successCondition"`
+}
+
+// ActivePassiveSpec configures the probes, which determine the active pod
+type ActivePassiveSpec struct {
+	// Probes are run periodically in the containers of every pod
+	Probes []ContainerProbe `json:"probes"`
+	// Policy is either All, if the probes of all containers have to pass,
+	// or Any. By default, All.
+	Policy ActivePassiveProbePolicy `json:"policy,omitempty"`
+	// Election elects a single active pod, instead of marking every pod,
+	// which passes the probes, as active
+	Election *ActivePassiveElectionSpec `json:"election,omitempty"`
+	// Service creates a Service, which selects the active pod
+	Service *ActiveServiceSpec `json:"service,omitempty"`
+	// Hooks run in a pod, before the active label is added or removed
+	Hooks *ActivePassiveHooks `json:"hooks,omitempty"`
+}
+
+// ActivePassiveHooks run in a pod, before its active label is added or
+// removed, e.g. to promote a replica or to fence the old primary
+type ActivePassiveHooks struct {
+	// Container the exec hooks run in. Named ports of the httpGet and
+	// tcpSocket hooks are looked up in this container.
+	Container string `json:"container"`
+	// PrePromotion runs in a pod, before it's labeled as active
+	PrePromotion *corev1.Handler `json:"prePromotion,omitempty"`
+	// PreDemotion runs in a ready pod, before the active label is removed.
+	// With an election, a pod whose hook keeps failing is demoted anyway,
+	// once the failover delay, but at least the timeout, passed.
+	PreDemotion *corev1.Handler `json:"preDemotion,omitempty"`
+	// TimeoutSeconds after which a hook fails. By default, 10.
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// ActiveServiceSpec configures a Service, which selects the active pod of
+// the QuarksStatefulSet. The Service is owned by the QuarksStatefulSet.
+type ActiveServiceSpec struct {
+	// Type of the Service, either ClusterIP, NodePort or LoadBalancer. By
+	// default, ClusterIP.
+	Type corev1.ServiceType `json:"type,omitempty"`
+	// Ports exposed by the Service
+	Ports []corev1.ServicePort `json:"ports"`
+	// Annotations of the Service
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ActivePassiveProbePolicy determines how the results of the probes of
+// several containers are combined
+type ActivePassiveProbePolicy string
+
+const (
+	// ActivePassiveProbeAll requires the probes of all containers to pass
+	ActivePassiveProbeAll ActivePassiveProbePolicy = "All"
+	// ActivePassiveProbeAny requires the probe of any container to pass
+	ActivePassiveProbeAny ActivePassiveProbePolicy = "Any"
+)
+
+// ActivePassiveElectionScope determines the pods, of which at most one is
+// active
+type ActivePassiveElectionScope string
+
+const (
+	// ActivePassiveElectionGlobal elects one active pod across all zones
+	ActivePassiveElectionGlobal ActivePassiveElectionScope = "Global"
+	// ActivePassiveElectionPerZone elects one active pod in every zone, the
+	// StatefulSets of zones with the same name share one election
+	ActivePassiveElectionPerZone ActivePassiveElectionScope = "PerZone"
+	// ActivePassiveElectionPerStatefulSet elects one active pod in every
+	// StatefulSet, even if several StatefulSets share a zone
+	ActivePassiveElectionPerStatefulSet ActivePassiveElectionScope = "PerStatefulSet"
+)
+
+// ActivePassiveElectionSpec configures the election of a single active pod.
+// The active pod holds a lease, another pod is only elected once the lease
+// expired.
+type ActivePassiveElectionSpec struct {
+	// Scope is either Global, PerZone or PerStatefulSet. By default, Global.
+	Scope ActivePassiveElectionScope `json:"scope,omitempty"`
+	// FailoverDelay is the time the active pod may fail its probe, before
+	// another pod is elected. By default, 0.
+	FailoverDelay *metav1.Duration `json:"failoverDelay,omitempty"`
+}
+
+// GRPCAction checks the standard gRPC health service of a container. The
+// probes of this Kubernetes version have no gRPC handler.
+type GRPCAction struct {
+	// Port of the gRPC service
+	Port int32 `json:"port"`
+	// Service is sent in the health check request. By default, empty, which
+	// checks the health of the server.
+	Service *string `json:"service,omitempty"`
+}
+
+// ContainerProbe is a probe run in a specific container of a pod
+type ContainerProbe struct {
+	// Container is the name of the container the probe runs in
+	Container string `json:"container"`
+	// Probe to run
+	Probe corev1.Probe `json:"probe"`
+	// GRPC checks the gRPC health service instead of running the handler of
+	// the probe. The probe only configures the timing.
+	GRPC *GRPCAction `json:"grpc,omitempty"`
+}
+
+// QuarksStatefulSetStatus defines the observed state of QuarksStatefulSet
+type QuarksStatefulSetStatus struct {
+	// LastReconcile is the timestamp of the last reconcile
+	LastReconcile *metav1.Time `json:"lastReconcile,omitempty"`
+	// Ready determines whether the QuarksStatefulSet is ready to serve
+	Ready bool `json:"ready"`
+	// ObservedGeneration is the most recent generation applied to the StatefulSets
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions represent the latest available observations of the QuarksStatefulSet
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Zones lists the state of the StatefulSet of each availability zone
+	Zones []ZoneStatus `json:"zones,omitempty"`
+	// Replicas is the number of pods per zone, as reported by the scale subresource
+	Replicas int32 `json:"replicas,omitempty"`
+	// Selector is the label selector for the pods of all zones, as reported by the scale subresource
+	Selector string `json:"selector,omitempty"`
+	// ActivePods are the names of the pods labeled as active
+	ActivePods []string `json:"activePods,omitempty"`
+	// LastActiveTransitionTime is the last time the active pods changed
+	LastActiveTransitionTime *metav1.Time `json:"lastActiveTransitionTime,omitempty"`
+	// ProbeHistory lists the latest changes of the active/passive probe
+	// results, the newest last
+	ProbeHistory []ProbeResult `json:"probeHistory,omitempty"`
+}
+
+// ProbeResult is a change of the result of the active/passive probe of a
+// container
+type ProbeResult struct {
+	// Time of the change
+	Time metav1.Time `json:"time"`
+	// Pod is the name of the probed pod
+	Pod string `json:"pod"`
+	// Container is the name of the probed container
+	Container string `json:"container"`
+	// Passing is true if the probe passes since then
+	Passing bool `json:"passing"`
+	// Message is the truncated error of a failing probe
+	Message string `json:"message,omitempty"`
+}
+
+// ZoneStatus defines the observed state of the StatefulSet of one availability zone
+type ZoneStatus struct {
+	// Name of the availability zone
+	Name string `json:"name"`
+	// Index of the availability zone in Spec.Zones
+	Index int `json:"index"`
+	// StatefulSetName is the name of the StatefulSet for this zone
+	StatefulSetName string `json:"statefulSetName"`
+	// Replicas is the number of desired replicas
+	Replicas int32 `json:"replicas"`
+	// ReadyReplicas is the number of pods with a Ready condition
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// UpdatedReplicas is the number of pods running the latest revision
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+	// RolloutState is the state of the canary rollout
+	RolloutState string `json:"rolloutState,omitempty"`
+	// Version is the QuarksStatefulSet version of the StatefulSet
+	Version string `json:"version,omitempty"`
+	// FailedOver is true while the replicas of the zone run in the other zones
+	FailedOver bool `json:"failedOver,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// QuarksStatefulSet is the Schema for the QuarksStatefulSet API
+// +k8s:openapi-gen=true
+type QuarksStatefulSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   QuarksStatefulSetSpec   `json:"spec,omitempty"`
+	Status QuarksStatefulSetStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// QuarksStatefulSetList contains a list of QuarksStatefulSet
+type QuarksStatefulSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuarksStatefulSet `json:"items"`
+}
+
+// GetNamespacedName returns the resource name with its namespace
+func (q *QuarksStatefulSet) GetNamespacedName() string {
+	return fmt.Sprintf("%s/%s", q.Namespace, q.Name)
+}
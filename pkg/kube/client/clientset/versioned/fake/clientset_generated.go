@@ -11,6 +11,8 @@ import (
 	clientset "code.cloudfoundry.org/quarks-statefulset/pkg/kube/client/clientset/versioned"
 	quarksstatefulsetv1alpha1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/client/clientset/versioned/typed/quarksstatefulset/v1alpha1"
 	fakequarksstatefulsetv1alpha1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/client/clientset/versioned/typed/quarksstatefulset/v1alpha1/fake"
+	quarksstatefulsetv1beta1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/client/clientset/versioned/typed/quarksstatefulset/v1beta1"
+	fakequarksstatefulsetv1beta1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/client/clientset/versioned/typed/quarksstatefulset/v1beta1/fake"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
@@ -69,3 +71,8 @@ var _ clientset.Interface = &Clientset{}
 func (c *Clientset) QuarksstatefulsetV1alpha1() quarksstatefulsetv1alpha1.QuarksstatefulsetV1alpha1Interface {
 	return &fakequarksstatefulsetv1alpha1.FakeQuarksstatefulsetV1alpha1{Fake: &c.Fake}
 }
+
+// QuarksstatefulsetV1beta1 retrieves the QuarksstatefulsetV1beta1Client
+func (c *Clientset) QuarksstatefulsetV1beta1() quarksstatefulsetv1beta1.QuarksstatefulsetV1beta1Interface {
+	return &fakequarksstatefulsetv1beta1.FakeQuarksstatefulsetV1beta1{Fake: &c.Fake}
+}
@@ -2,15 +2,24 @@ package controllers
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	qstsv1b1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1beta1"
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/quarksstatefulset"
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/statefulset"
 	"code.cloudfoundry.org/quarks-utils/pkg/config"
@@ -38,6 +47,8 @@ var addToManagerFuncs = []func(context.Context, *config.Config, manager.Manager)
 
 var addToSchemes = runtime.SchemeBuilder{
 	qstsv1a1.AddToScheme,
+	qstsv1b1.AddToScheme,
+	extv1.AddToScheme,
 }
 
 var mutatingHookFuncs = []func(*zap.SugaredLogger, *config.Config) *webhook.OperatorWebhook{
@@ -45,6 +56,10 @@ var mutatingHookFuncs = []func(*zap.SugaredLogger, *config.Config) *webhook.Oper
 	statefulset.NewStatefulSetRolloutMutator,
 }
 
+var validatingHookFuncs = []func(*zap.SugaredLogger, *config.Config) *webhook.OperatorWebhook{
+	quarksstatefulset.NewQuarksStatefulSetValidator,
+}
+
 // AddToManager adds all Controllers to the Manager
 func AddToManager(ctx context.Context, config *config.Config, m manager.Manager) error {
 	for _, f := range addToManagerFuncs {
@@ -80,6 +95,15 @@ func AddHooks(ctx context.Context, config *config.Config, m manager.Manager, gen
 		hookServer.Register(hook.Path, hook.Webhook)
 	}
 
+	validatingWebhooks := make([]*webhook.OperatorWebhook, len(validatingHookFuncs))
+	for idx, f := range validatingHookFuncs {
+		hook := f(log, config)
+		validatingWebhooks[idx] = hook
+		hookServer.Register(hook.Path, hook.Webhook)
+	}
+
+	hookServer.Register(quarksstatefulset.ConversionWebhookPath, quarksstatefulset.NewConversionWebhook())
+
 	ctxlog.Info(ctx, "Generating webhook certificates")
 	err := webhookConfig.SetupCertificate(ctx, "qsts-webhook")
 	if err != nil {
@@ -92,9 +116,78 @@ func AddHooks(ctx context.Context, config *config.Config, m manager.Manager, gen
 		return errors.Wrap(err, "generating the webhook server configuration")
 	}
 
+	ctxlog.Info(ctx, "Generating validating webhook server configuration")
+	err = createValidationWebhookServerConfig(ctx, m.GetClient(), config, webhookConfig, "qsts-webhook", validatingWebhooks)
+	if err != nil {
+		return errors.Wrap(err, "generating the validating webhook server configuration")
+	}
+
+	ctxlog.Info(ctx, "Configuring conversion webhook")
+	err = quarksstatefulset.ConfigureConversionWebhook(ctx, m.GetClient(), config, "qsts-webhook", webhookConfig.CaCertificate)
+	if err != nil {
+		return errors.Wrap(err, "configuring the conversion webhook")
+	}
+
 	return nil
 }
 
+// createValidationWebhookServerConfig creates the config for the validating
+// webhooks. Unlike webhook.Config.CreateValidationWebhookServerConfig, it
+// references our own service.
+func createValidationWebhookServerConfig(ctx context.Context, client crc.Client, config *config.Config, webhookConfig *webhook.Config, name string, webhooks []*webhook.OperatorWebhook) error {
+	if len(webhookConfig.CaCertificate) == 0 {
+		return errors.Errorf("can not create a webhook server config with an empty ca certificate")
+	}
+
+	validatingConfig := &admissionregistration.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: webhookConfig.ConfigName,
+		},
+	}
+
+	sideEffect := admissionregistration.SideEffectClassNone
+	for _, hook := range webhooks {
+		ctxlog.Debugf(ctx, "Calculating validating webhook '%s'", hook.Name)
+
+		clientConfig := admissionregistration.WebhookClientConfig{
+			CABundle: webhookConfig.CaCertificate,
+		}
+		if config.WebhookUseServiceRef {
+			path := hook.Path
+			clientConfig.Service = &admissionregistration.ServiceReference{
+				Name:      name,
+				Namespace: config.OperatorNamespace,
+				Path:      &path,
+			}
+		} else {
+			u := url.URL{
+				Scheme: "https",
+				Host:   net.JoinHostPort(config.WebhookServerHost, strconv.Itoa(int(config.WebhookServerPort))),
+				Path:   hook.Path,
+			}
+			urlString := u.String()
+			clientConfig.URL = &urlString
+		}
+
+		failurePolicy := hook.FailurePolicy
+		validatingConfig.Webhooks = append(validatingConfig.Webhooks, admissionregistration.ValidatingWebhook{
+			Name:                    hook.Name,
+			Rules:                   hook.Rules,
+			FailurePolicy:           &failurePolicy,
+			NamespaceSelector:       hook.NamespaceSelector,
+			ClientConfig:            clientConfig,
+			SideEffects:             &sideEffect,
+			AdmissionReviewVersions: []string{"v1beta1", "v1"},
+		})
+	}
+
+	ctxlog.Debugf(ctx, "Creating validating webhook config '%s'", validatingConfig.Name)
+	if err := client.Delete(ctx, validatingConfig); err != nil && !apierrors.IsNotFound(err) {
+		ctxlog.Debugf(ctx, "Trying to delete existing validatingWebhookConfiguration '%s': %s", validatingConfig.Name, err.Error())
+	}
+	return client.Create(ctx, validatingConfig)
+}
+
 func ordinaryHTTPHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -10,6 +10,7 @@ import (
 	"github.com/spf13/afero"
 
 	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -19,6 +20,7 @@ import (
 	crc "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	qstsv1b1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1beta1"
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers"
 	cfakes "code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/fakes"
 	"code.cloudfoundry.org/quarks-statefulset/testing"
@@ -38,6 +40,10 @@ var _ = Describe("Controllers", func() {
 				kinds = append(kinds, k.Kind)
 			}
 			Expect(kinds).To(ContainElement("QuarksStatefulSet"))
+
+			gvks, _, err := scheme.ObjectKinds(&qstsv1b1.QuarksStatefulSet{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gvks[0].Version).To(Equal("v1beta1"))
 		})
 	})
 
@@ -117,13 +123,15 @@ var _ = Describe("Controllers", func() {
 
 				Expect(afero.Exists(config.Fs, file)).To(BeTrue())
 				Expect(generator.GenerateCertificateCallCount()).To(Equal(2)) // Generate CA and certificate
-				Expect(client.CreateCallCount()).To(Equal(2))                 // Persist secret and the 1 webhook config (Mutating)
+				Expect(client.CreateCallCount()).To(Equal(3))                 // Persist secret and the 2 webhook configs (Mutating and Validating)
 			})
 		})
 
 		Context("if there is a persisted cert secret already", func() {
+			var secret *unstructured.Unstructured
+
 			BeforeEach(func() {
-				secret := &unstructured.Unstructured{
+				secret = &unstructured.Unstructured{
 					Object: map[string]interface{}{
 						"metadata": map[string]interface{}{
 							"name":      "qsts-webhook-server-cert",
@@ -150,15 +158,25 @@ var _ = Describe("Controllers", func() {
 			It("does not overwrite the existing secret", func() {
 				err := controllers.AddHooks(ctx, config, manager, generator)
 				Expect(err).ToNot(HaveOccurred())
-				Expect(client.CreateCallCount()).To(Equal(1)) // webhook config for Mutation and Validation
+				Expect(client.CreateCallCount()).To(Equal(2)) // webhook config for Mutation and Validation
 			})
 
 			It("generates the webhook configuration", func() {
 				client.CreateCalls(func(context context.Context, object crc.Object, _ ...crc.CreateOption) error {
-					// We should be getting 1 Create call - for the
-					// Mutating Webhook
+					// We should be getting 2 Create calls - for the
+					// Mutating and the Validating Webhook
 
 					switch config := object.(type) {
+					case *admissionregistration.ValidatingWebhookConfiguration:
+						Expect(config.Name).To(Equal("qsts-hook-default"))
+						Expect(len(config.Webhooks)).To(Equal(1))
+
+						wh := config.Webhooks[0]
+						Expect(wh.Name).To(Equal("validate-quarksstatefulsets.quarks.cloudfoundry.org"))
+						Expect(*wh.ClientConfig.URL).To(Equal("https://foo.com:1234/validate-quarksstatefulsets"))
+						Expect(wh.ClientConfig.CABundle).To(ContainSubstring("the-ca-cert"))
+						Expect(*wh.FailurePolicy).To(Equal(admissionregistration.Fail))
+						return nil
 					case *admissionregistration.MutatingWebhookConfiguration:
 						Expect(config.Name).To(Equal("qsts-hook-default"))
 						Expect(len(config.Webhooks)).To(Equal(2))
@@ -176,6 +194,52 @@ var _ = Describe("Controllers", func() {
 				err := controllers.AddHooks(ctx, config, manager, generator)
 				Expect(err).ToNot(HaveOccurred())
 			})
+
+			It("references the operator service if configured", func() {
+				config.WebhookUseServiceRef = true
+				client.CreateCalls(func(context context.Context, object crc.Object, _ ...crc.CreateOption) error {
+					if config, ok := object.(*admissionregistration.ValidatingWebhookConfiguration); ok {
+						service := config.Webhooks[0].ClientConfig.Service
+						Expect(service.Name).To(Equal("qsts-webhook"))
+						Expect(*service.Path).To(Equal("/validate-quarksstatefulsets"))
+					}
+					return nil
+				})
+				err := controllers.AddHooks(ctx, config, manager, generator)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("configures the conversion webhook of the CRD", func() {
+				client.GetCalls(func(context context.Context, nn types.NamespacedName, object crc.Object) error {
+					switch object := object.(type) {
+					case *unstructured.Unstructured:
+						secret.DeepCopyInto(object)
+						return nil
+					case *extv1.CustomResourceDefinition:
+						object.Name = nn.Name
+						return nil
+					}
+					return apierrors.NewNotFound(schema.GroupResource{}, nn.Name)
+				})
+
+				err := controllers.AddHooks(ctx, config, manager, generator)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(client.PatchCallCount()).To(Equal(1))
+				_, object, _, _ := client.PatchArgsForCall(0)
+				crd := object.(*extv1.CustomResourceDefinition)
+				Expect(crd.Name).To(Equal("quarksstatefulsets.quarks.cloudfoundry.org"))
+				Expect(crd.Spec.Conversion.Strategy).To(Equal(extv1.WebhookConverter))
+				clientConfig := crd.Spec.Conversion.Webhook.ClientConfig
+				Expect(*clientConfig.URL).To(Equal("https://foo.com:1234/convert"))
+				Expect(clientConfig.CABundle).To(ContainSubstring("the-ca-cert"))
+			})
+
+			It("skips the conversion webhook if the CRD does not exist", func() {
+				err := controllers.AddHooks(ctx, config, manager, generator)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(client.PatchCallCount()).To(Equal(0))
+			})
 		})
 	})
 })
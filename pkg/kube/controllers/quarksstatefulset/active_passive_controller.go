@@ -6,18 +6,24 @@ import (
 
 	"github.com/pkg/errors"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
 	"code.cloudfoundry.org/quarks-utils/pkg/config"
 	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
 	"code.cloudfoundry.org/quarks-utils/pkg/monitorednamespace"
+	podutil "code.cloudfoundry.org/quarks-utils/pkg/pod"
 )
 
 // AddStatefulSetActivePassive creates a new QuarksStatefulSet controller that watches multiple instances
@@ -84,5 +90,60 @@ func AddStatefulSetActivePassive(ctx context.Context, config *config.Config, mgr
 		return errors.Wrapf(err, "watching QuarksStatefulSet failed in active/passive controller")
 	}
 
+	// Watch the pods of active/passive QuarksStatefulSets, so a pod which
+	// becomes unready or is deleted loses the active label right away,
+	// instead of at the next probe
+	podPredicates := predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return false },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return isQuarksStatefulSetPod(e.Object) },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if !isQuarksStatefulSetPod(e.ObjectNew) {
+				return false
+			}
+			oldPod := e.ObjectOld.(*corev1.Pod)
+			newPod := e.ObjectNew.(*corev1.Pod)
+
+			return podutil.IsPodReady(oldPod) != podutil.IsPodReady(newPod) ||
+				(oldPod.DeletionTimestamp == nil && newPod.DeletionTimestamp != nil)
+		},
+	}
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(
+		func(a crc.Object) []reconcile.Request {
+			return ActivePassivePodReconciles(ctx, mgr.GetClient(), a)
+		}),
+		nsPred, podPredicates)
+	if err != nil {
+		return errors.Wrapf(err, "watching pods failed in active/passive controller")
+	}
+
 	return nil
 }
+
+// ActivePassivePodReconciles returns the reconcile request for the
+// active/passive QuarksStatefulSet of a pod
+func ActivePassivePodReconciles(ctx context.Context, client crc.Client, pod crc.Object) []reconcile.Request {
+	name := types.NamespacedName{Name: quarksStatefulSetOfPod(pod.GetLabels()), Namespace: pod.GetNamespace()}
+
+	qSts := &qstsv1a1.QuarksStatefulSet{}
+	if err := client.Get(ctx, name, qSts); err != nil {
+		if !apierrors.IsNotFound(err) {
+			ctxlog.Errorf(ctx, "Failed to get QuarksStatefulSet '%s' of pod '%s/%s': %v", name, pod.GetNamespace(), pod.GetName(), err)
+		}
+		return []reconcile.Request{}
+	}
+	if qSts.Spec.ActivePassiveProbes == nil {
+		return []reconcile.Request{}
+	}
+
+	reconciliation := reconcile.Request{NamespacedName: name}
+	ctxlog.NewMappingEvent(pod).Debug(ctx, reconciliation, "QuarksStatefulSet", pod.GetName(), "pod")
+	return []reconcile.Request{reconciliation}
+}
+
+// isQuarksStatefulSetPod returns true, if the object is a pod of a
+// QuarksStatefulSet
+func isQuarksStatefulSetPod(o crc.Object) bool {
+	_, ok := o.GetLabels()[qstsv1a1.LabelQStsName]
+	return ok
+}
@@ -0,0 +1,287 @@
+package quarksstatefulset
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+	"code.cloudfoundry.org/quarks-utils/pkg/names"
+	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
+)
+
+// election is a group of pods, of which at most one is active
+type election struct {
+	// lease is the name of the lease held by the active pod
+	lease string
+	// scope is the value of the scope label of the active pod, names
+	// longer than a label value are shortened
+	scope string
+	// pods are ordered by zone index and ordinal, the first candidate wins
+	pods []corev1.Pod
+}
+
+// elections groups the pods of the StatefulSets by the election scope
+func (r *ReconcileStatefulSetActivePassive) elections(ctx context.Context, qSts *qstsv1a1.QuarksStatefulSet, statefulSets []*appsv1.StatefulSet) ([]election, error) {
+	sort.Slice(statefulSets, func(i, j int) bool {
+		return zoneIndex(statefulSets[i]) < zoneIndex(statefulSets[j])
+	})
+
+	scope := qSts.Spec.ActivePassiveElection.Scope
+	elections := []election{}
+	// index of the election by its scope
+	index := map[string]int{}
+	for _, statefulSet := range statefulSets {
+		// GetMaxStatefulSetVersion returns an unnamed default, if there are no StatefulSets yet
+		if statefulSet.Name == "" {
+			continue
+		}
+
+		ownedPods, err := r.getStsPodList(ctx, statefulSet)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't retrieve pod items from sts: '%s/%s'", statefulSet.Namespace, statefulSet.Name)
+		}
+		pods := ownedPods.Items
+		sort.Slice(pods, func(i, j int) bool { return podOrdinal(pods[i].Name) < podOrdinal(pods[j].Name) })
+
+		e := election{lease: qSts.Name + "-active", scope: qSts.Name}
+		switch scope {
+		case qstsv1a1.ActivePassiveElectionPerZone:
+			// The first StatefulSet of the zone names the lease
+			e = election{lease: statefulSet.Name + "-active", scope: statefulSet.Name}
+			if zone, ok := statefulSet.Labels[qstsv1a1.LabelAZName]; ok {
+				e.scope = zone
+			}
+		case qstsv1a1.ActivePassiveElectionPerStatefulSet:
+			e = election{lease: statefulSet.Name + "-active", scope: statefulSet.Name}
+		}
+		// Names can be longer than label values. The lease keeps the full name,
+		// up to the length of object names.
+		e.lease = names.TruncateMD5(e.lease, validation.DNS1123SubdomainMaxLength)
+		e.scope = names.TruncateMD5(e.scope, validation.LabelValueMaxLength)
+
+		i, ok := index[e.scope]
+		if !ok {
+			i = len(elections)
+			index[e.scope] = i
+			elections = append(elections, e)
+		}
+		elections[i].pods = append(elections[i].pods, pods...)
+	}
+
+	return elections, nil
+}
+
+// elect makes sure at most one pod of the election is active. The active pod
+// holds a lease, which it renews as long as it passes its probe. Another pod
+// is only elected once the lease expired, i.e. the active pod failed its
+// probe for longer than the failover delay. Until then, the active pod keeps
+// its label. The candidate with the lowest zone index and ordinal wins.
+//
+// Hooks run in the pods before their labels change. A failing hook keeps the
+// labels, the hook runs again with the next reconcile.
+//
+// The lease is updated before any label changes. If another reconcile
+// changed the lease in the meantime, the update fails on the resource
+// version and no label changes. The term of the lease is set on the active
+// pod, to be used as a fencing token.
+//
+// It returns the time until the lease of a failing active pod expires, or
+// until an old active pod is demoted without its pre-demotion hook.
+func (r *ReconcileStatefulSetActivePassive) elect(ctx context.Context, qSts *qstsv1a1.QuarksStatefulSet, e election, candidates map[string]bool) (time.Duration, error) {
+	lease := &coordinationv1.Lease{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: e.lease, Namespace: qSts.Namespace}, lease)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return 0, errors.Wrapf(err, "could not get lease '%s/%s'", qSts.Namespace, e.lease)
+	}
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: e.lease, Namespace: qSts.Namespace},
+		}
+		if err := controllerutil.SetControllerReference(qSts, lease, r.scheme); err != nil {
+			return 0, errors.Wrapf(err, "could not set owner of lease '%s/%s'", qSts.Namespace, e.lease)
+		}
+	}
+
+	delay := time.Duration(0)
+	if qSts.Spec.ActivePassiveElection.FailoverDelay != nil {
+		delay = qSts.Spec.ActivePassiveElection.FailoverDelay.Duration
+	}
+	if delay > 0 {
+		lease.Spec.LeaseDurationSeconds = pointers.Int32(int32(math.Ceil(delay.Seconds())))
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+
+	remaining := time.Duration(0)
+	if holder != "" && lease.Spec.RenewTime != nil {
+		remaining = lease.Spec.RenewTime.Add(delay).Sub(now.Time)
+	}
+
+	requeueAfter := time.Duration(0)
+	switch {
+	case holder != "" && candidates[holder]:
+		lease.Spec.RenewTime = &now
+	case holder != "" && remaining > 0:
+		ctxlog.Debugf(ctx, "Active pod '%s/%s' failed its probe, electing another pod in %s", qSts.Namespace, holder, remaining)
+		requeueAfter = remaining
+	default:
+		elected := ""
+		for _, pod := range e.pods {
+			if candidates[pod.Name] {
+				elected = pod.Name
+				break
+			}
+		}
+
+		if elected == "" {
+			lease.Spec.HolderIdentity = nil
+		} else {
+			if elected != holder {
+				ctxlog.WithEvent(qSts, "active-passive").Debugf(ctx, "Elected pod '%s/%s' as active", qSts.Namespace, elected)
+				lease.Spec.HolderIdentity = pointers.String(elected)
+				lease.Spec.AcquireTime = &now
+				lease.Spec.LeaseTransitions = pointers.Int32(leaseTransitions(lease) + 1)
+			}
+			lease.Spec.RenewTime = &now
+		}
+		holder = elected
+	}
+
+	if lease.ResourceVersion == "" {
+		err = r.client.Create(ctx, lease)
+	} else {
+		err = r.client.Update(ctx, lease)
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not update lease '%s/%s'", qSts.Namespace, e.lease)
+	}
+
+	// A pre-demotion hook, which keeps failing, must not block the new pod
+	// forever. Once the failover delay, but at least the hook timeout,
+	// passed since the election, the old pod is demoted without the hook.
+	// The new term fences it.
+	demoteWithin := time.Duration(0)
+	skipHook := false
+	if holder != "" && lease.Spec.AcquireTime != nil {
+		deadline := delay
+		if timeout := hookTimeout(qSts); deadline < timeout {
+			deadline = timeout
+		}
+		demoteWithin = lease.Spec.AcquireTime.Add(deadline).Sub(now.Time)
+		skipHook = demoteWithin <= 0
+	}
+
+	// Demote first, so there is never more than one active pod. If the
+	// pre-demotion hook of the old pod fails, the new pod isn't promoted.
+	var active *corev1.Pod
+	demoted := true
+	for i := range e.pods {
+		pod := &e.pods[i]
+		if pod.Name == holder {
+			active = pod
+			continue
+		}
+		err := r.deleteActiveLabel(ctx, pod, qSts)
+		if isHookError(err) && skipHook {
+			_ = ctxlog.WithEvent(qSts, "DemotionHookSkipped").Errorf(ctx, "Demoting pod '%s/%s' without its pre-demotion hook, pod '%s' was elected %s ago", qSts.Namespace, pod.Name, holder, now.Sub(lease.Spec.AcquireTime.Time).Round(time.Second))
+			err = r.removeActiveLabel(ctx, pod, qSts)
+		}
+		if err != nil {
+			if isHookError(err) {
+				demoted = false
+				if demoteWithin > 0 && (requeueAfter == 0 || demoteWithin < requeueAfter) {
+					requeueAfter = demoteWithin
+				}
+				continue
+			}
+			return 0, errors.Wrapf(err, "couldn't remove label from active pod '%s/%s'", qSts.Namespace, pod.Name)
+		}
+	}
+
+	// The holder keeps the lease until the failover delay passed, but an
+	// unavailable pod doesn't keep the label
+	if active != nil && !podAvailable(active) {
+		if err := r.deleteActiveLabel(ctx, active, qSts); err != nil {
+			return 0, errors.Wrapf(err, "couldn't remove label from active pod '%s/%s'", qSts.Namespace, active.Name)
+		}
+	} else if active != nil && demoted {
+		term := strconv.Itoa(int(leaseTransitions(lease)))
+		if err := r.addActiveLabelWithTerm(ctx, active, qSts, term, e.scope); err != nil && !isHookError(err) {
+			return 0, errors.Wrapf(err, "couldn't label pod '%s/%s' as active", qSts.Namespace, active.Name)
+		}
+	}
+
+	return requeueAfter, nil
+}
+
+// addActiveLabelWithTerm labels the pod as active with the scope of the
+// election and sets the term of the lease, unless all are already up to date.
+// The pre-promotion hook only runs, if the pod isn't active yet.
+func (r *ReconcileStatefulSetActivePassive) addActiveLabelWithTerm(ctx context.Context, p *corev1.Pod, qSts *qstsv1a1.QuarksStatefulSet, term string, scope string) error {
+	_, found := p.Labels[qstsv1a1.LabelActivePod]
+	if found && p.Labels[qstsv1a1.LabelActiveScope] == scope && p.Annotations[qstsv1a1.AnnotationActiveTerm] == term {
+		return nil
+	}
+
+	if !found {
+		if err := r.runHook(ctx, qSts, p, prePromotionHook); err != nil {
+			return err
+		}
+	}
+
+	if p.Labels == nil {
+		p.Labels = map[string]string{}
+	}
+	if p.Annotations == nil {
+		p.Annotations = map[string]string{}
+	}
+	p.Labels[qstsv1a1.LabelActivePod] = "active"
+	p.Labels[qstsv1a1.LabelActiveScope] = scope
+	p.Annotations[qstsv1a1.AnnotationActiveTerm] = term
+
+	return r.updatePodLabels(ctx, p, qSts, "active")
+}
+
+func leaseTransitions(lease *coordinationv1.Lease) int32 {
+	if lease.Spec.LeaseTransitions == nil {
+		return 0
+	}
+	return *lease.Spec.LeaseTransitions
+}
+
+// zoneIndex returns the zone index of the StatefulSet
+func zoneIndex(statefulSet *appsv1.StatefulSet) int {
+	index, err := strconv.Atoi(statefulSet.Labels[qstsv1a1.LabelAZIndex])
+	if err != nil {
+		return 0
+	}
+	return index
+}
+
+// podOrdinal returns the ordinal of a StatefulSet pod from its name
+func podOrdinal(name string) int {
+	ordinal, err := strconv.Atoi(name[strings.LastIndex(name, "-")+1:])
+	if err != nil {
+		return math.MaxInt32
+	}
+	return ordinal
+}
@@ -0,0 +1,67 @@
+package quarksstatefulset
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+)
+
+// defaultHookTimeout is the timeout of hooks without TimeoutSeconds
+const defaultHookTimeout = 10 * time.Second
+
+type hookType string
+
+const (
+	prePromotionHook hookType = "pre-promotion"
+	preDemotionHook  hookType = "pre-demotion"
+)
+
+// hookError is returned, if a hook failed. The label of the pod doesn't
+// change, the hook runs again with the next reconcile.
+type hookError struct {
+	error
+}
+
+func isHookError(err error) bool {
+	_, ok := errors.Cause(err).(hookError)
+	return ok
+}
+
+// runHook runs the hook of the QuarksStatefulSet in the pod, if it's
+// configured. A failing hook is logged and reported as a warning event.
+func (r *ReconcileStatefulSetActivePassive) runHook(ctx context.Context, qSts *qstsv1a1.QuarksStatefulSet, pod *corev1.Pod, hook hookType) error {
+	hooks := qSts.Spec.ActivePassiveHooks
+	if hooks == nil {
+		return nil
+	}
+
+	handler, reason := hooks.PrePromotion, "PromotionHookFailed"
+	if hook == preDemotionHook {
+		handler, reason = hooks.PreDemotion, "DemotionHookFailed"
+	}
+	if handler == nil {
+		return nil
+	}
+
+	timeout := hookTimeout(qSts)
+	ctxlog.WithEvent(qSts, "active-passive").Debugf(ctx, "Running %s hook in pod '%s/%s'", hook, pod.Namespace, pod.Name)
+	if err := r.runHandler(ctx, pod, hooks.Container, *handler, timeout); err != nil {
+		return hookError{ctxlog.WithEvent(qSts, reason).Errorf(ctx, "%s hook failed in pod '%s/%s': %s", hook, pod.Namespace, pod.Name, err)}
+	}
+	return nil
+}
+
+// hookTimeout returns the time after which a hook of the QuarksStatefulSet
+// fails
+func hookTimeout(qSts *qstsv1a1.QuarksStatefulSet) time.Duration {
+	if hooks := qSts.Spec.ActivePassiveHooks; hooks != nil && hooks.TimeoutSeconds > 0 {
+		return time.Duration(hooks.TimeoutSeconds) * time.Second
+	}
+	return defaultHookTimeout
+}
@@ -2,8 +2,11 @@ package quarksstatefulset
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -11,23 +14,28 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
-	clientscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/retry"
 	crc "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/probe"
 	"code.cloudfoundry.org/quarks-utils/pkg/config"
 	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
 	podutil "code.cloudfoundry.org/quarks-utils/pkg/pod"
 )
 
+// maxProbeHistory limits the number of probe results in the status
+const maxProbeHistory = 10
+
 // NewActivePassiveReconciler returns a new reconcile.Reconciler for the active/passive controller
 func NewActivePassiveReconciler(ctx context.Context, config *config.Config, mgr manager.Manager, kclient kubernetes.Interface) reconcile.Reconciler {
 	return &ReconcileStatefulSetActivePassive{
@@ -37,6 +45,7 @@ func NewActivePassiveReconciler(ctx context.Context, config *config.Config, mgr
 		kclient:    kclient,
 		scheme:     mgr.GetScheme(),
 		restConfig: mgr.GetConfig(),
+		results:    newProbeResults(),
 	}
 }
 
@@ -48,12 +57,16 @@ type ReconcileStatefulSetActivePassive struct {
 	scheme     *runtime.Scheme
 	config     *config.Config
 	restConfig *rest.Config
+	results    *probeResults
 }
 
 // Reconcile manages the active labels on pods that are part of a statefulset,
 // that is managed by the QuarksStatefulSet under reconciliation. The active
-// label is based on the success of running probeCmd inside a specific
-// container.
+// label is based on the success of the probes of specific containers,
+// respecting the thresholds and initial delay of each probe. The probe
+// policy determines whether all or any of the probes have to pass.
+// With an election, only one of the pods passing the probe is labeled, see
+// elect.
 // Note:
 // Reconcile will always requeue on success after ActivePassiveProbe.PeriodSeconds have passed.
 func (r *ReconcileStatefulSetActivePassive) Reconcile(_ context.Context, request reconcile.Request) (reconcile.Result, error) {
@@ -82,15 +95,48 @@ func (r *ReconcileStatefulSetActivePassive) Reconcile(_ context.Context, request
 		return reconcile.Result{}, errors.Wrapf(err, "couldn't list StatefulSets for active/passive reconciliation")
 	}
 
-	// retrieves the ActivePassiveProbe children key,
-	// this is the container name in where the ActivePassiveProbe
-	// cmd, needs to be executed
-	containerName, err := getProbeContainerName(qSts.Spec.ActivePassiveProbes)
+	// retrieves the ActivePassiveProbe children keys,
+	// these are the container names in where the ActivePassiveProbes
+	// need to be executed
+	containers, err := getProbeContainerNames(qSts.Spec.ActivePassiveProbes)
 	if err != nil {
 		// Reconcile failed due to error - requeue
 		return reconcile.Result{}, errors.Wrapf(err, "None container name found in probe for '%s' QuarksStatefulSet", request.NamespacedName)
 	}
 
+	ps := probePeriod(qSts.Spec.ActivePassiveProbes)
+
+	if qSts.Spec.ActivePassiveElection != nil {
+		elections, err := r.elections(ctx, qSts, statefulSets)
+		if err != nil {
+			// Reconcile failed due to error - requeue
+			return reconcile.Result{}, err
+		}
+
+		pods := []corev1.Pod{}
+		for _, e := range elections {
+			candidates := r.probePods(ctx, containers, e.pods, qSts)
+			failoverAfter, err := r.elect(ctx, qSts, e, candidates)
+			if err != nil {
+				// Reconcile failed due to error - requeue
+				return reconcile.Result{}, err
+			}
+			if failoverAfter > 0 && failoverAfter < ps {
+				ps = failoverAfter
+			}
+			pods = append(pods, e.pods...)
+		}
+
+		if err := r.updateActivePassiveStatus(ctx, qSts, pods); err != nil {
+			// Reconcile failed due to error - requeue
+			return reconcile.Result{}, err
+		}
+
+		ctxlog.WithEvent(qSts, "active-passive").Debugf(ctx, "Requeue election for '%s' in %s", request.NamespacedName, ps)
+		return reconcile.Result{RequeueAfter: ps}, nil
+	}
+
+	pods := []corev1.Pod{}
 	for _, statefulSet := range statefulSets {
 		ownedPods, err := r.getStsPodList(ctx, statefulSet)
 		if err != nil {
@@ -98,16 +144,17 @@ func (r *ReconcileStatefulSetActivePassive) Reconcile(_ context.Context, request
 			return reconcile.Result{}, errors.Wrapf(err, "couldn't retrieve pod items from sts: '%s/%s'", statefulSet.Namespace, statefulSet.Name)
 		}
 
-		err = r.markActiveContainers(ctx, containerName, ownedPods, qSts)
+		err = r.markActiveContainers(ctx, containers, ownedPods, qSts)
 		if err != nil {
 			// Reconcile failed due to error - requeue
 			return reconcile.Result{}, err
 		}
+		pods = append(pods, ownedPods.Items...)
 	}
 
-	ps := time.Second * time.Duration(qSts.Spec.ActivePassiveProbes[containerName].PeriodSeconds)
-	if ps == (time.Second * time.Duration(0)) {
-		ps = time.Second * 30
+	if err := r.updateActivePassiveStatus(ctx, qSts, pods); err != nil {
+		// Reconcile failed due to error - requeue
+		return reconcile.Result{}, err
 	}
 
 	// Reconcile for any reason than error after the ActivePassiveProbe PeriodSeconds
@@ -115,35 +162,124 @@ func (r *ReconcileStatefulSetActivePassive) Reconcile(_ context.Context, request
 	return reconcile.Result{RequeueAfter: ps}, nil
 }
 
-func (r *ReconcileStatefulSetActivePassive) markActiveContainers(ctx context.Context, container string, pods *corev1.PodList, qSts *qstsv1a1.QuarksStatefulSet) (err error) {
-	probeCmd := qSts.Spec.ActivePassiveProbes[container].Exec.Command
-
-	for _, pod := range pods.Items {
-		ctxlog.WithEvent(qSts, "active-passive").Debugf(ctx, "validating probe in pod: '%s/%s'", qSts.Namespace, pod.Name)
-		if err := r.execContainerCmd(&pod, container, probeCmd); err != nil {
-			ctxlog.WithEvent(qSts, "active-passive").Debugf(
-				ctx,
-				"failed to execute active/passive probe: %s",
-				err,
-			)
+func (r *ReconcileStatefulSetActivePassive) markActiveContainers(ctx context.Context, containers []string, pods *corev1.PodList, qSts *qstsv1a1.QuarksStatefulSet) (err error) {
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		// unready and terminating pods are passive, even if they pass
+		// the probe
+		if !r.probePasses(ctx, pod, containers, qSts) || !podAvailable(pod) {
 			// mark as passive
-			err := r.deleteActiveLabel(ctx, &pod, qSts)
-			if err != nil {
+			err := r.deleteActiveLabel(ctx, pod, qSts)
+			if err != nil && !isHookError(err) {
 				return errors.Wrapf(err, "couldn't remove label from active pod '%s/%s'", qSts.Namespace, pod.Name)
 			}
 		} else {
-			if podutil.IsPodReady(&pod) {
-				// mark as active
-				err := r.addActiveLabel(ctx, &pod, qSts)
-				if err != nil {
-					return errors.Wrapf(err, "couldn't label pod '%s/%s' as active", qSts.Namespace, pod.Name)
-				}
+			// mark as active
+			err := r.addActiveLabel(ctx, pod, qSts)
+			if err != nil && !isHookError(err) {
+				return errors.Wrapf(err, "couldn't label pod '%s/%s' as active", qSts.Namespace, pod.Name)
 			}
 		}
 	}
 	return nil
 }
 
+// probePods returns the available pods, which pass the probe
+func (r *ReconcileStatefulSetActivePassive) probePods(ctx context.Context, containers []string, pods []corev1.Pod, qSts *qstsv1a1.QuarksStatefulSet) map[string]bool {
+	candidates := map[string]bool{}
+	for i := range pods {
+		pod := &pods[i]
+		if !podAvailable(pod) {
+			continue
+		}
+		if r.probePasses(ctx, pod, containers, qSts) {
+			candidates[pod.Name] = true
+		}
+	}
+	return candidates
+}
+
+// probePasses probes the containers of the pod and returns whether the pod
+// passes. Depending on the probe policy, the probes of all containers or of
+// any container have to pass. Every probe is run, so their thresholds keep
+// counting.
+func (r *ReconcileStatefulSetActivePassive) probePasses(ctx context.Context, pod *corev1.Pod, containers []string, qSts *qstsv1a1.QuarksStatefulSet) bool {
+	anyPasses := qSts.Spec.ActivePassiveProbePolicy == qstsv1a1.ActivePassiveProbeAny
+
+	passes := !anyPasses
+	for _, container := range containers {
+		containerPasses := r.containerPasses(ctx, pod, container, qSts)
+		if anyPasses {
+			passes = passes || containerPasses
+		} else {
+			passes = passes && containerPasses
+		}
+	}
+	return passes
+}
+
+// containerPasses probes the container and returns whether it passes, once
+// the thresholds of the probe are reached. During the initial delay of the
+// probe, the container is not probed and keeps its result.
+func (r *ReconcileStatefulSetActivePassive) containerPasses(ctx context.Context, pod *corev1.Pod, container string, qSts *qstsv1a1.QuarksStatefulSet) bool {
+	p := qSts.Spec.ActivePassiveProbes[container]
+	if inInitialDelay(pod, container, p) {
+		ctxlog.Debugf(ctx, "Skipping active/passive probe of container '%s' in pod '%s/%s' during its initial delay", container, pod.Namespace, pod.Name)
+		return r.results.passing(qSts, pod, container)
+	}
+
+	err := r.probePod(ctx, pod, container, qSts)
+	passing, changed := r.results.record(qSts, pod, container, p, err)
+	if changed && !passing {
+		ctxlog.WarningEvent(ctx, qSts, "ProbeFailed", fmt.Sprintf("Active/passive probe of container '%s' in pod '%s/%s' failed: %s", container, pod.Namespace, pod.Name, err))
+	}
+	return passing
+}
+
+// probePod runs the handler of the container's probe. Network handlers
+// connect to the pod IP from the operator, only exec probes run in the
+// container.
+func (r *ReconcileStatefulSetActivePassive) probePod(ctx context.Context, pod *corev1.Pod, container string, qSts *qstsv1a1.QuarksStatefulSet) error {
+	ctxlog.WithEvent(qSts, "active-passive").Debugf(ctx, "validating probe in pod: '%s/%s'", qSts.Namespace, pod.Name)
+
+	p := qSts.Spec.ActivePassiveProbes[container]
+	timeout := probe.Timeout(p)
+
+	var err error
+	if grpc, ok := qSts.Spec.ActivePassiveGRPCProbes[container]; ok {
+		service := ""
+		if grpc.Service != nil {
+			service = *grpc.Service
+		}
+		err = probe.GRPC(ctx, pod, grpc.Port, service, timeout)
+	} else {
+		err = r.runHandler(ctx, pod, container, p.Handler, timeout)
+	}
+
+	if err != nil {
+		ctxlog.WithEvent(qSts, "active-passive").Debugf(
+			ctx,
+			"failed to execute active/passive probe: %s",
+			err,
+		)
+	}
+	return err
+}
+
+// runHandler runs the httpGet, tcpSocket or exec handler of a probe or hook
+// for the container of the pod
+func (r *ReconcileStatefulSetActivePassive) runHandler(ctx context.Context, pod *corev1.Pod, container string, handler corev1.Handler, timeout time.Duration) error {
+	switch {
+	case handler.HTTPGet != nil:
+		return probe.HTTPGet(ctx, pod, container, handler.HTTPGet, timeout)
+	case handler.TCPSocket != nil:
+		return probe.TCPSocket(ctx, pod, container, handler.TCPSocket, timeout)
+	case handler.Exec != nil:
+		return r.execContainerCmd(ctx, pod, container, handler.Exec.Command, timeout)
+	}
+	return errors.Errorf("no handler for container '%s'", container)
+}
+
 func (r *ReconcileStatefulSetActivePassive) addActiveLabel(ctx context.Context, p *corev1.Pod, qSts *qstsv1a1.QuarksStatefulSet) error {
 	podLabels := p.GetLabels()
 	if podLabels == nil {
@@ -154,7 +290,12 @@ func (r *ReconcileStatefulSetActivePassive) addActiveLabel(ctx context.Context,
 		return nil
 	}
 
+	if err := r.runHook(ctx, qSts, p, prePromotionHook); err != nil {
+		return err
+	}
+
 	podLabels[qstsv1a1.LabelActivePod] = "active"
+	p.Labels = podLabels
 
 	return r.updatePodLabels(ctx, p, qSts, "active")
 }
@@ -165,7 +306,24 @@ func (r *ReconcileStatefulSetActivePassive) deleteActiveLabel(ctx context.Contex
 	if _, found := podLabels[qstsv1a1.LabelActivePod]; !found {
 		return nil
 	}
+
+	// Hooks can't run in unavailable pods, e.g. a crashed primary, which
+	// would prevent the failover
+	if podAvailable(p) {
+		if err := r.runHook(ctx, qSts, p, preDemotionHook); err != nil {
+			return err
+		}
+	}
+
+	return r.removeActiveLabel(ctx, p, qSts)
+}
+
+// removeActiveLabel demotes the pod without running the pre-demotion hook
+func (r *ReconcileStatefulSetActivePassive) removeActiveLabel(ctx context.Context, p *corev1.Pod, qSts *qstsv1a1.QuarksStatefulSet) error {
+	podLabels := p.GetLabels()
 	delete(podLabels, qstsv1a1.LabelActivePod)
+	delete(podLabels, qstsv1a1.LabelActiveScope)
+	delete(p.Annotations, qstsv1a1.AnnotationActiveTerm)
 
 	return r.updatePodLabels(ctx, p, qSts, "passive")
 }
@@ -176,41 +334,65 @@ func (r *ReconcileStatefulSetActivePassive) updatePodLabels(ctx context.Context,
 		return err
 	}
 
-	ctxlog.WithEvent(qSts, "active-passive").Debugf(
-		ctx,
-		"pod %s promoted to %s",
-		p.Name,
-		mode,
-	)
+	if mode == "active" {
+		ctxlog.WithEvent(qSts, "Promoted").Infof(ctx, "Promoted pod '%s/%s' to active", p.Namespace, p.Name)
+	} else {
+		ctxlog.WithEvent(qSts, "Demoted").Infof(ctx, "Demoted pod '%s/%s' to passive", p.Namespace, p.Name)
+	}
 	return nil
 }
 
-func (r *ReconcileStatefulSetActivePassive) execContainerCmd(pod *corev1.Pod, container string, command []string) error {
-	req := r.kclient.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(pod.Name).
-		Namespace(pod.Namespace).
-		SubResource("exec").
-		VersionedParams(&corev1.PodExecOptions{
-			Container: container,
-			Command:   command,
-			Stdin:     true,
-			Stdout:    true,
-			Stderr:    false,
-		}, clientscheme.ParameterCodec)
-
-	executor, err := remotecommand.NewSPDYExecutor(r.restConfig, "POST", req.URL())
-	if err != nil {
-		return errors.New("failed to initialize remote command executor")
+// updateActivePassiveStatus sets the active pods in the status and appends
+// the changes of the probe results to the probe history. It also forgets
+// the probe results of pods, which are gone.
+func (r *ReconcileStatefulSetActivePassive) updateActivePassiveStatus(ctx context.Context, qSts *qstsv1a1.QuarksStatefulSet, pods []corev1.Pod) error {
+	seen := map[types.UID]bool{}
+	active := []string{}
+	for _, pod := range pods {
+		seen[pod.UID] = true
+		if _, ok := pod.Labels[qstsv1a1.LabelActivePod]; ok {
+			active = append(active, pod.Name)
+		}
 	}
-	if err = executor.Stream(remotecommand.StreamOptions{Stdin: os.Stdin, Stdout: os.Stdout, Tty: false}); err != nil {
-		return errors.Wrapf(err, "failed executing command in pod: '%s/%s', container: %s",
-			pod.Namespace,
-			pod.Name,
-			container,
-		)
+	sort.Strings(active)
+	r.results.prune(qSts, seen)
+	changes := r.results.takeChanges(qSts)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &qstsv1a1.QuarksStatefulSet{}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: qSts.Name, Namespace: qSts.Namespace}, latest); err != nil {
+			return err
+		}
+
+		status := &latest.Status
+		activeChanged := strings.Join(status.ActivePods, ",") != strings.Join(active, ",")
+		if !activeChanged && len(changes) == 0 {
+			return nil
+		}
+
+		if activeChanged {
+			status.ActivePods = active
+			now := metav1.Now()
+			status.LastActiveTransitionTime = &now
+		}
+		status.ProbeHistory = append(status.ProbeHistory, changes...)
+		if len(status.ProbeHistory) > maxProbeHistory {
+			status.ProbeHistory = status.ProbeHistory[len(status.ProbeHistory)-maxProbeHistory:]
+		}
+		return r.client.Status().Update(ctx, latest)
+	})
+	return errors.Wrapf(err, "couldn't update the active pods in the status of '%s/%s'", qSts.Namespace, qSts.Name)
+}
+
+// execContainerCmd runs the command of an exec probe in the container, see
+// probe.Exec
+func (r *ReconcileStatefulSetActivePassive) execContainerCmd(ctx context.Context, pod *corev1.Pod, container string, command []string, timeout time.Duration) error {
+	stdout, err := probe.Exec(ctx, r.kclient, r.restConfig, pod, container, command, timeout)
+	if err != nil {
+		return err
 	}
 
+	ctxlog.Debugf(ctx, "Active/passive probe of container '%s' in pod '%s/%s' succeeded: %s", container, pod.Namespace, pod.Name, stdout)
 	return nil
 }
 
@@ -228,11 +410,38 @@ func (r *ReconcileStatefulSetActivePassive) getStsPodList(ctx context.Context, d
 	return podList, nil
 }
 
-func getProbeContainerName(p map[string]corev1.Probe) (string, error) {
+// podAvailable returns true, if the pod is ready and not terminating
+func podAvailable(pod *corev1.Pod) bool {
+	return podutil.IsPodReady(pod) && pod.DeletionTimestamp == nil
+}
+
+// getProbeContainerNames returns the containers of the probes in a stable
+// order
+func getProbeContainerNames(p map[string]corev1.Probe) ([]string, error) {
+	containers := make([]string, 0, len(p))
 	for key := range p {
-		return key, nil
+		containers = append(containers, key)
+	}
+	if len(containers) == 0 {
+		return nil, errors.New("failed to find a container key in the active/passive probe in the current QuarksStatefulSet")
+	}
+	sort.Strings(containers)
+	return containers, nil
+}
+
+// probePeriod returns the shortest period of the probes, by default 30s
+func probePeriod(p map[string]corev1.Probe) time.Duration {
+	period := time.Duration(0)
+	for _, probe := range p {
+		ps := time.Second * time.Duration(probe.PeriodSeconds)
+		if ps > 0 && (period == 0 || ps < period) {
+			period = ps
+		}
+	}
+	if period == 0 {
+		period = time.Second * 30
 	}
-	return "", errors.New("failed to find a container key in the active/passive probe in the current QuarksStatefulSet")
+	return period
 }
 
 // KubeConfig returns a kube config for this environment
@@ -0,0 +1,506 @@
+package quarksstatefulset_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/scheme"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers"
+	cfakes "code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/fakes"
+	qstscontroller "code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/quarksstatefulset"
+	cfcfg "code.cloudfoundry.org/quarks-utils/pkg/config"
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+	"code.cloudfoundry.org/quarks-utils/pkg/names"
+	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
+	helper "code.cloudfoundry.org/quarks-utils/testing/testhelper"
+)
+
+var _ = Describe("ReconcileStatefulSetActivePassive", func() {
+	var (
+		manager    *cfakes.FakeManager
+		reconciler reconcile.Reconciler
+		request    reconcile.Request
+		ctx        context.Context
+		logs       *observer.ObservedLogs
+		client     crc.Client
+		server     *httptest.Server
+		healthy    map[string]bool
+		portNumber int
+		qsts       *qstsv1a1.QuarksStatefulSet
+		pod        *corev1.Pod
+		zone       string
+	)
+
+	BeforeEach(func() {
+		Expect(controllers.AddToScheme(scheme.Scheme)).To(Succeed())
+		manager = &cfakes.FakeManager{}
+		manager.GetSchemeReturns(scheme.Scheme)
+
+		request = reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "default"}}
+		var log *zap.SugaredLogger
+		logs, log = helper.NewTestLogger()
+		ctx = ctxlog.NewParentContext(log)
+
+		healthy = map[string]bool{"/primary": true, "/sidecar": true}
+		zone = ""
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !healthy[r.URL.Path] {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		portNumber, err = strconv.Atoi(port)
+		Expect(err).ToNot(HaveOccurred())
+
+		qsts = &qstsv1a1.QuarksStatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo-uid"},
+			Spec: qstsv1a1.QuarksStatefulSetSpec{
+				ActivePassiveProbes: map[string]corev1.Probe{
+					"db": {
+						Handler: corev1.Handler{
+							HTTPGet: &corev1.HTTPGetAction{Path: "/primary", Port: intstr.FromInt(portNumber)},
+						},
+						PeriodSeconds:    5,
+						SuccessThreshold: 2,
+						FailureThreshold: 2,
+					},
+				},
+			},
+		}
+
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo-0",
+				Namespace: "default",
+				UID:       "foo-0-uid",
+				Labels:    map[string]string{qstsv1a1.LabelQStsName: "foo"},
+			},
+			Status: corev1.PodStatus{
+				PodIP:      "127.0.0.1",
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	JustBeforeEach(func() {
+		statefulSet := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        qsts.Name,
+				Namespace:   "default",
+				Annotations: map[string]string{qstsv1a1.AnnotationVersion: "1"},
+			},
+		}
+		if zone != "" {
+			statefulSet.Labels = map[string]string{qstsv1a1.LabelAZName: zone}
+		}
+		Expect(controllerutil.SetControllerReference(qsts, statefulSet, scheme.Scheme)).To(Succeed())
+
+		client = fake.NewClientBuilder().WithObjects(qsts, statefulSet, pod).Build()
+		manager.GetClientReturns(client)
+		reconciler = qstscontroller.NewActivePassiveReconciler(ctx, &cfcfg.Config{CtxTimeOut: 10 * time.Second}, manager, nil)
+	})
+
+	reconcileAndGetPod := func() *corev1.Pod {
+		result, err := reconciler.Reconcile(context.Background(), request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(5 * time.Second))
+
+		p := &corev1.Pod{}
+		Expect(client.Get(context.Background(), types.NamespacedName{Name: pod.Name, Namespace: "default"}, p)).To(Succeed())
+		return p
+	}
+
+	It("labels the pod as active after the success threshold", func() {
+		Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+		Expect(reconcileAndGetPod().Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+	})
+
+	It("resets the successes after a failure", func() {
+		Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+		healthy["/primary"] = false
+		Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+		healthy["/primary"] = true
+		Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+		Expect(reconcileAndGetPod().Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+	})
+
+	It("reports the active pods and probe results in the status", func() {
+		reconcileAndGetPod()
+		reconcileAndGetPod()
+		Expect(logs.FilterMessageSnippet("Promoted pod 'default/foo-0' to active").Len()).To(Equal(1))
+
+		healthy["/primary"] = false
+		reconcileAndGetPod()
+		reconcileAndGetPod()
+		Expect(logs.FilterMessageSnippet("Demoted pod 'default/foo-0' to passive").Len()).To(Equal(1))
+
+		result := &qstsv1a1.QuarksStatefulSet{}
+		Expect(client.Get(context.Background(), request.NamespacedName, result)).To(Succeed())
+		Expect(result.Status.ActivePods).To(BeEmpty())
+		Expect(result.Status.LastActiveTransitionTime).ToNot(BeNil())
+		Expect(result.Status.ProbeHistory).To(HaveLen(2))
+		Expect(result.Status.ProbeHistory[0].Passing).To(BeTrue())
+		Expect(result.Status.ProbeHistory[1].Container).To(Equal("db"))
+		Expect(result.Status.ProbeHistory[1].Passing).To(BeFalse())
+		Expect(result.Status.ProbeHistory[1].Message).To(ContainSubstring("returned status 503"))
+	})
+
+	It("sets the active pods in the status", func() {
+		reconcileAndGetPod()
+		reconcileAndGetPod()
+
+		result := &qstsv1a1.QuarksStatefulSet{}
+		Expect(client.Get(context.Background(), request.NamespacedName, result)).To(Succeed())
+		Expect(result.Status.ActivePods).To(ConsistOf("foo-0"))
+	})
+
+	Context("when the pod is active", func() {
+		BeforeEach(func() {
+			pod.Labels[qstsv1a1.LabelActivePod] = "active"
+			healthy["/primary"] = false
+		})
+
+		It("removes the label after the failure threshold", func() {
+			Expect(reconcileAndGetPod().Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+			Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+		})
+	})
+
+	Context("when the active pod is not ready", func() {
+		BeforeEach(func() {
+			pod.Labels[qstsv1a1.LabelActivePod] = "active"
+			pod.Status.Conditions[0].Status = corev1.ConditionFalse
+		})
+
+		It("removes the label, although the probe passes", func() {
+			Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+			Expect(logs.FilterMessageSnippet("Demoted pod 'default/foo-0' to passive").Len()).To(Equal(1))
+		})
+	})
+
+	Context("with probes in several containers", func() {
+		BeforeEach(func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{
+				"db": {
+					Handler:       corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/primary", Port: intstr.FromInt(portNumber)}},
+					PeriodSeconds: 10,
+				},
+				"sidecar": {
+					Handler:       corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/sidecar", Port: intstr.FromInt(portNumber)}},
+					PeriodSeconds: 5,
+				},
+			}
+			healthy["/sidecar"] = false
+		})
+
+		It("requires all probes to pass", func() {
+			Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+			healthy["/sidecar"] = true
+			Expect(reconcileAndGetPod().Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+		})
+
+		Context("when any probe may pass", func() {
+			BeforeEach(func() {
+				qsts.Spec.ActivePassiveProbePolicy = qstsv1a1.ActivePassiveProbeAny
+			})
+
+			It("requires one probe to pass", func() {
+				Expect(reconcileAndGetPod().Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+				healthy["/primary"] = false
+				Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+			})
+		})
+	})
+
+	Context("with hooks", func() {
+		BeforeEach(func() {
+			probe := qsts.Spec.ActivePassiveProbes["db"]
+			probe.SuccessThreshold = 0
+			probe.FailureThreshold = 0
+			qsts.Spec.ActivePassiveProbes["db"] = probe
+			qsts.Spec.ActivePassiveHooks = &qstsv1a1.ActivePassiveHooks{
+				Container:    "db",
+				PrePromotion: &corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/promote", Port: intstr.FromInt(portNumber)}},
+				PreDemotion:  &corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/demote", Port: intstr.FromInt(portNumber)}},
+			}
+		})
+
+		It("labels the pod once the pre-promotion hook succeeds", func() {
+			Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+			Expect(logs.FilterMessageSnippet("pre-promotion hook failed in pod 'default/foo-0'").Len()).To(Equal(1))
+
+			healthy["/promote"] = true
+			Expect(reconcileAndGetPod().Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+		})
+
+		Context("when the pod is active", func() {
+			BeforeEach(func() {
+				pod.Labels[qstsv1a1.LabelActivePod] = "active"
+				healthy["/primary"] = false
+			})
+
+			It("removes the label once the pre-demotion hook succeeds", func() {
+				Expect(reconcileAndGetPod().Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+				Expect(logs.FilterMessageSnippet("pre-demotion hook failed in pod 'default/foo-0'").Len()).To(Equal(1))
+
+				healthy["/demote"] = true
+				Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+			})
+
+			It("doesn't run the pre-demotion hook in an unready pod", func() {
+				p := &corev1.Pod{}
+				Expect(client.Get(context.Background(), types.NamespacedName{Name: "foo-0", Namespace: "default"}, p)).To(Succeed())
+				p.Status.Conditions[0].Status = corev1.ConditionFalse
+				Expect(client.Update(context.Background(), p)).To(Succeed())
+
+				Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+				Expect(logs.FilterMessageSnippet("pre-demotion hook").Len()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("with an election", func() {
+		BeforeEach(func() {
+			qsts.Spec.ActivePassiveElection = &qstsv1a1.ActivePassiveElectionSpec{}
+		})
+
+		It("labels the elected pod with the name of the QuarksStatefulSet as scope", func() {
+			reconcileAndGetPod()
+			p := reconcileAndGetPod()
+			Expect(p.Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+			Expect(p.Labels).To(HaveKeyWithValue(qstsv1a1.LabelActiveScope, "foo"))
+
+			lease := &coordinationv1.Lease{}
+			Expect(client.Get(context.Background(), types.NamespacedName{Name: "foo-active", Namespace: "default"}, lease)).To(Succeed())
+			Expect(*lease.Spec.HolderIdentity).To(Equal("foo-0"))
+		})
+
+		Context("when the pre-demotion hook of the old active pod keeps failing", func() {
+			var acquired time.Time
+
+			BeforeEach(func() {
+				qsts.Spec.ActivePassiveElection.FailoverDelay = &metav1.Duration{Duration: 30 * time.Second}
+				qsts.Spec.ActivePassiveHooks = &qstsv1a1.ActivePassiveHooks{
+					Container:   "db",
+					PreDemotion: &corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/demote", Port: intstr.FromInt(portNumber)}},
+				}
+				pod.Labels[qstsv1a1.LabelActivePod] = "active"
+				acquired = time.Now()
+			})
+
+			JustBeforeEach(func() {
+				now := metav1.NewMicroTime(time.Now())
+				Expect(client.Create(context.Background(), &coordinationv1.Lease{
+					ObjectMeta: metav1.ObjectMeta{Name: "foo-active", Namespace: "default"},
+					Spec: coordinationv1.LeaseSpec{
+						HolderIdentity: pointers.String("foo-1"),
+						AcquireTime:    &metav1.MicroTime{Time: acquired},
+						RenewTime:      &now,
+					},
+				})).To(Succeed())
+			})
+
+			It("keeps the label until the failover delay passed", func() {
+				Expect(reconcileAndGetPod().Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+				Expect(logs.FilterMessageSnippet("pre-demotion hook failed in pod 'default/foo-0'").Len()).To(Equal(1))
+			})
+
+			Context("when the failover delay passed since the election", func() {
+				BeforeEach(func() {
+					acquired = time.Now().Add(-time.Minute)
+				})
+
+				It("removes the label without the hook", func() {
+					p := reconcileAndGetPod()
+					Expect(p.Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+					Expect(p.Labels).ToNot(HaveKey(qstsv1a1.LabelActiveScope))
+					Expect(logs.FilterMessageSnippet("Demoting pod 'default/foo-0' without its pre-demotion hook, pod 'foo-1' was elected 1m0s ago").Len()).To(Equal(1))
+				})
+			})
+		})
+
+		Context("when the scope is per zone", func() {
+			BeforeEach(func() {
+				qsts.Spec.ActivePassiveElection.Scope = qstsv1a1.ActivePassiveElectionPerZone
+				zone = "z1"
+			})
+
+			It("labels the elected pod with the zone as scope", func() {
+				reconcileAndGetPod()
+				Expect(reconcileAndGetPod().Labels).To(HaveKeyWithValue(qstsv1a1.LabelActiveScope, "z1"))
+			})
+
+			It("removes the scope label with the active label", func() {
+				reconcileAndGetPod()
+				reconcileAndGetPod()
+				healthy["/primary"] = false
+				reconcileAndGetPod()
+				p := reconcileAndGetPod()
+				Expect(p.Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+				Expect(p.Labels).ToNot(HaveKey(qstsv1a1.LabelActiveScope))
+			})
+		})
+
+		Context("when the scope is per StatefulSet", func() {
+			BeforeEach(func() {
+				qsts.Spec.ActivePassiveElection.Scope = qstsv1a1.ActivePassiveElectionPerStatefulSet
+				zone = "z1"
+			})
+
+			It("labels the elected pod with the StatefulSet as scope", func() {
+				reconcileAndGetPod()
+				Expect(reconcileAndGetPod().Labels).To(HaveKeyWithValue(qstsv1a1.LabelActiveScope, "foo"))
+			})
+		})
+
+		Context("when the name of the QuarksStatefulSet is longer than a label value", func() {
+			var name string
+
+			BeforeEach(func() {
+				name = strings.Repeat("a", 70)
+				qsts.Name = name
+				pod.Name = name + "-0"
+				pod.Labels[qstsv1a1.LabelQStsName] = name
+				request.Name = name
+			})
+
+			It("labels the elected pod with a shortened scope and uses the full name for the lease", func() {
+				reconcileAndGetPod()
+				p := reconcileAndGetPod()
+				Expect(p.Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+				Expect(p.Labels).To(HaveKeyWithValue(qstsv1a1.LabelActiveScope, names.TruncateMD5(name, validation.LabelValueMaxLength)))
+				Expect(len(p.Labels[qstsv1a1.LabelActiveScope])).To(BeNumerically("<=", validation.LabelValueMaxLength))
+
+				lease := &coordinationv1.Lease{}
+				Expect(client.Get(context.Background(), types.NamespacedName{Name: name + "-active", Namespace: "default"}, lease)).To(Succeed())
+				Expect(*lease.Spec.HolderIdentity).To(Equal(name + "-0"))
+			})
+		})
+	})
+
+	Context("when the thresholds are not set", func() {
+		BeforeEach(func() {
+			probe := qsts.Spec.ActivePassiveProbes["db"]
+			probe.SuccessThreshold = 0
+			probe.FailureThreshold = 0
+			qsts.Spec.ActivePassiveProbes["db"] = probe
+		})
+
+		It("changes the label on a single result", func() {
+			Expect(reconcileAndGetPod().Labels).To(HaveKey(qstsv1a1.LabelActivePod))
+			healthy["/primary"] = false
+			Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+		})
+	})
+
+	Context("when the container started within the initial delay", func() {
+		BeforeEach(func() {
+			probe := qsts.Spec.ActivePassiveProbes["db"]
+			probe.InitialDelaySeconds = 60
+			qsts.Spec.ActivePassiveProbes["db"] = probe
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  "db",
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.Now()}},
+			}}
+		})
+
+		It("does not probe the pod", func() {
+			Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+			Expect(reconcileAndGetPod().Labels).ToNot(HaveKey(qstsv1a1.LabelActivePod))
+		})
+	})
+})
+
+var _ = Describe("ActivePassivePodReconciles", func() {
+	var (
+		ctx    context.Context
+		client crc.Client
+		qsts   *qstsv1a1.QuarksStatefulSet
+		pod    *corev1.Pod
+	)
+
+	BeforeEach(func() {
+		Expect(controllers.AddToScheme(scheme.Scheme)).To(Succeed())
+		_, log := helper.NewTestLogger()
+		ctx = ctxlog.NewParentContext(log)
+
+		qsts = &qstsv1a1.QuarksStatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+			Spec: qstsv1a1.QuarksStatefulSetSpec{
+				ActivePassiveProbes: map[string]corev1.Probe{"db": {}},
+			},
+		}
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo-0",
+				Namespace: "default",
+				Labels:    map[string]string{qstsv1a1.LabelQStsName: "foo"},
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(qsts).Build()
+	})
+
+	It("maps the pod to its QuarksStatefulSet", func() {
+		Expect(qstscontroller.ActivePassivePodReconciles(ctx, client, pod)).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "default"}},
+		))
+	})
+
+	When("the QuarksStatefulSet has zones", func() {
+		BeforeEach(func() {
+			qsts.Spec.Zones = []string{"z1", "z2"}
+			pod.Name = "foo-z1-0"
+			pod.Labels = map[string]string{
+				qstsv1a1.LabelQStsName:          "foo-z1",
+				qstsv1a1.LabelQuarksStatefulSet: "foo",
+			}
+		})
+
+		It("maps the pod to its QuarksStatefulSet instead of its StatefulSet", func() {
+			Expect(qstscontroller.ActivePassivePodReconciles(ctx, client, pod)).To(ConsistOf(
+				reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "default"}},
+			))
+		})
+	})
+
+	When("the QuarksStatefulSet is not active/passive", func() {
+		BeforeEach(func() {
+			qsts.Spec.ActivePassiveProbes = nil
+		})
+
+		It("ignores the pod", func() {
+			Expect(qstscontroller.ActivePassivePodReconciles(ctx, client, pod)).To(BeEmpty())
+		})
+	})
+})
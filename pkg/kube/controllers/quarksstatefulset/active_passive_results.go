@@ -0,0 +1,169 @@
+package quarksstatefulset
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+)
+
+// maxProbeMessage limits the length of the error of a failing probe in the
+// probe history
+const maxProbeMessage = 256
+
+// probeResults counts the consecutive results of the active/passive probes
+// by pod UID and container, so a single result doesn't change the label of
+// a pod. The counters are kept in memory. After a restart of the operator,
+// the label of a pod determines whether it passes, until the thresholds are
+// reached again.
+type probeResults struct {
+	sync.Mutex
+	pods map[probeKey]*probeResult
+	// changes of the results by QuarksStatefulSet, which are not in its
+	// status yet
+	changes map[types.NamespacedName][]qstsv1a1.ProbeResult
+}
+
+type probeKey struct {
+	uid       types.UID
+	container string
+}
+
+type probeResult struct {
+	// owner is the QuarksStatefulSet of the pod
+	owner     types.NamespacedName
+	passing   bool
+	successes int32
+	failures  int32
+}
+
+func newProbeResults() *probeResults {
+	return &probeResults{
+		pods:    map[probeKey]*probeResult{},
+		changes: map[types.NamespacedName][]qstsv1a1.ProbeResult{},
+	}
+}
+
+// record adds the result of the container's probe and returns whether the
+// probe passes and whether that changed. A failing probe passes after
+// SuccessThreshold consecutive successes, a passing probe fails after
+// FailureThreshold consecutive failures. Both default to one.
+func (r *probeResults) record(qSts *qstsv1a1.QuarksStatefulSet, pod *corev1.Pod, container string, probe corev1.Probe, err error) (bool, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	result := r.result(qSts, pod, container)
+	passing := result.passing
+	if err == nil {
+		result.successes++
+		result.failures = 0
+		if !result.passing && result.successes >= threshold(probe.SuccessThreshold) {
+			result.passing = true
+		}
+	} else {
+		result.failures++
+		result.successes = 0
+		if result.passing && result.failures >= threshold(probe.FailureThreshold) {
+			result.passing = false
+		}
+	}
+
+	changed := result.passing != passing
+	if changed {
+		change := qstsv1a1.ProbeResult{
+			Time:      metav1.Now(),
+			Pod:       pod.Name,
+			Container: container,
+			Passing:   result.passing,
+		}
+		if err != nil {
+			change.Message = truncate(err.Error(), maxProbeMessage)
+		}
+		r.changes[result.owner] = append(r.changes[result.owner], change)
+	}
+	return result.passing, changed
+}
+
+// passing returns whether the container's probe passes, without adding a
+// result
+func (r *probeResults) passing(qSts *qstsv1a1.QuarksStatefulSet, pod *corev1.Pod, container string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.result(qSts, pod, container).passing
+}
+
+// takeChanges returns the changes of the results of the pods of the
+// QuarksStatefulSet since the last call
+func (r *probeResults) takeChanges(qSts *qstsv1a1.QuarksStatefulSet) []qstsv1a1.ProbeResult {
+	r.Lock()
+	defer r.Unlock()
+
+	owner := types.NamespacedName{Name: qSts.Name, Namespace: qSts.Namespace}
+	changes := r.changes[owner]
+	delete(r.changes, owner)
+	return changes
+}
+
+// prune removes the results of the pods of the QuarksStatefulSet, which
+// were not seen, e.g. because they were deleted
+func (r *probeResults) prune(qSts *qstsv1a1.QuarksStatefulSet, seen map[types.UID]bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	owner := types.NamespacedName{Name: qSts.Name, Namespace: qSts.Namespace}
+	for key, result := range r.pods {
+		if result.owner == owner && !seen[key.uid] {
+			delete(r.pods, key)
+		}
+	}
+}
+
+func (r *probeResults) result(qSts *qstsv1a1.QuarksStatefulSet, pod *corev1.Pod, container string) *probeResult {
+	key := probeKey{uid: pod.UID, container: container}
+	result, ok := r.pods[key]
+	if !ok {
+		_, active := pod.Labels[qstsv1a1.LabelActivePod]
+		result = &probeResult{
+			owner:   types.NamespacedName{Name: qSts.Name, Namespace: qSts.Namespace},
+			passing: active,
+		}
+		r.pods[key] = result
+	}
+	return result
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
+
+func threshold(t int32) int32 {
+	if t < 1 {
+		return 1
+	}
+	return t
+}
+
+// inInitialDelay returns true, if the container is running for less than
+// the InitialDelaySeconds of the probe
+func inInitialDelay(pod *corev1.Pod, container string, probe corev1.Probe) bool {
+	if probe.InitialDelaySeconds <= 0 {
+		return false
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != container || status.State.Running == nil {
+			continue
+		}
+		delay := time.Duration(probe.InitialDelaySeconds) * time.Second
+		return time.Since(status.State.Running.StartedAt.Time) < delay
+	}
+	return false
+}
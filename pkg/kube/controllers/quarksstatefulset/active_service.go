@@ -0,0 +1,119 @@
+package quarksstatefulset
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+)
+
+// activeServiceName returns the name of the Service selecting the active pod
+func activeServiceName(qStatefulSet *qstsv1a1.QuarksStatefulSet) string {
+	return qStatefulSet.Name + "-active"
+}
+
+// reconcileActiveService creates or updates the Service, which selects the
+// active pod of the QuarksStatefulSet. If Spec.ActiveService is not set, a
+// Service created before is deleted. The Service is owned by the
+// QuarksStatefulSet and garbage collected with it.
+func (r *ReconcileQuarksStatefulSet) reconcileActiveService(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet) error {
+	spec := qStatefulSet.Spec.ActiveService
+	if spec == nil {
+		return r.deleteActiveService(ctx, qStatefulSet)
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      activeServiceName(qStatefulSet),
+			Namespace: qStatefulSet.Namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.client, service, func() error {
+		if !service.CreationTimestamp.IsZero() && !metav1.IsControlledBy(service, qStatefulSet) {
+			return errors.Errorf("service '%s/%s' already exists and is not owned by the QuarksStatefulSet", service.Namespace, service.Name)
+		}
+
+		if service.Annotations == nil {
+			service.Annotations = map[string]string{}
+		}
+		for key, value := range spec.Annotations {
+			service.Annotations[key] = value
+		}
+		if service.Labels == nil {
+			service.Labels = map[string]string{}
+		}
+		service.Labels[qstsv1a1.LabelQStsName] = qStatefulSet.Name
+
+		// The cluster IP is kept, it can't be changed
+		service.Spec.Type = spec.Type
+		if service.Spec.Type == "" {
+			service.Spec.Type = corev1.ServiceTypeClusterIP
+		}
+		service.Spec.Ports = mergeServicePorts(service.Spec.Type, spec.Ports, service.Spec.Ports)
+		service.Spec.Selector = quarksStatefulSetPodLabels(qStatefulSet)
+		service.Spec.Selector[qstsv1a1.LabelActivePod] = "active"
+
+		return r.setReference(qStatefulSet, service, r.scheme)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not create or update active service '%s/%s'", service.Namespace, service.Name)
+	}
+
+	ctxlog.Debugf(ctx, "Created/Updated active service '%s/%s' for QuarksStatefulSet '%s'", service.Namespace, service.Name, qStatefulSet.GetNamespacedName())
+	return nil
+}
+
+// mergeServicePorts returns the desired ports. Node ports allocated by the
+// API server are kept, unless the port sets one or the type of the Service
+// has no node ports.
+func mergeServicePorts(serviceType corev1.ServiceType, desired []corev1.ServicePort, existing []corev1.ServicePort) []corev1.ServicePort {
+	ports := make([]corev1.ServicePort, len(desired))
+	for i, port := range desired {
+		ports[i] = *port.DeepCopy()
+		if port.NodePort != 0 || serviceType == corev1.ServiceTypeClusterIP {
+			continue
+		}
+		for _, e := range existing {
+			if e.Port == port.Port && protocol(e) == protocol(port) {
+				ports[i].NodePort = e.NodePort
+			}
+		}
+	}
+	return ports
+}
+
+// protocol returns the protocol of the port, which defaults to TCP
+func protocol(port corev1.ServicePort) corev1.Protocol {
+	if port.Protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return port.Protocol
+}
+
+func (r *ReconcileQuarksStatefulSet) deleteActiveService(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet) error {
+	service := &corev1.Service{}
+	name := types.NamespacedName{Name: activeServiceName(qStatefulSet), Namespace: qStatefulSet.Namespace}
+	if err := r.client.Get(ctx, name, service); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "could not get active service '%s'", name)
+	}
+	if !metav1.IsControlledBy(service, qStatefulSet) {
+		return nil
+	}
+
+	ctxlog.Infof(ctx, "Deleting active service '%s' of QuarksStatefulSet '%s'", name, qStatefulSet.GetNamespacedName())
+	if err := r.client.Delete(ctx, service); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "could not delete active service '%s'", name)
+	}
+	return nil
+}
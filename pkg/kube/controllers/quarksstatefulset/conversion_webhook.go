@@ -0,0 +1,85 @@
+package quarksstatefulset
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	crdutil "code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/crd"
+	"code.cloudfoundry.org/quarks-utils/pkg/config"
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+)
+
+// ConversionWebhookPath is the path the conversion webhook is served on
+const ConversionWebhookPath = "/convert"
+
+// NewConversionWebhook returns the handler, which converts QuarksStatefulSets
+// between the served API versions. The manager injects its scheme.
+func NewConversionWebhook() *conversion.Webhook {
+	return &conversion.Webhook{}
+}
+
+// ConfigureConversionWebhook points the conversion of the QuarksStatefulSet
+// CRD to the webhook server of the operator and serves all versions. The
+// CRD is cluster-scoped, the operator which started last converts for all
+// namespaces.
+func ConfigureConversionWebhook(ctx context.Context, client crc.Client, config *config.Config, serviceName string, caBundle []byte) error {
+	crd := &extv1.CustomResourceDefinition{}
+	err := client.Get(ctx, crc.ObjectKey{Name: qstsv1a1.QuarksStatefulSetResourceName}, crd)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			ctxlog.Infof(ctx, "Skipping conversion webhook setup, CRD '%s' not found", qstsv1a1.QuarksStatefulSetResourceName)
+			return nil
+		}
+		return errors.Wrapf(err, "getting CRD '%s'", qstsv1a1.QuarksStatefulSetResourceName)
+	}
+
+	path := ConversionWebhookPath
+	clientConfig := &extv1.WebhookClientConfig{
+		CABundle: caBundle,
+	}
+	if config.WebhookUseServiceRef {
+		clientConfig.Service = &extv1.ServiceReference{
+			Name:      serviceName,
+			Namespace: config.OperatorNamespace,
+			Path:      &path,
+		}
+	} else {
+		u := url.URL{
+			Scheme: "https",
+			Host:   net.JoinHostPort(config.WebhookServerHost, strconv.Itoa(int(config.WebhookServerPort))),
+			Path:   path,
+		}
+		urlString := u.String()
+		clientConfig.URL = &urlString
+	}
+
+	orig := crd.DeepCopy()
+	crd.Spec.Conversion = &extv1.CustomResourceConversion{
+		Strategy: extv1.WebhookConverter,
+		Webhook: &extv1.WebhookConversion{
+			ClientConfig: clientConfig,
+			// the controller-runtime conversion webhook decodes v1beta1 reviews
+			ConversionReviewVersions: []string{"v1beta1"},
+		},
+	}
+	// v1beta1 is only served, once it's converted
+	crdutil.ServeAllVersions(crd)
+
+	ctxlog.Debugf(ctx, "Configuring conversion webhook of CRD '%s'", crd.Name)
+	err = client.Patch(ctx, crd, crc.MergeFrom(orig))
+	if err != nil {
+		return errors.Wrapf(err, "patching conversion of CRD '%s'", crd.Name)
+	}
+
+	return nil
+}
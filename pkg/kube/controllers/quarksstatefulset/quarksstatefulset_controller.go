@@ -6,6 +6,7 @@ import (
 	"reflect"
 
 	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
 	crc "sigs.k8s.io/controller-runtime/pkg/client"
@@ -77,10 +78,6 @@ func AddQuarksStatefulSet(ctx context.Context, config *config.Config, mgr manage
 			o := e.ObjectOld.(*qstsv1a1.QuarksStatefulSet)
 			n := e.ObjectNew.(*qstsv1a1.QuarksStatefulSet)
 
-			if !reflect.DeepEqual(o.Spec.Template.Spec.VolumeClaimTemplates, n.Spec.Template.Spec.VolumeClaimTemplates) {
-				ctxlog.WithEvent(n, "VolumeClaimTemplatesWarning").Infof(ctx, "Change in VolumeClaimTemplates QuarksStatefulSet won't be performed in sts as it's not supported by Kubernetes")
-			}
-
 			// don't trigger for update to Annotations
 			if !reflect.DeepEqual(o.Spec, n.Spec) || !reflect.DeepEqual(o.Labels, n.Labels) {
 				ctxlog.NewPredicateEvent(e.ObjectNew).Debug(
@@ -180,5 +177,61 @@ func AddQuarksStatefulSet(ctx context.Context, config *config.Config, mgr manage
 		return errors.Wrapf(err, "Watching secrets failed in QuarksStatefulSet controller failed.")
 	}
 
+	// Watch the readiness of nodes for zone failover
+	nodePredicates := predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return true },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return true },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldNode := e.ObjectOld.(*corev1.Node)
+			newNode := e.ObjectNew.(*corev1.Node)
+
+			oldReady, _ := nodeReady(*oldNode)
+			newReady, _ := nodeReady(*newNode)
+			return oldReady != newReady
+		},
+	}
+	err = c.Watch(&source.Kind{Type: &corev1.Node{}}, handler.EnqueueRequestsFromMapFunc(
+		func(a crc.Object) []reconcile.Request {
+			node := a.(*corev1.Node)
+
+			reconciles, err := nodeReconciles(ctx, mgr.GetClient(), node, config.MonitoredID)
+			if err != nil {
+				ctxlog.Errorf(ctx, "Failed to calculate reconciles for node '%s': %v", node.Name, err)
+			}
+
+			for _, reconciliation := range reconciles {
+				ctxlog.NewMappingEvent(a).Debug(ctx, reconciliation, "QuarksStatefulSet", a.GetName(), "node")
+			}
+			return reconciles
+		}), nodePredicates)
+	if err != nil {
+		return errors.Wrapf(err, "Watching nodes failed in QuarksStatefulSet controller failed.")
+	}
+
+	// Watch the rollouts of the zones, if they are updated one after the
+	// other. The next zone is updated once the rollout is done.
+	statefulSetPredicates := predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return false },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldStatefulSet := e.ObjectOld.(*appsv1.StatefulSet)
+			newStatefulSet := e.ObjectNew.(*appsv1.StatefulSet)
+
+			if !sequentialZones(newStatefulSet.Annotations) {
+				return false
+			}
+			return !zoneRolloutDone(oldStatefulSet) && zoneRolloutDone(newStatefulSet)
+		},
+	}
+	err = c.Watch(&source.Kind{Type: &appsv1.StatefulSet{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &qstsv1a1.QuarksStatefulSet{},
+	}, nsPred, statefulSetPredicates)
+	if err != nil {
+		return errors.Wrapf(err, "Watching statefulsets failed in QuarksStatefulSet controller failed.")
+	}
+
 	return nil
 }
@@ -16,6 +16,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -27,6 +28,7 @@ import (
 	"code.cloudfoundry.org/quarks-utils/pkg/config"
 	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
 	"code.cloudfoundry.org/quarks-utils/pkg/meltdown"
+	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
 	"code.cloudfoundry.org/quarks-utils/pkg/util"
 	vss "code.cloudfoundry.org/quarks-utils/pkg/versionedsecretstore"
 )
@@ -36,8 +38,13 @@ const (
 	EnvKubeAz = "KUBE_AZ"
 	// EnvBoshAz is set by available zone name
 	EnvBoshAz = "BOSH_AZ"
-	// EnvReplicas describes the number of replicas in the QuarksStatefulSet
+	// EnvReplicas describes the number of replicas in the zone
 	EnvReplicas = "REPLICAS"
+	// EnvTotalReplicas describes the number of replicas in all zones
+	EnvTotalReplicas = "TOTAL_REPLICAS"
+	// EnvReplicasOffset is the number of replicas in the zones before this
+	// one. Added to the pod ordinal it gives an index across all zones.
+	EnvReplicasOffset = "REPLICAS_OFFSET"
 	// EnvCfOperatorAz is set by available zone name
 	EnvCfOperatorAz = "CF_OPERATOR_AZ"
 	// EnvCFOperatorAZIndex is set by available zone index
@@ -133,13 +140,40 @@ func (r *ReconcileQuarksStatefulSet) Reconcile(_ context.Context, request reconc
 	}
 	ctxlog.Infof(ctx, "Meltdown ended for '%s'", request.NamespacedName)
 
+	existingStatefulSets, err := listStatefulSetsFromInformer(ctx, r.client, qStatefulSet)
+	if err != nil {
+		return reconcile.Result{}, ctxlog.WithEvent(qStatefulSet, "ListStatefulSetsError").Error(ctx, "Could not list StatefulSets owned by QuarksStatefulSet '", request.NamespacedName, "': ", err)
+	}
+
+	// Retrying doesn't help, the zones have to be fixed in the spec
+	if err := checkZoneIdentity(qStatefulSet, existingStatefulSets); err != nil {
+		_ = ctxlog.WithEvent(qStatefulSet, "ZoneReorderError").Error(ctx, "Refusing to reconcile QuarksStatefulSet '", request.NamespacedName, "': ", err)
+		if err := r.refuseZoneReorder(ctx, qStatefulSet, err); err != nil {
+			return reconcile.Result{}, ctxlog.WithEvent(qStatefulSet, "UpdateStatusError").Errorf(ctx, "Failed to update status on QuarksStatefulSet '%s': %s", request.NamespacedName, err)
+		}
+		return reconcile.Result{}, nil
+	}
+
+	failedZones, failoverAfter, err := r.failedZones(ctx, qStatefulSet)
+	if err != nil {
+		return reconcile.Result{}, ctxlog.WithEvent(qStatefulSet, "ZoneFailoverError").Error(ctx, "Could not check the zones of QuarksStatefulSet '", request.NamespacedName, "': ", err)
+	}
+	recordFailoverEvents(ctx, qStatefulSet, existingStatefulSets, failedZones)
+
 	// Calculate the desired statefulSets
-	desiredStatefulSets, err := r.calculateDesiredStatefulSets(ctx, qStatefulSet)
+	desiredStatefulSets, err := r.calculateDesiredStatefulSets(ctx, qStatefulSet, failedZones)
 	if err != nil {
 		return reconcile.Result{}, ctxlog.WithEvent(qStatefulSet, "CalculationError").Error(ctx, "Could not calculate StatefulSet owned by QuarksStatefulSet '", request.NamespacedName, "': ", err)
 	}
 
-	for _, desiredStatefulSet := range desiredStatefulSets {
+	if waitingFor, failed := holdZoneRollouts(qStatefulSet, existingStatefulSets, desiredStatefulSets); failed {
+		ctxlog.WarningEvent(ctx, qStatefulSet, "ZoneRolloutStopped", fmt.Sprintf("The rollout of StatefulSet '%s' failed, the zones after it of QuarksStatefulSet '%s' are not updated", waitingFor, request.NamespacedName))
+	} else if waitingFor != "" {
+		ctxlog.Infof(ctx, "The zones of QuarksStatefulSet '%s' wait for the rollout of StatefulSet '%s'", request.NamespacedName, waitingFor)
+	}
+
+	for i := range desiredStatefulSets {
+		desiredStatefulSet := &desiredStatefulSets[i]
 		// If it doesn't exist, create it
 		ctxlog.Infof(ctx, "StatefulSet '%s' owned by QuarksStatefulSet '%s' not found, will be created.",
 			request.NamespacedName,
@@ -148,7 +182,13 @@ func (r *ReconcileQuarksStatefulSet) Reconcile(_ context.Context, request reconc
 		if err = r.versionedSecretStore.SetSecretReferences(ctx, request.Namespace, &qStatefulSet.Spec.Template.Spec.Template.Spec); err != nil {
 			return reconcile.Result{}, ctxlog.WithEvent(qStatefulSet, "UpdateVersionedSecretReferencesError").Error(ctx, "Could not update versioned secret references in pod spec for QuarksStatefulSet '", request.NamespacedName, "': ", err)
 		}
-		if err := r.createStatefulSet(ctx, qStatefulSet, &desiredStatefulSet); err != nil {
+		if keepRollback(qStatefulSet, existingStatefulSets, desiredStatefulSet) {
+			ctxlog.Infof(ctx, "Keeping the rolled back pod template of StatefulSet '%s', until QuarksStatefulSet '%s' changes", desiredStatefulSet.Name, request.NamespacedName)
+		}
+		if keepRollout(existingStatefulSets, desiredStatefulSet) {
+			ctxlog.Debugf(ctx, "Keeping the rollout state of StatefulSet '%s', its pod template didn't change", desiredStatefulSet.Name)
+		}
+		if err := r.createStatefulSet(ctx, qStatefulSet, desiredStatefulSet); err != nil {
 			return reconcile.Result{}, ctxlog.WithEvent(qStatefulSet, "CreateStatefulSetError").Error(ctx, "Could not create StatefulSet for QuarksStatefulSet '", request.NamespacedName, "': ", err)
 		}
 
@@ -156,9 +196,47 @@ func (r *ReconcileQuarksStatefulSet) Reconcile(_ context.Context, request reconc
 		qStatefulSet.Status.Ready = false
 	}
 
+	if err := r.reconcileActiveService(ctx, qStatefulSet); err != nil {
+		return reconcile.Result{}, ctxlog.WithEvent(qStatefulSet, "ActiveServiceError").Error(ctx, "Could not reconcile the active service of QuarksStatefulSet '", request.NamespacedName, "': ", err)
+	}
+
+	if err := r.updateObservedGeneration(ctx, qStatefulSet); err != nil {
+		return reconcile.Result{}, ctxlog.WithEvent(qStatefulSet, "UpdateStatusError").Errorf(ctx, "Failed to update observed generation on QuarksStatefulSet '%s': %s", request.NamespacedName, err)
+	}
+
+	draining, err := r.cleanupStatefulSets(ctx, qStatefulSet, existingStatefulSets, desiredStatefulSets)
+	if err != nil {
+		return reconcile.Result{}, ctxlog.WithEvent(qStatefulSet, "CleanupStatefulSetError").Error(ctx, "Could not remove StatefulSets of QuarksStatefulSet '", request.NamespacedName, "': ", err)
+	}
+	if draining {
+		ctxlog.Infof(ctx, "Requeue, waiting for StatefulSets of QuarksStatefulSet '%s' to drain", request.NamespacedName)
+		return reconcile.Result{RequeueAfter: ReconcileSkipDuration}, nil
+	}
+
+	if failoverAfter > 0 {
+		ctxlog.Infof(ctx, "Requeue, waiting for the failover delay of QuarksStatefulSet '%s'", request.NamespacedName)
+		return reconcile.Result{RequeueAfter: failoverAfter}, nil
+	}
+
 	return reconcile.Result{}, nil
 }
 
+// updateObservedGeneration records the generation of the QuarksStatefulSet
+// which has been applied to its StatefulSets
+func (r *ReconcileQuarksStatefulSet) updateObservedGeneration(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &qstsv1a1.QuarksStatefulSet{}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: qStatefulSet.Name, Namespace: qStatefulSet.Namespace}, latest); err != nil {
+			return err
+		}
+		if latest.Status.ObservedGeneration == qStatefulSet.Generation {
+			return nil
+		}
+		latest.Status.ObservedGeneration = qStatefulSet.Generation
+		return r.client.Status().Update(ctx, latest)
+	})
+}
+
 // UpdateVersions updates the versions of all versioned secret
 // mounted as volumes in QuarksStatefulSet
 func (r *ReconcileQuarksStatefulSet) UpdateVersions(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet) error {
@@ -184,8 +262,10 @@ func (r *ReconcileQuarksStatefulSet) UpdateVersions(ctx context.Context, qStatef
 	return nil
 }
 
-// calculateDesiredStatefulSets generates the desired StatefulSets that should exist
-func (r *ReconcileQuarksStatefulSet) calculateDesiredStatefulSets(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet) ([]appsv1.StatefulSet, error) {
+// calculateDesiredStatefulSets generates the desired StatefulSets that should
+// exist. The replicas of failed zones, by zone index, are moved to the other
+// zones.
+func (r *ReconcileQuarksStatefulSet) calculateDesiredStatefulSets(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet, failedZones []bool) ([]appsv1.StatefulSet, error) {
 	var desiredStatefulSets []appsv1.StatefulSet
 
 	template := qStatefulSet.Spec.Template.DeepCopy()
@@ -207,17 +287,30 @@ func (r *ReconcileQuarksStatefulSet) calculateDesiredStatefulSets(ctx context.Co
 		qStatefulSet.Spec.ZoneNodeLabel = qstsv1a1.DefaultZoneNodeLabel
 	}
 
+	replicas := zoneReplicas(qStatefulSet)
+
 	if len(qStatefulSet.Spec.Zones) > 0 {
 		for zoneIndex, zoneName := range qStatefulSet.Spec.Zones {
-			statefulSet, err := r.generateSingleStatefulSet(qStatefulSet, template, zoneIndex, zoneName, desiredVersion)
+			statefulSet, err := r.generateSingleStatefulSet(qStatefulSet, template, zoneIndex, zoneName, replicas, desiredVersion)
 			if err != nil {
 				return desiredStatefulSets, errors.Wrapf(err, "Could not generate StatefulSet template for AZ '%d/%s'", zoneIndex, zoneName)
 			}
 			desiredStatefulSets = append(desiredStatefulSets, *statefulSet)
 		}
 
+		// Only the StatefulSets are scaled, the env of the pods keeps the
+		// planned replicas. Otherwise every pod would restart on failover.
+		failoverReplicas := failoverReplicas(replicas, failedZones)
+		for zoneIndex := range desiredStatefulSets {
+			statefulSet := &desiredStatefulSets[zoneIndex]
+			statefulSet.Spec.Replicas = pointers.Int32(failoverReplicas[zoneIndex])
+			if zoneIndex < len(failedZones) && failedZones[zoneIndex] {
+				statefulSet.Annotations[qstsv1a1.AnnotationZoneFailedOver] = "true"
+			}
+		}
+
 	} else {
-		statefulSet, err := r.generateSingleStatefulSet(qStatefulSet, template, 0, "", desiredVersion)
+		statefulSet, err := r.generateSingleStatefulSet(qStatefulSet, template, 0, "", replicas, desiredVersion)
 		if err != nil {
 			return desiredStatefulSets, errors.Wrap(err, "Could not generate StatefulSet template for single zone")
 		}
@@ -227,6 +320,52 @@ func (r *ReconcileQuarksStatefulSet) calculateDesiredStatefulSets(ctx context.Co
 	return desiredStatefulSets, nil
 }
 
+// keepRollback keeps the pod template of a StatefulSet, whose failed
+// rollout was rolled back, as long as the generation of the
+// QuarksStatefulSet has already been applied. Otherwise the failed template
+// would be rolled out again.
+func keepRollback(qStatefulSet *qstsv1a1.QuarksStatefulSet, existingStatefulSets []appsv1.StatefulSet, desiredStatefulSet *appsv1.StatefulSet) bool {
+	if qStatefulSet.Status.ObservedGeneration < qStatefulSet.Generation {
+		return false
+	}
+	for _, statefulSet := range existingStatefulSets {
+		if statefulSet.Name != desiredStatefulSet.Name {
+			continue
+		}
+		revision, ok := statefulSet.Annotations[qstsv1a1.AnnotationRolledBackRevision]
+		if !ok {
+			return false
+		}
+		desiredStatefulSet.Spec.Template = statefulSet.Spec.Template
+		desiredStatefulSet.Annotations[qstsv1a1.AnnotationRolledBackRevision] = revision
+		return true
+	}
+	return false
+}
+
+// keepRollout keeps the rollout annotations and the partition of a
+// StatefulSet, whose pod template didn't change. Reconciles, which are
+// triggered by nodes or other StatefulSets, would otherwise reset a running
+// rollout.
+func keepRollout(existingStatefulSets []appsv1.StatefulSet, desiredStatefulSet *appsv1.StatefulSet) bool {
+	hash, ok := desiredStatefulSet.Annotations[qstsv1a1.AnnotationTemplateHash]
+	if !ok {
+		return false
+	}
+	for i := range existingStatefulSets {
+		statefulSet := &existingStatefulSets[i]
+		if statefulSet.Name != desiredStatefulSet.Name {
+			continue
+		}
+		if statefulSet.Annotations[qstsv1a1.AnnotationTemplateHash] != hash {
+			return false
+		}
+		statefulset.CopyRolloutState(statefulSet, desiredStatefulSet)
+		return true
+	}
+	return false
+}
+
 // createStatefulSet creates a StatefulSet
 func (r *ReconcileQuarksStatefulSet) createStatefulSet(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet, statefulSet *appsv1.StatefulSet) error {
 
@@ -245,19 +384,18 @@ func (r *ReconcileQuarksStatefulSet) createStatefulSet(ctx context.Context, qSta
 	return nil
 }
 
-// generateSingleStatefulSet creates a StatefulSet from one zone
-func (r *ReconcileQuarksStatefulSet) generateSingleStatefulSet(qStatefulSet *qstsv1a1.QuarksStatefulSet, template *appsv1.StatefulSet, zoneIndex int, zoneName string, version int) (*appsv1.StatefulSet, error) {
+// generateSingleStatefulSet creates a StatefulSet from one zone, replicas
+// contains the desired replicas of all zones
+func (r *ReconcileQuarksStatefulSet) generateSingleStatefulSet(qStatefulSet *qstsv1a1.QuarksStatefulSet, template *appsv1.StatefulSet, zoneIndex int, zoneName string, replicas []int32, version int) (*appsv1.StatefulSet, error) {
 	statefulSet := template.DeepCopy()
+	statefulSet.Spec.Replicas = pointers.Int32(replicas[zoneIndex])
 
-	statefulSetNamePrefix := qStatefulSet.GetName()
+	statefulSetNamePrefix := statefulSetName(qStatefulSet, zoneIndex)
 	labels := make(map[string]string)
 	annotations := make(map[string]string)
 
 	// Update available-zone specified properties
 	if zoneName != "" {
-		// Override name prefix with zoneIndex
-		statefulSetNamePrefix = fmt.Sprintf("%s-z%d", qStatefulSet.GetName(), zoneIndex)
-
 		labels[qstsv1a1.LabelAZName] = zoneName
 
 		zonesBytes, err := json.Marshal(qStatefulSet.Spec.Zones)
@@ -266,7 +404,7 @@ func (r *ReconcileQuarksStatefulSet) generateSingleStatefulSet(qStatefulSet *qst
 		}
 		annotations[qstsv1a1.AnnotationZones] = string(zonesBytes)
 
-		statefulSet = r.updateAffinity(statefulSet, qStatefulSet.Spec.ZoneNodeLabel, zoneName)
+		statefulSet = r.updateAffinity(qStatefulSet, statefulSet, zoneName)
 	}
 	labels[qstsv1a1.LabelAZIndex] = strconv.Itoa(zoneIndex)
 	labels[qstsv1a1.LabelQStsName] = statefulSetNamePrefix
@@ -282,57 +420,106 @@ func (r *ReconcileQuarksStatefulSet) generateSingleStatefulSet(qStatefulSet *qst
 	statefulSet.Spec.Selector = &metav1.LabelSelector{
 		MatchLabels: labels,
 	}
+	// The StatefulSet name of the pods of a zone has the zone suffix. Not
+	// part of the selector, which can't be changed for existing StatefulSets.
+	if zoneName != "" {
+		statefulSet.Spec.Template.Labels[qstsv1a1.LabelQuarksStatefulSet] = qStatefulSet.Name
+	}
 
 	annotations[qstsv1a1.AnnotationVersion] = strconv.Itoa(version)
 	statefulSet.SetAnnotations(util.UnionMaps(statefulSet.GetAnnotations(), annotations))
 
-	r.injectContainerEnv(&statefulSet.Spec.Template.Spec, zoneIndex, zoneName, qStatefulSet.Spec.Template.Spec.Replicas, qStatefulSet.Spec.InjectReplicasEnv)
+	r.injectContainerEnv(&statefulSet.Spec.Template.Spec, zoneIndex, zoneName, replicas, qStatefulSet.Spec.InjectReplicasEnv)
+
+	hash, err := templateHash(&statefulSet.Spec.Template)
+	if err != nil {
+		return &appsv1.StatefulSet{}, err
+	}
+	statefulSet.Annotations[qstsv1a1.AnnotationTemplateHash] = hash
 	return statefulSet, nil
 }
 
-// updateAffinity Update current statefulSet Affinity from AZ specification
-func (r *ReconcileQuarksStatefulSet) updateAffinity(statefulSet *appsv1.StatefulSet, zoneNodeLabel string, zoneName string) *appsv1.StatefulSet {
+// updateAffinity places the pods of the StatefulSet in the zone, depending
+// on the zone placement mode
+func (r *ReconcileQuarksStatefulSet) updateAffinity(qStatefulSet *qstsv1a1.QuarksStatefulSet, statefulSet *appsv1.StatefulSet, zoneName string) *appsv1.StatefulSet {
 	nodeInZoneSelector := corev1.NodeSelectorRequirement{
-		Key:      zoneNodeLabel,
+		Key:      qStatefulSet.Spec.ZoneNodeLabel,
 		Operator: corev1.NodeSelectorOpIn,
 		Values:   []string{zoneName},
 	}
 
-	affinity := statefulSet.Spec.Template.Spec.Affinity
-	// Check if optional properties were set
-	if affinity == nil {
-		affinity = &corev1.Affinity{}
+	placement := qstsv1a1.ZonePlacementSpec{}
+	if qStatefulSet.Spec.ZonePlacement != nil {
+		placement = *qStatefulSet.Spec.ZonePlacement
 	}
 
-	if affinity.NodeAffinity == nil {
-		affinity.NodeAffinity = &corev1.NodeAffinity{}
+	podSpec := &statefulSet.Spec.Template.Spec
+	// Check if optional properties were set
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	if podSpec.Affinity.NodeAffinity == nil {
+		podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
 	}
+	nodeAffinity := podSpec.Affinity.NodeAffinity
 
-	if affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
-		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
-			NodeSelectorTerms: []corev1.NodeSelectorTerm{
-				{
-					MatchExpressions: []corev1.NodeSelectorRequirement{
-						nodeInZoneSelector,
-					},
-				},
-			},
+	switch placement.Mode {
+	case qstsv1a1.ZonePlacementTopologySpread:
+		whenUnsatisfiable := placement.WhenUnsatisfiable
+		if whenUnsatisfiable == "" {
+			whenUnsatisfiable = corev1.DoNotSchedule
 		}
-	} else {
-		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms = append(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms, corev1.NodeSelectorTerm{
-			MatchExpressions: []corev1.NodeSelectorRequirement{
-				nodeInZoneSelector,
+		podSpec.TopologySpreadConstraints = append(podSpec.TopologySpreadConstraints, corev1.TopologySpreadConstraint{
+			MaxSkew:           1,
+			TopologyKey:       qStatefulSet.Spec.ZoneNodeLabel,
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector:     podLabelSelector(qStatefulSet),
+		})
+		fallthrough
+	case qstsv1a1.ZonePlacementPreferredAffinity:
+		nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, corev1.PreferredSchedulingTerm{
+			Weight: 100,
+			Preference: corev1.NodeSelectorTerm{
+				MatchExpressions: []corev1.NodeSelectorRequirement{nodeInZoneSelector},
 			},
 		})
+	default:
+		// Node selector terms are ORed, the requirements of a term are
+		// ANDed. Adding the zone to every term keeps the user's
+		// constraints and restricts all of them to the zone.
+		required := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		if required == nil || len(required.NodeSelectorTerms) == 0 {
+			nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							nodeInZoneSelector,
+						},
+					},
+				},
+			}
+		} else {
+			for i := range required.NodeSelectorTerms {
+				term := &required.NodeSelectorTerms[i]
+				term.MatchExpressions = append(term.MatchExpressions, nodeInZoneSelector)
+			}
+		}
 	}
 
-	statefulSet.Spec.Template.Spec.Affinity = affinity
-
 	return statefulSet
 }
 
-// injectContainerEnv inject AZ info to container envs
-func (r *ReconcileQuarksStatefulSet) injectContainerEnv(podSpec *corev1.PodSpec, zoneIndex int, zoneName string, replicas *int32, injectReplicasEnv *bool) {
+// injectContainerEnv inject AZ info to container envs, replicas contains the
+// desired replicas of all zones
+func (r *ReconcileQuarksStatefulSet) injectContainerEnv(podSpec *corev1.PodSpec, zoneIndex int, zoneName string, replicas []int32, injectReplicasEnv *bool) {
+	totalReplicas := int32(0)
+	replicasOffset := int32(0)
+	for i, zoneReplicas := range replicas {
+		if i < zoneIndex {
+			replicasOffset += zoneReplicas
+		}
+		totalReplicas += zoneReplicas
+	}
 
 	containers := []*corev1.Container{}
 	for i := 0; i < len(podSpec.Containers); i++ {
@@ -355,7 +542,13 @@ func (r *ReconcileQuarksStatefulSet) injectContainerEnv(podSpec *corev1.PodSpec,
 		}
 
 		if (injectReplicasEnv == nil) || (*injectReplicasEnv) {
-			envs = upsertEnvs(envs, EnvReplicas, strconv.Itoa(int(*replicas)))
+			envs = upsertEnvs(envs, EnvReplicas, strconv.Itoa(int(replicas[zoneIndex])))
+			// Only with zones, the pod templates of existing
+			// StatefulSets without zones don't change
+			if zoneName != "" {
+				envs = upsertEnvs(envs, EnvTotalReplicas, strconv.Itoa(int(totalReplicas)))
+				envs = upsertEnvs(envs, EnvReplicasOffset, strconv.Itoa(int(replicasOffset)))
+			}
 		}
 
 		container.Env = envs
@@ -14,11 +14,13 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
-	"sigs.k8s.io/controller-runtime/pkg/client"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -27,6 +29,7 @@ import (
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers"
 	cfakes "code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/fakes"
 	qstscontroller "code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/quarksstatefulset"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/statefulset"
 	cfcfg "code.cloudfoundry.org/quarks-utils/pkg/config"
 	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
 	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
@@ -62,7 +65,7 @@ var _ = Describe("ReconcileQuarksStatefulSet", func() {
 
 	Describe("Reconcile", func() {
 		var (
-			client client.Client
+			client crc.Client
 		)
 
 		Context("Provides a quarksStatefulSet definition", func() {
@@ -184,6 +187,248 @@ var _ = Describe("ReconcileQuarksStatefulSet", func() {
 				Expect(err).ToNot(HaveOccurred())
 			})
 
+			When("the generation changed", func() {
+				BeforeEach(func() {
+					desiredQStatefulSet.Generation = 2
+					client = fake.
+						NewClientBuilder().
+						WithObjects(desiredQStatefulSet).
+						Build()
+					manager.GetClientReturns(client)
+				})
+
+				It("records the observed generation in the status", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					ess := &qstsv1a1.QuarksStatefulSet{}
+					err = client.Get(context.Background(), types.NamespacedName{Name: "foo", Namespace: "default"}, ess)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(ess.Status.ObservedGeneration).To(Equal(int64(2)))
+				})
+			})
+
+			When("the statefulSet is rolling out", func() {
+				getStatefulSet := func() *appsv1.StatefulSet {
+					ss := &appsv1.StatefulSet{}
+					Expect(client.Get(context.Background(), types.NamespacedName{Name: "foo", Namespace: "default"}, ss)).To(Succeed())
+					return ss
+				}
+
+				JustBeforeEach(func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					ss := getStatefulSet()
+					ss.Spec.Replicas = pointers.Int32(3)
+					ss.Annotations[statefulset.AnnotationCanaryRollout] = "Rollout"
+					ss.Annotations[statefulset.AnnotationRolloutStep] = "1"
+					ss.Annotations[statefulset.AnnotationRolloutAnalysisState] = `{"step":1}`
+					ss.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+						Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+						RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: pointers.Int32(2)},
+					}
+					Expect(client.Update(context.Background(), ss)).To(Succeed())
+				})
+
+				It("keeps the rollout state and the partition, if the template didn't change", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					ss := getStatefulSet()
+					Expect(ss.Annotations).To(HaveKeyWithValue(statefulset.AnnotationCanaryRollout, "Rollout"))
+					Expect(ss.Annotations).To(HaveKeyWithValue(statefulset.AnnotationRolloutStep, "1"))
+					Expect(ss.Annotations).To(HaveKeyWithValue(statefulset.AnnotationRolloutAnalysisState, `{"step":1}`))
+					Expect(ss.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationVersion, "2"))
+					Expect(*ss.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(2))
+				})
+
+				It("doesn't keep the rollout state, if the template changed", func() {
+					qsts := &qstsv1a1.QuarksStatefulSet{}
+					Expect(client.Get(context.Background(), types.NamespacedName{Name: "foo", Namespace: "default"}, qsts)).To(Succeed())
+					qsts.Spec.Template.Spec.Template.Spec.Containers[0].Image = "app:2"
+					Expect(client.Update(context.Background(), qsts)).To(Succeed())
+
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					ss := getStatefulSet()
+					Expect(ss.Annotations).ToNot(HaveKey(statefulset.AnnotationCanaryRollout))
+					Expect(ss.Annotations).ToNot(HaveKey(statefulset.AnnotationRolloutStep))
+					Expect(ss.Spec.UpdateStrategy.RollingUpdate).To(BeNil())
+				})
+			})
+
+			When("the failed rollout of the statefulSet was rolled back", func() {
+				getStatefulSet := func() *appsv1.StatefulSet {
+					ss := &appsv1.StatefulSet{}
+					Expect(client.Get(context.Background(), types.NamespacedName{Name: "foo", Namespace: "default"}, ss)).To(Succeed())
+					return ss
+				}
+
+				BeforeEach(func() {
+					desiredQStatefulSet.Generation = 2
+					desiredQStatefulSet.Status.ObservedGeneration = 2
+				})
+
+				JustBeforeEach(func() {
+					rolledBack := &appsv1.StatefulSet{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "foo",
+							Namespace: "default",
+							Annotations: map[string]string{
+								qstsv1a1.AnnotationVersion:            "3",
+								qstsv1a1.AnnotationRolledBackRevision: "foo-2",
+							},
+							OwnerReferences: []metav1.OwnerReference{{
+								APIVersion: "quarks.cloudfoundry.org/v1alpha1",
+								Kind:       "QuarksStatefulSet",
+								Name:       "foo",
+								Controller: pointers.Bool(true),
+							}},
+						},
+						Spec: appsv1.StatefulSetSpec{
+							Replicas: pointers.Int32(1),
+							Template: corev1.PodTemplateSpec{
+								Spec: corev1.PodSpec{
+									Containers: []corev1.Container{{Name: "previous"}},
+								},
+							},
+						},
+					}
+					client = fake.
+						NewClientBuilder().
+						WithObjects(desiredQStatefulSet, rolledBack).
+						Build()
+					manager.GetClientReturns(client)
+					reconciler = qstscontroller.NewReconciler(ctx, config, manager, controllerutil.SetControllerReference, vss.NewVersionedSecretStore(client))
+				})
+
+				It("keeps the restored pod template and increases the version", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					ss := getStatefulSet()
+					Expect(ss.Spec.Template.Spec.Containers[0].Name).To(Equal("previous"))
+					Expect(ss.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationRolledBackRevision, "foo-2"))
+					Expect(ss.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationVersion, "4"))
+				})
+
+				When("the generation changed", func() {
+					BeforeEach(func() {
+						desiredQStatefulSet.Generation = 3
+					})
+
+					It("applies the new pod template", func() {
+						_, err := reconciler.Reconcile(context.Background(), request)
+						Expect(err).ToNot(HaveOccurred())
+
+						ss := getStatefulSet()
+						Expect(ss.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: existingEnv, Value: existingValue}))
+						Expect(ss.Annotations).ToNot(HaveKey(qstsv1a1.AnnotationRolledBackRevision))
+					})
+				})
+			})
+
+			When("an active service is configured", func() {
+				BeforeEach(func() {
+					desiredQStatefulSet.Spec.ActivePassiveProbes = map[string]corev1.Probe{
+						"busybox": {Handler: corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"true"}}}},
+					}
+					desiredQStatefulSet.Spec.ActiveService = &qstsv1a1.ActiveServiceSpec{
+						Type:        corev1.ServiceTypeNodePort,
+						Ports:       []corev1.ServicePort{{Name: "db", Port: 5432}},
+						Annotations: map[string]string{"example.com/internal": "true"},
+					}
+					client = fake.
+						NewClientBuilder().
+						WithObjects(desiredQStatefulSet).
+						Build()
+					manager.GetClientReturns(client)
+				})
+
+				It("creates a service selecting the active pod", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					service := &corev1.Service{}
+					Expect(client.Get(context.Background(), types.NamespacedName{Name: "foo-active", Namespace: "default"}, service)).To(Succeed())
+					Expect(service.Spec.Type).To(Equal(corev1.ServiceTypeNodePort))
+					Expect(service.Spec.Ports).To(HaveLen(1))
+					Expect(service.Spec.Ports[0].Port).To(Equal(int32(5432)))
+					Expect(service.Spec.Selector).To(Equal(map[string]string{
+						qstsv1a1.LabelQStsName:  "foo",
+						qstsv1a1.LabelActivePod: "active",
+					}))
+					Expect(service.Annotations).To(HaveKeyWithValue("example.com/internal", "true"))
+
+					ess := &qstsv1a1.QuarksStatefulSet{}
+					Expect(client.Get(context.Background(), request.NamespacedName, ess)).To(Succeed())
+					Expect(metav1.IsControlledBy(service, ess)).To(BeTrue())
+				})
+
+				When("the QuarksStatefulSet has zones", func() {
+					BeforeEach(func() {
+						desiredQStatefulSet.Spec.Zones = []string{"z1", "z2"}
+						client = fake.
+							NewClientBuilder().
+							WithObjects(desiredQStatefulSet).
+							Build()
+						manager.GetClientReturns(client)
+					})
+
+					It("selects the active pods of all zones", func() {
+						_, err := reconciler.Reconcile(context.Background(), request)
+						Expect(err).ToNot(HaveOccurred())
+
+						service := &corev1.Service{}
+						Expect(client.Get(context.Background(), types.NamespacedName{Name: "foo-active", Namespace: "default"}, service)).To(Succeed())
+						selector := labels.SelectorFromSet(service.Spec.Selector)
+
+						for _, name := range []string{"foo-z0", "foo-z1"} {
+							ss := &appsv1.StatefulSet{}
+							Expect(client.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "default"}, ss)).To(Succeed())
+
+							podLabels := labels.Set(ss.Spec.Template.Labels)
+							Expect(selector.Matches(podLabels)).To(BeFalse())
+							podLabels[qstsv1a1.LabelActivePod] = "active"
+							Expect(selector.Matches(podLabels)).To(BeTrue())
+						}
+					})
+				})
+
+				It("keeps the allocated node port", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					service := &corev1.Service{}
+					name := types.NamespacedName{Name: "foo-active", Namespace: "default"}
+					Expect(client.Get(context.Background(), name, service)).To(Succeed())
+					service.Spec.Ports[0].NodePort = 30432
+					Expect(client.Update(context.Background(), service)).To(Succeed())
+
+					_, err = reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(client.Get(context.Background(), name, service)).To(Succeed())
+					Expect(service.Spec.Ports[0].NodePort).To(Equal(int32(30432)))
+				})
+
+				It("deletes the service, once it's removed from the spec", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					ess := &qstsv1a1.QuarksStatefulSet{}
+					Expect(client.Get(context.Background(), request.NamespacedName, ess)).To(Succeed())
+					ess.Spec.ActiveService = nil
+					Expect(client.Update(context.Background(), ess)).To(Succeed())
+
+					_, err = reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					err = client.Get(context.Background(), types.NamespacedName{Name: "foo-active", Namespace: "default"}, &corev1.Service{})
+					Expect(errors.IsNotFound(err)).To(BeTrue())
+				})
+			})
+
 			Context("with multiple replicas", func() {
 				var ss *appsv1.StatefulSet
 				BeforeEach(func() {
@@ -210,8 +455,17 @@ var _ = Describe("ReconcileQuarksStatefulSet", func() {
 					Expect(ss.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout-enabled", "true"))
 				})
 
+				It("injects the replicas, but not the replicas of all zones", func() {
+					envs := ss.Spec.Template.Spec.Containers[0].Env
+					Expect(envs).To(ContainElement(corev1.EnvVar{Name: qstscontroller.EnvReplicas, Value: "3"}))
+					for _, env := range envs {
+						Expect(env.Name).ToNot(BeElementOf(qstscontroller.EnvTotalReplicas, qstscontroller.EnvReplicasOffset))
+					}
+				})
+
 				It("sets pod label for az index to 0 needed by service selector", func() {
 					Expect(ss.Spec.Template.GetLabels()).To(HaveKeyWithValue("quarks.cloudfoundry.org/az-index", "0"))
+					Expect(ss.Spec.Template.GetLabels()).ToNot(HaveKey(qstsv1a1.LabelQuarksStatefulSet))
 				})
 
 			})
@@ -275,6 +529,7 @@ var _ = Describe("ReconcileQuarksStatefulSet", func() {
 							Expect(podLabels).Should(HaveKeyWithValue(qstsv1a1.LabelAZIndex, strconv.Itoa(idx)))
 							Expect(podLabels).Should(HaveKeyWithValue(qstsv1a1.LabelAZName, zones[idx]))
 							Expect(podLabels).Should(HaveKeyWithValue(qstsv1a1.LabelQStsName, fmt.Sprintf("%s-z%d", ess.Name, idx)))
+							Expect(podLabels).Should(HaveKeyWithValue(qstsv1a1.LabelQuarksStatefulSet, ess.Name))
 
 							podAnnotations := ss.Spec.Template.GetAnnotations()
 							Expect(podAnnotations).Should(HaveKeyWithValue(existingAnnotation, existingValue))
@@ -381,6 +636,7 @@ var _ = Describe("ReconcileQuarksStatefulSet", func() {
 							Expect(podLabels).Should(HaveKeyWithValue(qstsv1a1.LabelAZIndex, strconv.Itoa(idx)))
 							Expect(podLabels).Should(HaveKeyWithValue(qstsv1a1.LabelAZName, zones[idx]))
 							Expect(podLabels).Should(HaveKeyWithValue(qstsv1a1.LabelQStsName, fmt.Sprintf("%s-z%d", ess.Name, idx)))
+							Expect(podLabels).Should(HaveKeyWithValue(qstsv1a1.LabelQuarksStatefulSet, ess.Name))
 
 							podAnnotations := ss.Spec.Template.GetAnnotations()
 							Expect(podAnnotations).Should(HaveKeyWithValue(existingAnnotation, existingValue))
@@ -426,6 +682,628 @@ var _ = Describe("ReconcileQuarksStatefulSet", func() {
 						}
 					})
 				})
+
+				Context("when statefulSets of other zones exist", func() {
+					var (
+						stale    *appsv1.StatefulSet
+						pvcs     []*corev1.PersistentVolumeClaim
+						existing []crc.Object
+						result   reconcile.Result
+					)
+
+					newStatefulSet := func(name string, zoneIndex int, zoneName string) *appsv1.StatefulSet {
+						labels := map[string]string{
+							qstsv1a1.LabelAZIndex:  strconv.Itoa(zoneIndex),
+							qstsv1a1.LabelAZName:   zoneName,
+							qstsv1a1.LabelQStsName: name,
+						}
+						return &appsv1.StatefulSet{
+							ObjectMeta: metav1.ObjectMeta{
+								Name:        name,
+								Namespace:   "default",
+								Labels:      labels,
+								Annotations: map[string]string{qstsv1a1.AnnotationVersion: "1"},
+								OwnerReferences: []metav1.OwnerReference{{
+									APIVersion: "quarks.cloudfoundry.org/v1alpha1",
+									Kind:       "QuarksStatefulSet",
+									Name:       "foo",
+									Controller: pointers.Bool(true),
+								}},
+							},
+							Spec: appsv1.StatefulSetSpec{
+								Replicas: pointers.Int32(1),
+								Selector: &metav1.LabelSelector{MatchLabels: labels},
+								VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+									{ObjectMeta: metav1.ObjectMeta{Name: "data"}},
+								},
+							},
+							Status: appsv1.StatefulSetStatus{Replicas: 1},
+						}
+					}
+
+					newPVC := func(name string, statefulSet *appsv1.StatefulSet) *corev1.PersistentVolumeClaim {
+						return &corev1.PersistentVolumeClaim{
+							ObjectMeta: metav1.ObjectMeta{
+								Name:      name,
+								Namespace: "default",
+								Labels:    statefulSet.Spec.Selector.MatchLabels,
+							},
+						}
+					}
+
+					BeforeEach(func() {
+						stale = newStatefulSet("foo-z3", 3, "z4")
+						pvcs = []*corev1.PersistentVolumeClaim{
+							newPVC("data-foo-z3-0", stale),
+							newPVC("other-foo-z3-0", stale),
+						}
+						existing = []crc.Object{}
+					})
+
+					JustBeforeEach(func() {
+						objects := append([]crc.Object{desiredQStatefulSet, stale}, existing...)
+						for _, pvc := range pvcs {
+							objects = append(objects, pvc)
+						}
+						client = fake.
+							NewClientBuilder().
+							WithObjects(objects...).
+							Build()
+						manager.GetClientReturns(client)
+						reconciler = qstscontroller.NewReconciler(ctx, config, manager, controllerutil.SetControllerReference, vss.NewVersionedSecretStore(client))
+
+						var err error
+						result, err = reconciler.Reconcile(context.Background(), request)
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					getStale := func() error {
+						return client.Get(context.Background(), types.NamespacedName{Name: "foo-z3", Namespace: "default"}, &appsv1.StatefulSet{})
+					}
+
+					getPVC := func(name string) error {
+						return client.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "default"}, &corev1.PersistentVolumeClaim{})
+					}
+
+					It("scales down the statefulSet of the removed zone and waits for it to drain", func() {
+						ss := &appsv1.StatefulSet{}
+						err := client.Get(context.Background(), types.NamespacedName{Name: "foo-z3", Namespace: "default"}, ss)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(*ss.Spec.Replicas).To(Equal(int32(0)))
+						Expect(result.RequeueAfter).To(Equal(qstscontroller.ReconcileSkipDuration))
+					})
+
+					When("the statefulSet of the removed zone is drained", func() {
+						BeforeEach(func() {
+							stale.Spec.Replicas = pointers.Int32(0)
+							stale.Status.Replicas = 0
+						})
+
+						It("deletes it and retains its persistent volume claims", func() {
+							Expect(errors.IsNotFound(getStale())).To(BeTrue())
+							Expect(getPVC("data-foo-z3-0")).To(Succeed())
+							Expect(result).To(Equal(reconcile.Result{}))
+						})
+					})
+
+					When("draining is disabled and the claims are deleted", func() {
+						BeforeEach(func() {
+							desiredQStatefulSet.Spec.ZoneRemoval = &qstsv1a1.ZoneRemovalSpec{
+								Drain:                       pointers.Bool(false),
+								PersistentVolumeClaimPolicy: qstsv1a1.PersistentVolumeClaimDelete,
+							}
+						})
+
+						It("deletes the statefulSet and the claims of its volume claim templates", func() {
+							Expect(errors.IsNotFound(getStale())).To(BeTrue())
+							Expect(errors.IsNotFound(getPVC("data-foo-z3-0"))).To(BeTrue())
+							Expect(getPVC("other-foo-z3-0")).To(Succeed())
+						})
+					})
+
+					When("the zones were reordered", func() {
+						BeforeEach(func() {
+							existing = []crc.Object{newStatefulSet("foo-z1", 1, "z3")}
+						})
+
+						It("refuses to move the statefulSet to another zone", func() {
+							Expect(logs.FilterMessageSnippet("Zones can only be appended or removed from the end").Len()).To(Equal(1))
+
+							ss := &appsv1.StatefulSet{}
+							err := client.Get(context.Background(), types.NamespacedName{Name: "foo-z1", Namespace: "default"}, ss)
+							Expect(err).ToNot(HaveOccurred())
+							Expect(ss.Labels).To(HaveKeyWithValue(qstsv1a1.LabelAZName, "z3"))
+
+							Expect(getStale()).To(Succeed())
+						})
+
+						It("stops progressing with the reason", func() {
+							qsts := &qstsv1a1.QuarksStatefulSet{}
+							err := client.Get(context.Background(), request.NamespacedName, qsts)
+							Expect(err).ToNot(HaveOccurred())
+
+							condition := meta.FindStatusCondition(qsts.Status.Conditions, qstsv1a1.ConditionProgressing)
+							Expect(condition).ToNot(BeNil())
+							Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+							Expect(condition.Reason).To(Equal("ZoneReorderRefused"))
+							Expect(condition.Message).To(ContainSubstring("Zones can only be appended or removed from the end"))
+							Expect(condition.ObservedGeneration).To(Equal(qsts.Generation))
+						})
+					})
+				})
+
+				Context("with zone placement", func() {
+					var ss *appsv1.StatefulSet
+
+					zoneRequirement := corev1.NodeSelectorRequirement{
+						Key:      qstsv1a1.DefaultZoneNodeLabel,
+						Operator: corev1.NodeSelectorOpIn,
+						Values:   []string{"z2"},
+					}
+
+					JustBeforeEach(func() {
+						client = fake.
+							NewClientBuilder().
+							WithObjects(desiredQStatefulSet).
+							Build()
+						manager.GetClientReturns(client)
+						reconciler = qstscontroller.NewReconciler(ctx, config, manager, controllerutil.SetControllerReference, vss.NewVersionedSecretStore(client))
+
+						_, err := reconciler.Reconcile(context.Background(), request)
+						Expect(err).ToNot(HaveOccurred())
+
+						ss = &appsv1.StatefulSet{}
+						err = client.Get(context.Background(), types.NamespacedName{Name: "foo-z1", Namespace: "default"}, ss)
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					When("the template has a required node affinity", func() {
+						BeforeEach(func() {
+							desiredQStatefulSet.Spec.Template.Spec.Template.Spec.Affinity = &corev1.Affinity{
+								NodeAffinity: &corev1.NodeAffinity{
+									RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+										NodeSelectorTerms: []corev1.NodeSelectorTerm{
+											{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "disk", Operator: corev1.NodeSelectorOpIn, Values: []string{"ssd"}}}},
+											{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "disk", Operator: corev1.NodeSelectorOpIn, Values: []string{"nvme"}}}},
+										},
+									},
+								},
+							}
+						})
+
+						It("restricts every term to the zone", func() {
+							terms := ss.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+							Expect(terms).To(HaveLen(2))
+							Expect(terms[0].MatchExpressions).To(Equal([]corev1.NodeSelectorRequirement{
+								{Key: "disk", Operator: corev1.NodeSelectorOpIn, Values: []string{"ssd"}},
+								zoneRequirement,
+							}))
+							Expect(terms[1].MatchExpressions).To(Equal([]corev1.NodeSelectorRequirement{
+								{Key: "disk", Operator: corev1.NodeSelectorOpIn, Values: []string{"nvme"}},
+								zoneRequirement,
+							}))
+						})
+					})
+
+					When("the zone is preferred", func() {
+						BeforeEach(func() {
+							desiredQStatefulSet.Spec.ZonePlacement = &qstsv1a1.ZonePlacementSpec{Mode: qstsv1a1.ZonePlacementPreferredAffinity}
+						})
+
+						It("adds a preferred node affinity instead of a required one", func() {
+							nodeAffinity := ss.Spec.Template.Spec.Affinity.NodeAffinity
+							Expect(nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution).To(BeNil())
+							Expect(nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution).To(Equal([]corev1.PreferredSchedulingTerm{{
+								Weight:     100,
+								Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{zoneRequirement}},
+							}}))
+							Expect(ss.Spec.Template.Spec.TopologySpreadConstraints).To(BeEmpty())
+						})
+					})
+
+					When("the pods are spread across the zones", func() {
+						BeforeEach(func() {
+							desiredQStatefulSet.Spec.ZonePlacement = &qstsv1a1.ZonePlacementSpec{
+								Mode:              qstsv1a1.ZonePlacementTopologySpread,
+								WhenUnsatisfiable: corev1.ScheduleAnyway,
+							}
+						})
+
+						It("adds a topology spread constraint for the pods of all zones", func() {
+							Expect(ss.Spec.Template.Spec.TopologySpreadConstraints).To(Equal([]corev1.TopologySpreadConstraint{{
+								MaxSkew:           1,
+								TopologyKey:       qstsv1a1.DefaultZoneNodeLabel,
+								WhenUnsatisfiable: corev1.ScheduleAnyway,
+								LabelSelector: &metav1.LabelSelector{
+									MatchExpressions: []metav1.LabelSelectorRequirement{{
+										Key:      qstsv1a1.LabelQStsName,
+										Operator: metav1.LabelSelectorOpIn,
+										Values:   []string{"foo-z0", "foo-z1", "foo-z2"},
+									}},
+								},
+							}}))
+
+							nodeAffinity := ss.Spec.Template.Spec.Affinity.NodeAffinity
+							Expect(nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution).To(BeNil())
+							Expect(nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution).To(HaveLen(1))
+						})
+					})
+				})
+
+				Context("with zone replicas", func() {
+					var statefulSets []*appsv1.StatefulSet
+
+					JustBeforeEach(func() {
+						client = fake.
+							NewClientBuilder().
+							WithObjects(desiredQStatefulSet).
+							Build()
+						manager.GetClientReturns(client)
+						reconciler = qstscontroller.NewReconciler(ctx, config, manager, controllerutil.SetControllerReference, vss.NewVersionedSecretStore(client))
+
+						_, err := reconciler.Reconcile(context.Background(), request)
+						Expect(err).ToNot(HaveOccurred())
+
+						statefulSets = []*appsv1.StatefulSet{}
+						for idx := range zones {
+							ss := &appsv1.StatefulSet{}
+							err = client.Get(context.Background(), types.NamespacedName{Name: fmt.Sprintf("foo-z%d", idx), Namespace: "default"}, ss)
+							Expect(err).ToNot(HaveOccurred())
+							statefulSets = append(statefulSets, ss)
+						}
+					})
+
+					expectReplicas := func(replicas []int32, total int32) {
+						offset := int32(0)
+						for idx, ss := range statefulSets {
+							Expect(*ss.Spec.Replicas).To(Equal(replicas[idx]))
+
+							envs := ss.Spec.Template.Spec.Containers[0].Env
+							Expect(envs).To(ContainElement(corev1.EnvVar{Name: qstscontroller.EnvReplicas, Value: strconv.Itoa(int(replicas[idx]))}))
+							Expect(envs).To(ContainElement(corev1.EnvVar{Name: qstscontroller.EnvTotalReplicas, Value: strconv.Itoa(int(total))}))
+							Expect(envs).To(ContainElement(corev1.EnvVar{Name: qstscontroller.EnvReplicasOffset, Value: strconv.Itoa(int(offset))}))
+							Expect(envs).To(ContainElement(corev1.EnvVar{Name: qstscontroller.EnvCFOperatorAZIndex, Value: strconv.Itoa(idx + 1)}))
+							offset += replicas[idx]
+						}
+					}
+
+					When("a zone overrides the replicas", func() {
+						BeforeEach(func() {
+							desiredQStatefulSet.Spec.Template.Spec.Replicas = pointers.Int32(2)
+							desiredQStatefulSet.Spec.ZoneReplicas = &qstsv1a1.ZoneReplicasSpec{
+								Zones: []qstsv1a1.ZoneReplicas{{Name: "z2", Replicas: pointers.Int32(0)}},
+							}
+						})
+
+						It("runs the template replicas in the other zones", func() {
+							expectReplicas([]int32{2, 0, 2}, 4)
+						})
+					})
+
+					When("the replicas are distributed", func() {
+						BeforeEach(func() {
+							desiredQStatefulSet.Spec.Template.Spec.Replicas = pointers.Int32(7)
+							desiredQStatefulSet.Spec.ZoneReplicas = &qstsv1a1.ZoneReplicasSpec{Distribute: true}
+						})
+
+						It("splits them evenly and gives the remainder to the first zones", func() {
+							expectReplicas([]int32{3, 2, 2}, 7)
+						})
+
+						Context("by weight", func() {
+							BeforeEach(func() {
+								desiredQStatefulSet.Spec.ZoneReplicas.Zones = []qstsv1a1.ZoneReplicas{
+									{Name: "z1", Weight: pointers.Int32(2)},
+									{Name: "z3", Replicas: pointers.Int32(1)},
+								}
+							})
+
+							It("splits them by weight after subtracting the overridden replicas", func() {
+								expectReplicas([]int32{4, 2, 1}, 7)
+							})
+						})
+
+						Context("and there are not enough replicas for the overrides", func() {
+							BeforeEach(func() {
+								desiredQStatefulSet.Spec.Template.Spec.Replicas = pointers.Int32(1)
+								desiredQStatefulSet.Spec.ZoneReplicas.Zones = []qstsv1a1.ZoneReplicas{
+									{Name: "z1", Replicas: pointers.Int32(2)},
+								}
+							})
+
+							It("keeps the overridden replicas", func() {
+								expectReplicas([]int32{2, 0, 0}, 2)
+							})
+						})
+					})
+				})
+
+				Context("with zone failover", func() {
+					var (
+						nodes    []crc.Object
+						existing []crc.Object
+						result   reconcile.Result
+					)
+
+					newNode := func(name string, zone string, ready corev1.ConditionStatus, since time.Duration) *corev1.Node {
+						return &corev1.Node{
+							ObjectMeta: metav1.ObjectMeta{
+								Name:   name,
+								Labels: map[string]string{qstsv1a1.DefaultZoneNodeLabel: zone},
+							},
+							Status: corev1.NodeStatus{
+								Conditions: []corev1.NodeCondition{{
+									Type:               corev1.NodeReady,
+									Status:             ready,
+									LastTransitionTime: metav1.NewTime(time.Now().Add(-since)),
+								}},
+							},
+						}
+					}
+
+					getStatefulSet := func(name string) *appsv1.StatefulSet {
+						ss := &appsv1.StatefulSet{}
+						err := client.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "default"}, ss)
+						Expect(err).ToNot(HaveOccurred())
+						return ss
+					}
+
+					BeforeEach(func() {
+						desiredQStatefulSet.Spec.Template.Spec.Replicas = pointers.Int32(3)
+						desiredQStatefulSet.Spec.ZoneFailover = &qstsv1a1.ZoneFailoverSpec{
+							Delay: &metav1.Duration{Duration: 5 * time.Minute},
+						}
+						nodes = []crc.Object{
+							newNode("node-1", "z1", corev1.ConditionTrue, time.Hour),
+							newNode("node-2", "z2", corev1.ConditionFalse, 10*time.Minute),
+							newNode("node-3", "z2", corev1.ConditionUnknown, 20*time.Minute),
+							newNode("node-4", "z3", corev1.ConditionTrue, time.Hour),
+						}
+						existing = []crc.Object{}
+					})
+
+					JustBeforeEach(func() {
+						objects := append([]crc.Object{desiredQStatefulSet}, nodes...)
+						client = fake.
+							NewClientBuilder().
+							WithObjects(append(objects, existing...)...).
+							Build()
+						manager.GetClientReturns(client)
+						reconciler = qstscontroller.NewReconciler(ctx, config, manager, controllerutil.SetControllerReference, vss.NewVersionedSecretStore(client))
+
+						var err error
+						result, err = reconciler.Reconcile(context.Background(), request)
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					It("moves the replicas of the failed zone to the other zones", func() {
+						ss := getStatefulSet("foo-z1")
+						Expect(*ss.Spec.Replicas).To(Equal(int32(0)))
+						Expect(ss.Annotations).To(HaveKey(qstsv1a1.AnnotationZoneFailedOver))
+
+						ss = getStatefulSet("foo-z0")
+						Expect(*ss.Spec.Replicas).To(Equal(int32(5)))
+						Expect(ss.Annotations).ToNot(HaveKey(qstsv1a1.AnnotationZoneFailedOver))
+						Expect(ss.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: qstscontroller.EnvReplicas, Value: "3"}))
+
+						Expect(*getStatefulSet("foo-z2").Spec.Replicas).To(Equal(int32(4)))
+						Expect(logs.FilterMessageSnippet("None of the nodes of zone 'z2' are ready").Len()).To(Equal(1))
+					})
+
+					When("the failover delay has not passed yet", func() {
+						BeforeEach(func() {
+							nodes[1] = newNode("node-2", "z2", corev1.ConditionFalse, time.Minute)
+						})
+
+						It("keeps the replicas and requeues after the delay", func() {
+							Expect(*getStatefulSet("foo-z1").Spec.Replicas).To(Equal(int32(3)))
+							Expect(result.RequeueAfter).To(BeNumerically(">", 3*time.Minute))
+							Expect(result.RequeueAfter).To(BeNumerically("<=", 4*time.Minute))
+						})
+					})
+
+					When("a node of the zone is ready", func() {
+						BeforeEach(func() {
+							nodes[1] = newNode("node-2", "z2", corev1.ConditionTrue, time.Minute)
+						})
+
+						It("keeps the replicas", func() {
+							Expect(*getStatefulSet("foo-z1").Spec.Replicas).To(Equal(int32(3)))
+							Expect(result.RequeueAfter).To(BeZero())
+						})
+					})
+
+					When("a ready node of the zone is unschedulable", func() {
+						BeforeEach(func() {
+							node := newNode("node-2", "z2", corev1.ConditionTrue, time.Hour)
+							node.Spec.Unschedulable = true
+							nodes[1] = node
+						})
+
+						It("fails the zone over", func() {
+							Expect(*getStatefulSet("foo-z1").Spec.Replicas).To(Equal(int32(0)))
+						})
+					})
+
+					When("all zones failed", func() {
+						BeforeEach(func() {
+							nodes[0] = newNode("node-1", "z1", corev1.ConditionFalse, time.Hour)
+							nodes[3] = newNode("node-4", "z3", corev1.ConditionFalse, time.Hour)
+						})
+
+						It("keeps the replicas, since there is no zone to fail over to", func() {
+							for idx := range zones {
+								ss := getStatefulSet(fmt.Sprintf("foo-z%d", idx))
+								Expect(*ss.Spec.Replicas).To(Equal(int32(3)))
+								Expect(ss.Annotations).ToNot(HaveKey(qstsv1a1.AnnotationZoneFailedOver))
+							}
+						})
+					})
+
+					When("the failed zone recovered", func() {
+						BeforeEach(func() {
+							nodes[1] = newNode("node-2", "z2", corev1.ConditionTrue, time.Minute)
+							existing = []crc.Object{&appsv1.StatefulSet{
+								ObjectMeta: metav1.ObjectMeta{
+									Name:      "foo-z1",
+									Namespace: "default",
+									Labels: map[string]string{
+										qstsv1a1.LabelAZIndex: "1",
+										qstsv1a1.LabelAZName:  "z2",
+									},
+									Annotations: map[string]string{
+										qstsv1a1.AnnotationVersion:        "1",
+										qstsv1a1.AnnotationZoneFailedOver: "true",
+									},
+									OwnerReferences: []metav1.OwnerReference{{
+										APIVersion: "quarks.cloudfoundry.org/v1alpha1",
+										Kind:       "QuarksStatefulSet",
+										Name:       "foo",
+										Controller: pointers.Bool(true),
+									}},
+								},
+								Spec: appsv1.StatefulSetSpec{Replicas: pointers.Int32(0)},
+							}}
+						})
+
+						It("moves the replicas back", func() {
+							ss := getStatefulSet("foo-z1")
+							Expect(*ss.Spec.Replicas).To(Equal(int32(3)))
+							Expect(ss.Annotations).ToNot(HaveKey(qstsv1a1.AnnotationZoneFailedOver))
+							Expect(logs.FilterMessageSnippet("Zone 'z2' recovered").Len()).To(Equal(1))
+						})
+					})
+				})
+
+				Context("with sequential zones", func() {
+					getStatefulSet := func(name string) *appsv1.StatefulSet {
+						ss := &appsv1.StatefulSet{}
+						err := client.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "default"}, ss)
+						Expect(err).ToNot(HaveOccurred())
+						return ss
+					}
+
+					newStatefulSet := func(zoneIndex int, zoneName string) *appsv1.StatefulSet {
+						name := fmt.Sprintf("foo-z%d", zoneIndex)
+						labels := map[string]string{
+							qstsv1a1.LabelAZIndex:  strconv.Itoa(zoneIndex),
+							qstsv1a1.LabelAZName:   zoneName,
+							qstsv1a1.LabelQStsName: name,
+						}
+						return &appsv1.StatefulSet{
+							ObjectMeta: metav1.ObjectMeta{
+								Name:        name,
+								Namespace:   "default",
+								Labels:      labels,
+								Annotations: map[string]string{qstsv1a1.AnnotationVersion: "1", qstsv1a1.AnnotationTemplateHash: "previous"},
+								OwnerReferences: []metav1.OwnerReference{{
+									APIVersion: "quarks.cloudfoundry.org/v1alpha1",
+									Kind:       "QuarksStatefulSet",
+									Name:       "foo",
+									Controller: pointers.Bool(true),
+								}},
+							},
+							Spec: appsv1.StatefulSetSpec{
+								Replicas: pointers.Int32(1),
+								Selector: &metav1.LabelSelector{MatchLabels: labels},
+								Template: corev1.PodTemplateSpec{
+									Spec: corev1.PodSpec{
+										Containers: []corev1.Container{{Name: "previous"}},
+									},
+								},
+							},
+							Status: appsv1.StatefulSetStatus{Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1},
+						}
+					}
+
+					// finishRollout marks the rollout of the desired template as done
+					finishRollout := func(name string) {
+						ss := getStatefulSet(name)
+						ss.Status = appsv1.StatefulSetStatus{ObservedGeneration: ss.Generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1}
+						Expect(client.Update(context.Background(), ss)).To(Succeed())
+					}
+
+					BeforeEach(func() {
+						desiredQStatefulSet.Spec.Template.Annotations[statefulset.AnnotationSequentialZones] = "true"
+					})
+
+					JustBeforeEach(func() {
+						client = fake.
+							NewClientBuilder().
+							WithObjects(desiredQStatefulSet, newStatefulSet(0, "z1"), newStatefulSet(1, "z2"), newStatefulSet(2, "z3")).
+							Build()
+						manager.GetClientReturns(client)
+						reconciler = qstscontroller.NewReconciler(ctx, config, manager, controllerutil.SetControllerReference, vss.NewVersionedSecretStore(client))
+
+						_, err := reconciler.Reconcile(context.Background(), request)
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					It("updates the first zone and keeps the templates of the other zones", func() {
+						ss := getStatefulSet("foo-z0")
+						Expect(ss.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: existingEnv, Value: existingValue}))
+						Expect(ss.Annotations).ToNot(HaveKey(qstsv1a1.AnnotationWaitingForZone))
+
+						for _, name := range []string{"foo-z1", "foo-z2"} {
+							ss := getStatefulSet(name)
+							Expect(ss.Spec.Template.Spec.Containers[0].Name).To(Equal("previous"))
+							Expect(ss.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationTemplateHash, "previous"))
+							Expect(ss.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationWaitingForZone, "foo-z0"))
+						}
+					})
+
+					When("the rollout of the first zone is done", func() {
+						JustBeforeEach(func() {
+							finishRollout("foo-z0")
+							_, err := reconciler.Reconcile(context.Background(), request)
+							Expect(err).ToNot(HaveOccurred())
+						})
+
+						It("updates the next zone", func() {
+							ss := getStatefulSet("foo-z1")
+							Expect(ss.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: existingEnv, Value: existingValue}))
+							Expect(ss.Annotations).ToNot(HaveKey(qstsv1a1.AnnotationWaitingForZone))
+
+							ss = getStatefulSet("foo-z2")
+							Expect(ss.Spec.Template.Spec.Containers[0].Name).To(Equal("previous"))
+							Expect(ss.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationWaitingForZone, "foo-z1"))
+						})
+					})
+
+					When("the rollout of the first zone failed", func() {
+						JustBeforeEach(func() {
+							finishRollout("foo-z0")
+							ss := getStatefulSet("foo-z0")
+							ss.Annotations[statefulset.AnnotationCanaryRollout] = "Failed"
+							Expect(client.Update(context.Background(), ss)).To(Succeed())
+
+							_, err := reconciler.Reconcile(context.Background(), request)
+							Expect(err).ToNot(HaveOccurred())
+						})
+
+						It("doesn't update the other zones", func() {
+							for _, name := range []string{"foo-z1", "foo-z2"} {
+								ss := getStatefulSet(name)
+								Expect(ss.Spec.Template.Spec.Containers[0].Name).To(Equal("previous"))
+								Expect(ss.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationWaitingForZone, "foo-z0"))
+							}
+						})
+					})
+
+					When("the zones are updated at the same time", func() {
+						BeforeEach(func() {
+							delete(desiredQStatefulSet.Spec.Template.Annotations, statefulset.AnnotationSequentialZones)
+						})
+
+						It("updates all zones", func() {
+							for _, name := range []string{"foo-z0", "foo-z1", "foo-z2"} {
+								ss := getStatefulSet(name)
+								Expect(ss.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: existingEnv, Value: existingValue}))
+								Expect(ss.Annotations).ToNot(HaveKey(qstsv1a1.AnnotationWaitingForZone))
+							}
+						})
+					})
+				})
 			})
 		})
 
@@ -0,0 +1,354 @@
+package quarksstatefulset
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"go.uber.org/zap"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metavalidation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	qstsv1b1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1beta1"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/statefulset"
+	"code.cloudfoundry.org/quarks-utils/pkg/config"
+)
+
+// Validator rejects invalid QuarksStatefulSets
+type Validator struct {
+	log     *zap.SugaredLogger
+	config  *config.Config
+	decoder *admission.Decoder
+}
+
+// Check that Validator implements the admission.Handler interface
+var _ admission.Handler = &Validator{}
+
+// NewValidator returns a validator for QuarksStatefulSets
+func NewValidator(log *zap.SugaredLogger, config *config.Config) admission.Handler {
+	validatorLog := log.Named("quarks-statefulset-validator")
+	validatorLog.Info("Creating a validator for QuarksStatefulSet")
+
+	return &Validator{
+		log:    validatorLog,
+		config: config,
+	}
+}
+
+// Handle validates a QuarksStatefulSet on create and update
+func (v *Validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	qsts, err := v.decode(req.Kind.Version, req.Object)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var old *qstsv1a1.QuarksStatefulSet
+	if req.Operation == admissionv1.Update {
+		old, err = v.decode(req.Kind.Version, req.OldObject)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	errs := ValidateQuarksStatefulSet(qsts, old)
+	if len(errs) > 0 {
+		v.log.Debugf("Rejecting QuarksStatefulSet '%s/%s': %s", req.Namespace, req.Name, errs.ToAggregate())
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+
+	return admission.Allowed("")
+}
+
+// decode returns the hub version of the QuarksStatefulSet in raw
+func (v *Validator) decode(version string, raw runtime.RawExtension) (*qstsv1a1.QuarksStatefulSet, error) {
+	qsts := &qstsv1a1.QuarksStatefulSet{}
+	if version != qstsv1b1.SchemeGroupVersion.Version {
+		err := v.decoder.DecodeRaw(raw, qsts)
+		return qsts, err
+	}
+
+	spoke := &qstsv1b1.QuarksStatefulSet{}
+	if err := v.decoder.DecodeRaw(raw, spoke); err != nil {
+		return nil, err
+	}
+	err := spoke.ConvertTo(qsts)
+	return qsts, err
+}
+
+// ValidateQuarksStatefulSet validates a new QuarksStatefulSet, old is
+// nil unless the QuarksStatefulSet is updated
+func ValidateQuarksStatefulSet(qsts *qstsv1a1.QuarksStatefulSet, old *qstsv1a1.QuarksStatefulSet) field.ErrorList {
+	specPath := field.NewPath("spec")
+	errs := validateZones(qsts.Spec.Zones, specPath.Child("zones"))
+	errs = append(errs, validateZoneReplicas(qsts, specPath.Child("zoneReplicas"))...)
+	errs = append(errs, validateActivePassiveProbes(qsts, specPath.Child("activePassiveProbes"))...)
+	if qsts.Spec.ActivePassiveElection != nil && len(qsts.Spec.ActivePassiveProbes) == 0 {
+		errs = append(errs, field.Required(specPath.Child("activePassiveProbes"), "electing an active pod requires active/passive probes"))
+	}
+	errs = append(errs, validateActiveService(qsts, specPath.Child("activeService"))...)
+	errs = append(errs, validateActivePassiveHooks(qsts, specPath.Child("activePassiveHooks"))...)
+	errs = append(errs, validateLabels(qsts, specPath.Child("template"))...)
+	errs = append(errs, validateRollout(qsts, specPath.Child("template", "metadata", "annotations"))...)
+
+	if old != nil {
+		errs = append(errs, validateZoneOrder(qsts.Spec.Zones, old.Spec.Zones, specPath.Child("zones"))...)
+	}
+
+	if old != nil && !reflect.DeepEqual(qsts.Spec.Template.Spec.VolumeClaimTemplates, old.Spec.Template.Spec.VolumeClaimTemplates) {
+		errs = append(errs, field.Forbidden(
+			specPath.Child("template", "spec", "volumeClaimTemplates"),
+			"volume claim templates of StatefulSets can't be updated",
+		))
+	}
+
+	return errs
+}
+
+// validateActiveService makes sure the Service can select the active pod
+func validateActiveService(qsts *qstsv1a1.QuarksStatefulSet, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if qsts.Spec.ActiveService == nil {
+		return errs
+	}
+
+	if len(qsts.Spec.ActivePassiveProbes) == 0 {
+		errs = append(errs, field.Required(field.NewPath("spec", "activePassiveProbes"), "an active Service requires active/passive probes"))
+	}
+	if len(qsts.Spec.ActiveService.Ports) == 0 {
+		errs = append(errs, field.Required(path.Child("ports"), "an active Service needs at least one port"))
+	}
+	return errs
+}
+
+func validateZones(zones []string, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	seen := map[string]bool{}
+	for i, zone := range zones {
+		if zone == "" {
+			errs = append(errs, field.Required(path.Index(i), "zone names must not be empty"))
+			continue
+		}
+		if seen[zone] {
+			errs = append(errs, field.Duplicate(path.Index(i), zone))
+		}
+		seen[zone] = true
+	}
+	return errs
+}
+
+// validateZoneOrder makes sure the zone indexes stay the same. They are
+// part of the StatefulSet names, so reordering zones would move pods to
+// another zone.
+func validateZoneOrder(zones []string, oldZones []string, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	for i := 0; i < len(zones) && i < len(oldZones); i++ {
+		if zones[i] != oldZones[i] {
+			errs = append(errs, field.Forbidden(path.Index(i), fmt.Sprintf("zone index %d belongs to zone '%s', zones can only be appended or removed from the end", i, oldZones[i])))
+		}
+	}
+	return errs
+}
+
+func validateZoneReplicas(qsts *qstsv1a1.QuarksStatefulSet, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	spec := qsts.Spec.ZoneReplicas
+	if spec == nil {
+		return errs
+	}
+
+	zones := map[string]bool{}
+	for _, zone := range qsts.Spec.Zones {
+		zones[zone] = true
+	}
+
+	seen := map[string]bool{}
+	distributed := len(qsts.Spec.Zones)
+	weight := int64(len(qsts.Spec.Zones))
+	for i, zone := range spec.Zones {
+		zonePath := path.Child("zones").Index(i)
+		if !zones[zone.Name] {
+			errs = append(errs, field.NotFound(zonePath.Child("name"), zone.Name))
+		}
+		if seen[zone.Name] {
+			errs = append(errs, field.Duplicate(zonePath.Child("name"), zone.Name))
+		}
+		seen[zone.Name] = true
+
+		if zone.Replicas != nil {
+			errs = append(errs, apimachineryvalidation.ValidateNonnegativeField(int64(*zone.Replicas), zonePath.Child("replicas"))...)
+			distributed--
+			weight--
+			continue
+		}
+		if zone.Weight != nil {
+			errs = append(errs, apimachineryvalidation.ValidateNonnegativeField(int64(*zone.Weight), zonePath.Child("weight"))...)
+			weight += int64(*zone.Weight) - 1
+		}
+	}
+
+	if spec.Distribute && distributed > 0 && weight <= 0 {
+		errs = append(errs, field.Invalid(path.Child("zones"), spec.Zones, "replicas can't be distributed, if all zones have a weight of 0"))
+	}
+	return errs
+}
+
+func validateActivePassiveProbes(qsts *qstsv1a1.QuarksStatefulSet, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	probes := qsts.Spec.ActivePassiveProbes
+
+	containers := map[string]bool{}
+	for _, c := range qsts.Spec.Template.Spec.Template.Spec.Containers {
+		containers[c.Name] = true
+	}
+
+	grpcProbes := qsts.Spec.ActivePassiveGRPCProbes
+	for container, probe := range probes {
+		if !containers[container] {
+			errs = append(errs, field.NotFound(path.Key(container), container))
+		}
+
+		handlers := 0
+		for _, set := range []bool{probe.Exec != nil, probe.HTTPGet != nil, probe.TCPSocket != nil} {
+			if set {
+				handlers++
+			}
+		}
+		if _, ok := grpcProbes[container]; ok {
+			handlers++
+		}
+		switch {
+		case handlers == 0:
+			errs = append(errs, field.Required(path.Key(container), "active/passive probes need an exec, httpGet, tcpSocket or gRPC handler"))
+		case handlers > 1:
+			errs = append(errs, field.Forbidden(path.Key(container), "active/passive probes may not have more than one handler"))
+		}
+	}
+
+	grpcPath := path.Root().Child("activePassiveGRPCProbes")
+	for container, grpc := range grpcProbes {
+		if _, ok := probes[container]; !ok {
+			errs = append(errs, field.NotFound(grpcPath.Key(container), container))
+		}
+		if grpc.Port <= 0 || grpc.Port > 65535 {
+			errs = append(errs, field.Invalid(grpcPath.Key(container).Child("port"), grpc.Port, "must be between 1 and 65535"))
+		}
+	}
+	return errs
+}
+
+func validateActivePassiveHooks(qsts *qstsv1a1.QuarksStatefulSet, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	hooks := qsts.Spec.ActivePassiveHooks
+	if hooks == nil {
+		return errs
+	}
+
+	if len(qsts.Spec.ActivePassiveProbes) == 0 {
+		errs = append(errs, field.Required(path.Root().Child("activePassiveProbes"), "active/passive hooks require active/passive probes"))
+	}
+
+	found := false
+	for _, c := range qsts.Spec.Template.Spec.Template.Spec.Containers {
+		if c.Name == hooks.Container {
+			found = true
+		}
+	}
+	if !found {
+		errs = append(errs, field.NotFound(path.Child("container"), hooks.Container))
+	}
+
+	for _, hook := range []struct {
+		name    string
+		handler *corev1.Handler
+	}{{"prePromotion", hooks.PrePromotion}, {"preDemotion", hooks.PreDemotion}} {
+		if hook.handler == nil {
+			continue
+		}
+		handlers := 0
+		for _, set := range []bool{hook.handler.Exec != nil, hook.handler.HTTPGet != nil, hook.handler.TCPSocket != nil} {
+			if set {
+				handlers++
+			}
+		}
+		if handlers != 1 {
+			errs = append(errs, field.Required(path.Child(hook.name), "hooks need exactly one exec, httpGet or tcpSocket handler"))
+		}
+	}
+
+	errs = append(errs, apimachineryvalidation.ValidateNonnegativeField(int64(hooks.TimeoutSeconds), path.Child("timeoutSeconds"))...)
+	return errs
+}
+
+// validateRollout checks the canary size and the rollout steps, which are
+// set as annotations of the StatefulSet template
+func validateRollout(qsts *qstsv1a1.QuarksStatefulSet, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	annotations := qsts.Spec.Template.GetAnnotations()
+	if value, ok := annotations[statefulset.AnnotationCanarySize]; ok {
+		if _, err := statefulset.ParseCanarySize(value); err != nil {
+			errs = append(errs, field.Invalid(path.Key(statefulset.AnnotationCanarySize), value, "must be a number or a percentage of the replicas"))
+		}
+	}
+	if value, ok := annotations[statefulset.AnnotationRolloutSteps]; ok {
+		if _, err := statefulset.ParseRolloutSteps(value); err != nil {
+			errs = append(errs, field.Invalid(path.Key(statefulset.AnnotationRolloutSteps), value, err.Error()))
+		}
+	}
+	if value, ok := annotations[statefulset.AnnotationRolloutAnalysis]; ok {
+		if _, err := statefulset.ParseRolloutAnalysis(value); err != nil {
+			errs = append(errs, field.Invalid(path.Key(statefulset.AnnotationRolloutAnalysis), value, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validateLabels checks the labels of the StatefulSet template and its pod
+// template. The operator sets its own labels and selector on the StatefulSets.
+func validateLabels(qsts *qstsv1a1.QuarksStatefulSet, path *field.Path) field.ErrorList {
+	template := qsts.Spec.Template
+	errs := metavalidation.ValidateLabels(template.GetLabels(), path.Child("metadata", "labels"))
+	errs = append(errs, apimachineryvalidation.ValidateAnnotations(template.GetAnnotations(), path.Child("metadata", "annotations"))...)
+
+	podLabels := template.Spec.Template.GetLabels()
+	podLabelsPath := path.Child("spec", "template", "metadata", "labels")
+	errs = append(errs, metavalidation.ValidateLabels(podLabels, podLabelsPath)...)
+
+	for _, key := range []string{qstsv1a1.LabelQStsName, qstsv1a1.LabelQuarksStatefulSet, qstsv1a1.LabelAZIndex, qstsv1a1.LabelAZName} {
+		if _, ok := podLabels[key]; ok {
+			errs = append(errs, field.Invalid(podLabelsPath.Key(key), podLabels[key], "label is managed by the operator"))
+		}
+	}
+
+	if template.Spec.Selector != nil {
+		selectorPath := path.Child("spec", "selector")
+		errs = append(errs, metavalidation.ValidateLabelSelector(template.Spec.Selector, selectorPath)...)
+
+		selector, err := metav1.LabelSelectorAsSelector(template.Spec.Selector)
+		if err != nil {
+			errs = append(errs, field.Invalid(selectorPath, template.Spec.Selector, err.Error()))
+		} else if !selector.Matches(labels.Set(podLabels)) {
+			errs = append(errs, field.Invalid(podLabelsPath, podLabels, fmt.Sprintf("selector '%s' does not match the pod template labels", selector)))
+		}
+	}
+
+	return errs
+}
+
+// Check that Validator implements the admission.DecoderInjector interface
+var _ admission.DecoderInjector = &Validator{}
+
+// InjectDecoder injects the decoder.
+func (v *Validator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
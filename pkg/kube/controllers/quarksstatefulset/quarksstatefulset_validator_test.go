@@ -0,0 +1,464 @@
+package quarksstatefulset_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	qstsv1b1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1beta1"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/quarksstatefulset"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/statefulset"
+	"code.cloudfoundry.org/quarks-statefulset/testing"
+	"code.cloudfoundry.org/quarks-utils/pkg/config"
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
+	helper "code.cloudfoundry.org/quarks-utils/testing/testhelper"
+)
+
+var _ = Describe("Validating QuarksStatefulSets", func() {
+	var (
+		ctx       context.Context
+		env       testing.Catalog
+		log       *zap.SugaredLogger
+		validator admission.Handler
+		qsts      qstsv1a1.QuarksStatefulSet
+		old       *qstsv1a1.QuarksStatefulSet
+		request   admission.Request
+		response  admission.Response
+	)
+
+	newAdmissionRequest := func(version string, object runtime.Object, old runtime.Object) admission.Request {
+		raw, _ := json.Marshal(object)
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Group: "quarks.cloudfoundry.org", Version: version, Kind: "QuarksStatefulSet"},
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		}
+		if old != nil {
+			oldRaw, _ := json.Marshal(old)
+			req.Operation = admissionv1.Update
+			req.OldObject = runtime.RawExtension{Raw: oldRaw}
+		}
+		return req
+	}
+
+	probe := corev1.Probe{
+		Handler: corev1.Handler{
+			Exec: &corev1.ExecAction{Command: []string{"ls"}},
+		},
+	}
+
+	BeforeEach(func() {
+		_, log = helper.NewTestLogger()
+		ctx = ctxlog.NewParentContext(log)
+
+		validator = quarksstatefulset.NewValidator(log, &config.Config{CtxTimeOut: 10 * time.Second})
+
+		scheme := runtime.NewScheme()
+		Expect(qstsv1a1.AddToScheme(scheme)).To(Succeed())
+		Expect(qstsv1b1.AddToScheme(scheme)).To(Succeed())
+		decoder, _ := admission.NewDecoder(scheme)
+		_ = validator.(admission.DecoderInjector).InjectDecoder(decoder)
+
+		qsts = env.DefaultQuarksStatefulSet("validate-test")
+		old = nil
+	})
+
+	JustBeforeEach(func() {
+		var oldObject runtime.Object
+		if old != nil {
+			oldObject = old
+		}
+		request = newAdmissionRequest("v1alpha1", &qsts, oldObject)
+		response = validator.Handle(ctx, request)
+	})
+
+	It("allows a valid QuarksStatefulSet", func() {
+		Expect(response.Allowed).To(BeTrue())
+	})
+
+	Context("with zones", func() {
+		BeforeEach(func() {
+			qsts.Spec.Zones = []string{"z1", "", "z1"}
+		})
+
+		It("rejects duplicate and empty zones", func() {
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.zones[1]: Required value"))
+			Expect(string(response.Result.Reason)).To(ContainSubstring(`spec.zones[2]: Duplicate value: "z1"`))
+		})
+	})
+
+	Context("with zone replicas", func() {
+		BeforeEach(func() {
+			qsts.Spec.Zones = []string{"z1", "z2"}
+		})
+
+		It("allows overrides and weights of known zones", func() {
+			qsts.Spec.ZoneReplicas = &qstsv1a1.ZoneReplicasSpec{
+				Distribute: true,
+				Zones: []qstsv1a1.ZoneReplicas{
+					{Name: "z1", Replicas: pointers.Int32(0)},
+					{Name: "z2", Weight: pointers.Int32(3)},
+				},
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("rejects unknown and duplicate zones", func() {
+			qsts.Spec.ZoneReplicas = &qstsv1a1.ZoneReplicasSpec{
+				Zones: []qstsv1a1.ZoneReplicas{{Name: "z1"}, {Name: "z1"}, {Name: "z3"}},
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring(`spec.zoneReplicas.zones[1].name: Duplicate value: "z1"`))
+			Expect(string(response.Result.Reason)).To(ContainSubstring(`spec.zoneReplicas.zones[2].name: Not found: "z3"`))
+		})
+
+		It("rejects negative replicas and weights", func() {
+			qsts.Spec.ZoneReplicas = &qstsv1a1.ZoneReplicasSpec{
+				Zones: []qstsv1a1.ZoneReplicas{
+					{Name: "z1", Replicas: pointers.Int32(-1)},
+					{Name: "z2", Weight: pointers.Int32(-1)},
+				},
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.zoneReplicas.zones[0].replicas: Invalid value: -1"))
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.zoneReplicas.zones[1].weight: Invalid value: -1"))
+		})
+
+		It("rejects distributing replicas to zones without weight", func() {
+			qsts.Spec.ZoneReplicas = &qstsv1a1.ZoneReplicasSpec{
+				Distribute: true,
+				Zones: []qstsv1a1.ZoneReplicas{
+					{Name: "z1", Weight: pointers.Int32(0)},
+					{Name: "z2", Weight: pointers.Int32(0)},
+				},
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("all zones have a weight of 0"))
+		})
+	})
+
+	Context("with active/passive probes", func() {
+		It("allows probes in more than one container", func() {
+			podSpec := &qsts.Spec.Template.Spec.Template.Spec
+			podSpec.Containers = append(podSpec.Containers, corev1.Container{Name: "other", Image: "busybox"})
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": probe, "other": probe}
+			qsts.Spec.ActivePassiveProbePolicy = qstsv1a1.ActivePassiveProbeAny
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("rejects containers which are not in the pod template", func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"missing": probe}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring(`spec.activePassiveProbes[missing]: Not found: "missing"`))
+		})
+
+		It("rejects probes without a handler", func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": {}}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.activePassiveProbes[busybox]: Required value"))
+		})
+
+		It("allows network probes", func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": {
+				Handler: corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/primary", Port: intstr.FromInt(8080)}},
+			}}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("allows gRPC probes", func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": {TimeoutSeconds: 2}}
+			qsts.Spec.ActivePassiveGRPCProbes = map[string]qstsv1a1.GRPCAction{"busybox": {Port: 9090}}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("rejects probes with more than one handler", func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": probe}
+			qsts.Spec.ActivePassiveGRPCProbes = map[string]qstsv1a1.GRPCAction{"busybox": {Port: 9090}}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.activePassiveProbes[busybox]: Forbidden: active/passive probes may not have more than one handler"))
+		})
+
+		It("rejects gRPC probes without a probe", func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": probe}
+			qsts.Spec.ActivePassiveGRPCProbes = map[string]qstsv1a1.GRPCAction{"other": {Port: 9090}}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring(`spec.activePassiveGRPCProbes[other]: Not found: "other"`))
+		})
+
+		It("validates v1beta1 objects", func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"missing": probe}
+			beta := &qstsv1b1.QuarksStatefulSet{}
+			Expect(beta.ConvertFrom(&qsts)).To(Succeed())
+			response = validator.Handle(ctx, newAdmissionRequest("v1beta1", beta, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring(`Not found: "missing"`))
+		})
+
+		It("allows electing an active pod", func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": probe}
+			qsts.Spec.ActivePassiveElection = &qstsv1a1.ActivePassiveElectionSpec{Scope: qstsv1a1.ActivePassiveElectionPerZone}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("rejects an election without probes", func() {
+			qsts.Spec.ActivePassiveElection = &qstsv1a1.ActivePassiveElectionSpec{}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.activePassiveProbes: Required value: electing an active pod requires active/passive probes"))
+		})
+
+		It("allows active/passive hooks", func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": probe}
+			qsts.Spec.ActivePassiveHooks = &qstsv1a1.ActivePassiveHooks{
+				Container:    "busybox",
+				PrePromotion: &corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"promote"}}},
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("rejects hooks without a handler or in an unknown container", func() {
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": probe}
+			qsts.Spec.ActivePassiveHooks = &qstsv1a1.ActivePassiveHooks{
+				Container:   "missing",
+				PreDemotion: &corev1.Handler{},
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring(`spec.activePassiveHooks.container: Not found: "missing"`))
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.activePassiveHooks.preDemotion: Required value"))
+		})
+
+		It("allows an active Service", func() {
+			qsts.Spec.Zones = nil
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": probe}
+			qsts.Spec.ActiveService = &qstsv1a1.ActiveServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("rejects an active Service without probes or ports", func() {
+			qsts.Spec.Zones = nil
+			qsts.Spec.ActiveService = &qstsv1a1.ActiveServiceSpec{}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.activePassiveProbes: Required value: an active Service requires active/passive probes"))
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.activeService.ports: Required value"))
+		})
+
+		It("allows an active Service with zones", func() {
+			qsts.Spec.Zones = []string{"z1", "z2"}
+			qsts.Spec.ActivePassiveProbes = map[string]corev1.Probe{"busybox": probe}
+			qsts.Spec.ActiveService = &qstsv1a1.ActiveServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+	})
+
+	Context("when the volume claim templates change", func() {
+		BeforeEach(func() {
+			old = qsts.DeepCopy()
+			qsts.Spec.Template.Spec.VolumeClaimTemplates = env.DefaultVolumeClaimTemplates("pvc", "local")
+		})
+
+		It("rejects the update", func() {
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.template.spec.volumeClaimTemplates: Forbidden"))
+		})
+	})
+
+	Context("when the zones change", func() {
+		BeforeEach(func() {
+			qsts.Spec.Zones = []string{"z1", "z2", "z3"}
+			old = qsts.DeepCopy()
+		})
+
+		It("allows appending zones", func() {
+			qsts.Spec.Zones = []string{"z1", "z2", "z3", "z4"}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, old))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("allows removing zones from the end", func() {
+			qsts.Spec.Zones = []string{"z1", "z2"}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, old))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("rejects removing a zone which is not the last one", func() {
+			qsts.Spec.Zones = []string{"z1", "z3"}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, old))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.zones[1]: Forbidden: zone index 1 belongs to zone 'z2'"))
+		})
+
+		It("rejects reordering zones", func() {
+			qsts.Spec.Zones = []string{"z2", "z1", "z3"}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, old))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.zones[0]: Forbidden"))
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.zones[1]: Forbidden"))
+		})
+	})
+
+	Context("when other fields change", func() {
+		BeforeEach(func() {
+			old = qsts.DeepCopy()
+			qsts.Spec.UpdateOnConfigChange = true
+		})
+
+		It("allows the update", func() {
+			Expect(response.Allowed).To(BeTrue())
+		})
+	})
+
+	Context("with labels", func() {
+		It("rejects labels managed by the operator", func() {
+			qsts.Spec.Template.Spec.Template.Labels[qstsv1a1.LabelAZIndex] = "1"
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("label is managed by the operator"))
+		})
+
+		It("rejects invalid labels", func() {
+			qsts.Spec.Template.Spec.Template.Labels["in valid"] = "yes"
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("spec.template.spec.template.metadata.labels: Invalid value"))
+		})
+
+		It("rejects a selector which does not match the pod labels", func() {
+			qsts.Spec.Template.Spec.Selector.MatchLabels = map[string]string{"testpod": "no"}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("does not match the pod template labels"))
+		})
+	})
+
+	Context("with a canary size and rollout steps", func() {
+		It("allows numbers and percentages", func() {
+			qsts.Spec.Template.Annotations = map[string]string{
+				statefulset.AnnotationCanarySize:   "25%",
+				statefulset.AnnotationRolloutSteps: `[{"replicas":"50%","waitTime":"10m"},{"replicas":4}]`,
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("rejects invalid annotations", func() {
+			qsts.Spec.Template.Annotations = map[string]string{
+				statefulset.AnnotationCanarySize:   "half",
+				statefulset.AnnotationRolloutSteps: `[{"replicas":"most"}]`,
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("must be a number or a percentage of the replicas"))
+			Expect(string(response.Result.Reason)).To(ContainSubstring("invalid replicas of rollout step 0"))
+		})
+	})
+
+	Context("with rollout analysis", func() {
+		BeforeEach(func() {
+			statefulset.PrometheusAddresses = []string{"http://prometheus:9090/"}
+		})
+
+		AfterEach(func() {
+			statefulset.PrometheusAddresses = nil
+		})
+
+		It("allows gates with a single check", func() {
+			qsts.Spec.Template.Annotations = map[string]string{
+				statefulset.AnnotationRolloutAnalysis: `[{"name":"health","http":{"path":"/health","port":8080}},{"name":"errors","prometheus":{"address":"http://prometheus:9090","query":"up","successCondition":">= 1"}}]`,
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeTrue())
+		})
+
+		It("rejects gates without a check", func() {
+			qsts.Spec.Template.Annotations = map[string]string{
+				statefulset.AnnotationRolloutAnalysis: `[{"name":"health"}]`,
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("analysis gate 'health' needs exactly one of exec, http or prometheus"))
+		})
+
+		It("rejects prometheus addresses, which the operator doesn't allow", func() {
+			qsts.Spec.Template.Annotations = map[string]string{
+				statefulset.AnnotationRolloutAnalysis: `[{"name":"errors","prometheus":{"address":"http://169.254.169.254","query":"up","successCondition":">= 1"}}]`,
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("analysis gate 'errors' uses the prometheus address 'http://169.254.169.254', which is not allowed by the operator"))
+		})
+
+		It("rejects invalid success conditions", func() {
+			qsts.Spec.Template.Annotations = map[string]string{
+				statefulset.AnnotationRolloutAnalysis: `[{"name":"errors","prometheus":{"address":"http://prometheus:9090","query":"up","successCondition":"about 1"}}]`,
+			}
+			response = validator.Handle(ctx, newAdmissionRequest("v1alpha1", &qsts, nil))
+
+			Expect(response.Allowed).To(BeFalse())
+			Expect(string(response.Result.Reason)).To(ContainSubstring("invalid success condition 'about 1'"))
+		})
+	})
+})
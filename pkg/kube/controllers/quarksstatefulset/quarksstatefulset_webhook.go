@@ -0,0 +1,50 @@
+package quarksstatefulset
+
+import (
+	"go.uber.org/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	qstsv1b1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1beta1"
+	"code.cloudfoundry.org/quarks-utils/pkg/config"
+	"code.cloudfoundry.org/quarks-utils/pkg/monitorednamespace"
+	"code.cloudfoundry.org/quarks-utils/pkg/names"
+	wh "code.cloudfoundry.org/quarks-utils/pkg/webhook"
+)
+
+// NewQuarksStatefulSetValidator creates a validating webhook, which rejects invalid QuarksStatefulSets
+func NewQuarksStatefulSetValidator(log *zap.SugaredLogger, config *config.Config) *wh.OperatorWebhook {
+	quarksStatefulSetValidator := NewValidator(log, config)
+
+	scope := admissionregistration.NamespacedScope
+	return &wh.OperatorWebhook{
+		FailurePolicy: admissionregistration.Fail,
+		Rules: []admissionregistration.RuleWithOperations{
+			{
+				Rule: admissionregistration.Rule{
+					APIGroups:   []string{names.GroupName},
+					APIVersions: []string{qstsv1a1.SchemeGroupVersion.Version, qstsv1b1.SchemeGroupVersion.Version},
+					Resources:   []string{qstsv1a1.QuarksStatefulSetResourcePlural},
+					Scope:       &scope,
+				},
+				Operations: []admissionregistration.OperationType{
+					"CREATE",
+					"UPDATE",
+				},
+			},
+		},
+		Path: "/validate-quarksstatefulsets",
+		Name: "validate-quarksstatefulsets." + names.GroupName,
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				monitorednamespace.LabelNamespace: config.MonitoredID,
+			},
+		},
+		Webhook: &admission.Webhook{
+			Handler: quarksStatefulSetValidator,
+		},
+	}
+}
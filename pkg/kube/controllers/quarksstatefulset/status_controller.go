@@ -55,5 +55,28 @@ func AddQuarksStatefulSetStatus(ctx context.Context, config *config.Config, mgr
 		return errors.Wrapf(err, "Watching secrets failed in QuarksStatefulSetStatus controller failed.")
 	}
 
+	// The conditions depend on the generation and the observed generation,
+	// which is only set after the StatefulSets have been updated
+	generationPred := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return true
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			o := e.ObjectOld.(*qstsv1a1.QuarksStatefulSet)
+			n := e.ObjectNew.(*qstsv1a1.QuarksStatefulSet)
+			return o.Generation != n.Generation || o.Status.ObservedGeneration != n.Status.ObservedGeneration
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+	err = c.Watch(&source.Kind{Type: &qstsv1a1.QuarksStatefulSet{}}, &handler.EnqueueRequestForObject{}, nsPred, generationPred)
+	if err != nil {
+		return errors.Wrapf(err, "Watching QuarksStatefulSets failed in QuarksStatefulSetStatus controller.")
+	}
+
 	return nil
 }
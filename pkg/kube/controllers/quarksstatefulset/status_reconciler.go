@@ -2,15 +2,24 @@ package quarksstatefulset
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/statefulset"
 	"code.cloudfoundry.org/quarks-utils/pkg/config"
 	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
 )
@@ -69,29 +78,191 @@ func (r *ReconcileQuarksStatefulSetStatus) Reconcile(_ context.Context, request
 		return reconcile.Result{}, errors.Wrapf(err, "couldn't get latest StatefulSet")
 	}
 
-	if len(statefulSets) > 0 {
-		readyStsCnt := 0
-		for _, statefulSet := range statefulSets {
-			replicas := int32(1)
-			if statefulSet.Spec.Replicas != nil {
-				replicas = *statefulSet.Spec.Replicas
-			}
+	oldStatus := qStatefulSet.Status.DeepCopy()
+	updateStatus(qStatefulSet, statefulSets)
 
-			if statefulSet.Status.ReadyReplicas != replicas {
-				break
-			}
-			readyStsCnt++
+	if !reflect.DeepEqual(oldStatus, &qStatefulSet.Status) {
+		err = r.client.Status().Update(ctx, qStatefulSet)
+		if apierrors.IsConflict(err) {
+			ctxlog.Debugf(ctx, "Requeue, QuarksStatefulSet '%s' changed while updating its status", request.NamespacedName)
+			return reconcile.Result{Requeue: true}, nil
+		}
+		if err != nil {
+			ctxlog.WithEvent(qStatefulSet, "UpdateStatusError").Errorf(ctx, "Failed to update status on QuarksStatefulSet '%s' (%v): %s", request.NamespacedName, qStatefulSet.ResourceVersion, err)
+			return reconcile.Result{Requeue: false}, nil
+		}
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// updateStatus sets the ready flag, the replicas and the conditions of the
+// QuarksStatefulSet from the state of its latest StatefulSets
+func updateStatus(qStatefulSet *qstsv1a1.QuarksStatefulSet, statefulSets []*appsv1.StatefulSet) {
+	notReady := []string{}
+	progressing := []string{}
+	failed := []string{}
+	rolledBack := []string{}
+
+	for _, statefulSet := range statefulSets {
+		// GetMaxStatefulSetVersion returns an unnamed default, if there are no StatefulSets yet
+		if statefulSet.Name == "" {
+			notReady = append(notReady, qStatefulSet.Name)
+			continue
+		}
+
+		replicas := int32(1)
+		if statefulSet.Spec.Replicas != nil {
+			replicas = *statefulSet.Spec.Replicas
 		}
 
-		if readyStsCnt == len(statefulSets) {
-			qStatefulSet.Status.Ready = true
-			err = r.client.Status().Update(ctx, qStatefulSet)
-			if err != nil {
-				ctxlog.WithEvent(qStatefulSet, "UpdateStatusError").Errorf(ctx, "Failed to update status on QuarksStatefulSet '%s' (%v): %s", request.NamespacedName, qStatefulSet.ResourceVersion, err)
-				return reconcile.Result{Requeue: false}, nil
+		if statefulSet.Status.ReadyReplicas < replicas {
+			notReady = append(notReady, statefulSet.Name)
+		}
+		if statefulSet.Status.ObservedGeneration < statefulSet.Generation ||
+			statefulSet.Status.UpdatedReplicas < replicas ||
+			statefulset.RolloutInProgress(statefulSet) {
+			progressing = append(progressing, statefulSet.Name)
+		} else if waitingFor, ok := statefulSet.Annotations[qstsv1a1.AnnotationWaitingForZone]; ok {
+			progressing = append(progressing, fmt.Sprintf("%s (waiting for %s)", statefulSet.Name, waitingFor))
+		}
+		if statefulset.RolloutFailed(statefulSet) {
+			failed = append(failed, statefulSet.Name)
+		}
+		if revision, ok := statefulSet.Annotations[qstsv1a1.AnnotationRolledBackRevision]; ok {
+			rolledBack = append(rolledBack, fmt.Sprintf("%s (revision %s)", statefulSet.Name, revision))
+		}
+	}
+
+	status := &qStatefulSet.Status
+	status.Ready = len(notReady) == 0
+	status.Zones = zoneStatuses(qStatefulSet, statefulSets)
+
+	// The scale subresource works on spec.template.spec.replicas, while the
+	// selector matches the pods of all zones. The per pod metrics of an
+	// autoscaler are averaged over all zones.
+	status.Replicas = scaleReplicas(qStatefulSet, statefulSets)
+	status.Selector = ""
+	if selector, err := podSelector(qStatefulSet); err == nil {
+		status.Selector = selector.String()
+	}
+	generation := status.ObservedGeneration
+
+	if status.Ready {
+		setCondition(status, qstsv1a1.ConditionAvailable, metav1.ConditionTrue, "ReplicasReady",
+			"All StatefulSets have their desired replicas ready")
+	} else {
+		setCondition(status, qstsv1a1.ConditionAvailable, metav1.ConditionFalse, "ReplicasNotReady",
+			fmt.Sprintf("StatefulSets with replicas not ready: %s", strings.Join(notReady, ", ")))
+	}
+
+	switch {
+	case zoneReorderRefused(qStatefulSet):
+		// The reconciler refused the generation, it stays until the zones are fixed
+	case generation < qStatefulSet.Generation:
+		setCondition(status, qstsv1a1.ConditionProgressing, metav1.ConditionTrue, "SpecChangePending",
+			fmt.Sprintf("Generation %d has not been applied to the StatefulSets yet", qStatefulSet.Generation))
+	case len(progressing) > 0:
+		setCondition(status, qstsv1a1.ConditionProgressing, metav1.ConditionTrue, "RolloutInProgress",
+			fmt.Sprintf("StatefulSets rolling out: %s", strings.Join(progressing, ", ")))
+	default:
+		setCondition(status, qstsv1a1.ConditionProgressing, metav1.ConditionFalse, "RolloutComplete",
+			"All StatefulSets are up to date")
+	}
+
+	if len(failed) > 0 {
+		setCondition(status, qstsv1a1.ConditionRolloutFailed, metav1.ConditionTrue, "CanaryRolloutFailed",
+			fmt.Sprintf("StatefulSets with failed rollout: %s", strings.Join(failed, ", ")))
+	} else {
+		setCondition(status, qstsv1a1.ConditionRolloutFailed, metav1.ConditionFalse, "NoRolloutFailure", "")
+	}
+
+	if len(rolledBack) > 0 {
+		setCondition(status, qstsv1a1.ConditionRolledBack, metav1.ConditionTrue, "FailedRolloutRolledBack",
+			fmt.Sprintf("StatefulSets rolled back to the previous pod template: %s", strings.Join(rolledBack, ", ")))
+	} else {
+		setCondition(status, qstsv1a1.ConditionRolledBack, metav1.ConditionFalse, "NoRollback", "")
+	}
+
+	switch {
+	case len(qStatefulSet.Spec.Zones) == 0:
+		setCondition(status, qstsv1a1.ConditionZoneDegraded, metav1.ConditionFalse, "NoZones", "")
+	case len(notReady) > 0:
+		degraded := []string{}
+		for _, zone := range status.Zones {
+			if zone.ReadyReplicas < zone.Replicas {
+				degraded = append(degraded, fmt.Sprintf("%s (%d/%d ready)", zone.Name, zone.ReadyReplicas, zone.Replicas))
 			}
 		}
+		setCondition(status, qstsv1a1.ConditionZoneDegraded, metav1.ConditionTrue, "ZoneReplicasNotReady",
+			fmt.Sprintf("Zones with replicas not ready: %s", strings.Join(degraded, ", ")))
+	default:
+		setCondition(status, qstsv1a1.ConditionZoneDegraded, metav1.ConditionFalse, "AllZonesReady", "")
 	}
 
-	return reconcile.Result{}, nil
+	failedOver := []string{}
+	for _, zone := range status.Zones {
+		if zone.FailedOver {
+			failedOver = append(failedOver, zone.Name)
+		}
+	}
+	if len(failedOver) > 0 {
+		setCondition(status, qstsv1a1.ConditionZoneFailover, metav1.ConditionTrue, "ZoneFailedOver",
+			fmt.Sprintf("Zones with replicas moved to the other zones: %s", strings.Join(failedOver, ", ")))
+	} else {
+		setCondition(status, qstsv1a1.ConditionZoneFailover, metav1.ConditionFalse, "NoZoneFailedOver", "")
+	}
+}
+
+// zoneStatuses returns the state of the StatefulSet of each zone, ordered by
+// zone index
+func zoneStatuses(qStatefulSet *qstsv1a1.QuarksStatefulSet, statefulSets []*appsv1.StatefulSet) []qstsv1a1.ZoneStatus {
+	if len(qStatefulSet.Spec.Zones) == 0 {
+		return nil
+	}
+
+	zones := []qstsv1a1.ZoneStatus{}
+	for _, statefulSet := range statefulSets {
+		zoneName, ok := statefulSet.Labels[qstsv1a1.LabelAZName]
+		if !ok {
+			continue
+		}
+		zoneIndex, err := strconv.Atoi(statefulSet.Labels[qstsv1a1.LabelAZIndex])
+		if err != nil {
+			continue
+		}
+
+		replicas := int32(1)
+		if statefulSet.Spec.Replicas != nil {
+			replicas = *statefulSet.Spec.Replicas
+		}
+		_, failedOver := statefulSet.Annotations[qstsv1a1.AnnotationZoneFailedOver]
+
+		zones = append(zones, qstsv1a1.ZoneStatus{
+			Name:            zoneName,
+			Index:           zoneIndex,
+			StatefulSetName: statefulSet.Name,
+			Replicas:        replicas,
+			ReadyReplicas:   statefulSet.Status.ReadyReplicas,
+			UpdatedReplicas: statefulSet.Status.UpdatedReplicas,
+			RolloutState:    statefulSet.Annotations[statefulset.AnnotationCanaryRollout],
+			Version:         statefulSet.Annotations[qstsv1a1.AnnotationVersion],
+			FailedOver:      failedOver,
+		})
+	}
+
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Index < zones[j].Index })
+	return zones
+}
+
+// setCondition adds or updates a condition, the transition time only changes
+// if the status of the condition changes
+func setCondition(status *qstsv1a1.QuarksStatefulSetStatus, conditionType string, conditionStatus metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: status.ObservedGeneration,
+		Reason:             reason,
+		Message:            message,
+	})
 }
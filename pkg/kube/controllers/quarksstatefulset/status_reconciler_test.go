@@ -11,6 +11,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -22,6 +23,7 @@ import (
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers"
 	cfakes "code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/fakes"
 	qstscontroller "code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/quarksstatefulset"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/statefulset"
 	cfcfg "code.cloudfoundry.org/quarks-utils/pkg/config"
 	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
 	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
@@ -37,9 +39,12 @@ var _ = Describe("ReconcileQuarksStatefulSet", func() {
 		log        *zap.SugaredLogger
 		config     *cfcfg.Config
 		client     *cfakes.FakeClient
+		status     *cfakes.FakeStatusWriter
 
 		desiredQStatefulSet *qstsv1a1.QuarksStatefulSet
 		sts                 *appsv1.StatefulSet
+		otherStatefulSets   []appsv1.StatefulSet
+		updatedStatus       qstsv1a1.QuarksStatefulSetStatus
 	)
 
 	BeforeEach(func() {
@@ -65,7 +70,7 @@ var _ = Describe("ReconcileQuarksStatefulSet", func() {
 			switch object := object.(type) {
 			case *appsv1.StatefulSetList:
 				list := appsv1.StatefulSetList{
-					Items: []appsv1.StatefulSet{*sts},
+					Items: append([]appsv1.StatefulSet{*sts}, otherStatefulSets...),
 				}
 				list.DeepCopyInto(object)
 			}
@@ -73,7 +78,47 @@ var _ = Describe("ReconcileQuarksStatefulSet", func() {
 		})
 		manager.GetClientReturns(client)
 
-		client.StatusCalls(func() crc.StatusWriter { return &cfakes.FakeStatusWriter{} })
+		otherStatefulSets = nil
+		status = &cfakes.FakeStatusWriter{}
+		status.UpdateCalls(func(context context.Context, object crc.Object, _ ...crc.UpdateOption) error {
+			object.(*qstsv1a1.QuarksStatefulSet).Status.DeepCopyInto(&updatedStatus)
+			return nil
+		})
+		client.StatusCalls(func() crc.StatusWriter { return status })
+
+		sts = &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "default",
+				Annotations: map[string]string{
+					qstsv1a1.AnnotationVersion: "1",
+				},
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						Name:               "foo",
+						Kind:               "QuarksStatefulSet",
+						UID:                "",
+						Controller:         pointers.Bool(true),
+						BlockOwnerDeletion: pointers.Bool(true),
+					},
+				},
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: pointers.Int32(2),
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name: "test-container",
+						}},
+					},
+				},
+			},
+			Status: appsv1.StatefulSetStatus{
+				Replicas:        2,
+				ReadyReplicas:   2,
+				UpdatedReplicas: 2,
+			},
+		}
 	})
 
 	JustBeforeEach(func() {
@@ -102,51 +147,323 @@ var _ = Describe("ReconcileQuarksStatefulSet", func() {
 	})
 
 	Context("Provides a quarksStatefulSet definition", func() {
+		It("marks the quarksStatefulSet as ready and available", func() {
+			result, err := reconciler.Reconcile(context.Background(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(reconcile.Result{}))
 
-		It("updates new statefulSet and continues to reconcile when new version is not available", func() {
-			sts = &appsv1.StatefulSet{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "foo",
-					Namespace: "default",
-					Annotations: map[string]string{
-						qstsv1a1.AnnotationVersion: "1",
-					},
-					OwnerReferences: []metav1.OwnerReference{
-						{
-							Name:               "foo",
-							Kind:               "QuarksStatefulSet",
-							UID:                "",
-							Controller:         pointers.Bool(true),
-							BlockOwnerDeletion: pointers.Bool(true),
-						},
+			Expect(status.UpdateCallCount()).To(Equal(1))
+			Expect(updatedStatus.Ready).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(updatedStatus.Conditions, qstsv1a1.ConditionAvailable)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(updatedStatus.Conditions, qstsv1a1.ConditionProgressing)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(updatedStatus.Conditions, qstsv1a1.ConditionRolloutFailed)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(updatedStatus.Conditions, qstsv1a1.ConditionRolledBack)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(updatedStatus.Conditions, qstsv1a1.ConditionZoneDegraded)).To(BeTrue())
+		})
+
+		It("reports the replicas and the pod selector for the scale subresource", func() {
+			_, err := reconciler.Reconcile(context.Background(), request)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(updatedStatus.Replicas).To(Equal(int32(2)))
+			Expect(updatedStatus.Selector).To(Equal("quarks.cloudfoundry.org/quarks-statefulset-name in (foo)"))
+		})
+
+		It("does not update the status if nothing changed", func() {
+			_, err := reconciler.Reconcile(context.Background(), request)
+			Expect(err).ToNot(HaveOccurred())
+			desiredQStatefulSet.Status = updatedStatus
+
+			_, err = reconciler.Reconcile(context.Background(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.UpdateCallCount()).To(Equal(1))
+		})
+
+		It("requeues if the quarksStatefulSet changed in the meantime", func() {
+			status.UpdateReturns(apierrors.NewConflict(schema.GroupResource{}, "foo", nil))
+			result, err := reconciler.Reconcile(context.Background(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Requeue).To(BeTrue())
+		})
+
+		When("the quarksStatefulSet was ready before and a replica is not ready anymore", func() {
+			BeforeEach(func() {
+				sts.Status.ReadyReplicas = 1
+			})
+
+			JustBeforeEach(func() {
+				desiredQStatefulSet.Status.Ready = true
+			})
+
+			It("marks the quarksStatefulSet as not ready", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(updatedStatus.Ready).To(BeFalse())
+				Expect(meta.IsStatusConditionFalse(updatedStatus.Conditions, qstsv1a1.ConditionAvailable)).To(BeTrue())
+			})
+		})
+
+		When("the generation has not been applied yet", func() {
+			JustBeforeEach(func() {
+				desiredQStatefulSet.Generation = 2
+				desiredQStatefulSet.Status.ObservedGeneration = 1
+			})
+
+			It("is progressing", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				condition := meta.FindStatusCondition(updatedStatus.Conditions, qstsv1a1.ConditionProgressing)
+				Expect(condition).ToNot(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				Expect(condition.Reason).To(Equal("SpecChangePending"))
+				Expect(condition.ObservedGeneration).To(Equal(int64(1)))
+			})
+		})
+
+		When("the reconciler refused the generation, because the zones were reordered", func() {
+			JustBeforeEach(func() {
+				desiredQStatefulSet.Generation = 2
+				desiredQStatefulSet.Status.ObservedGeneration = 1
+				desiredQStatefulSet.Status.Conditions = []metav1.Condition{{
+					Type:               qstsv1a1.ConditionProgressing,
+					Status:             metav1.ConditionFalse,
+					ObservedGeneration: 2,
+					Reason:             "ZoneReorderRefused",
+					Message:            "Zones can only be appended or removed from the end",
+				}}
+			})
+
+			It("keeps the condition", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				condition := meta.FindStatusCondition(updatedStatus.Conditions, qstsv1a1.ConditionProgressing)
+				Expect(condition).ToNot(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+				Expect(condition.Reason).To(Equal("ZoneReorderRefused"))
+			})
+		})
+
+		When("the statefulSet is rolling out", func() {
+			BeforeEach(func() {
+				sts.Annotations[statefulset.AnnotationCanaryRollout] = "Canary"
+				sts.Status.UpdatedReplicas = 1
+			})
+
+			It("is progressing", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				condition := meta.FindStatusCondition(updatedStatus.Conditions, qstsv1a1.ConditionProgressing)
+				Expect(condition).ToNot(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				Expect(condition.Reason).To(Equal("RolloutInProgress"))
+			})
+		})
+
+		When("the statefulSet waits for the rollout of another zone", func() {
+			BeforeEach(func() {
+				sts.Annotations[qstsv1a1.AnnotationWaitingForZone] = "foo-z0"
+			})
+
+			It("is progressing", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				condition := meta.FindStatusCondition(updatedStatus.Conditions, qstsv1a1.ConditionProgressing)
+				Expect(condition).ToNot(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				Expect(condition.Message).To(ContainSubstring("foo (waiting for foo-z0)"))
+			})
+		})
+
+		When("the rollout of the statefulSet failed", func() {
+			BeforeEach(func() {
+				sts.Annotations[statefulset.AnnotationCanaryRollout] = "Failed"
+			})
+
+			It("sets the rollout failed condition", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				condition := meta.FindStatusCondition(updatedStatus.Conditions, qstsv1a1.ConditionRolloutFailed)
+				Expect(condition).ToNot(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				Expect(condition.Message).To(ContainSubstring("foo"))
+			})
+		})
+
+		When("the failed rollout of the statefulSet was rolled back", func() {
+			BeforeEach(func() {
+				sts.Annotations[qstsv1a1.AnnotationRolledBackRevision] = "foo-7d9c"
+			})
+
+			It("sets the rolled back condition", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				condition := meta.FindStatusCondition(updatedStatus.Conditions, qstsv1a1.ConditionRolledBack)
+				Expect(condition).ToNot(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				Expect(condition.Message).To(ContainSubstring("foo (revision foo-7d9c)"))
+			})
+		})
+
+		When("a zone is not ready", func() {
+			BeforeEach(func() {
+				sts.Name = "foo-z1"
+				sts.Labels = map[string]string{
+					qstsv1a1.LabelAZName:  "z1",
+					qstsv1a1.LabelAZIndex: "1",
+				}
+				sts.Annotations[statefulset.AnnotationCanaryRollout] = "Canary"
+				sts.Status.ReadyReplicas = 0
+
+				z0 := sts.DeepCopy()
+				z0.Name = "foo-z0"
+				z0.Labels = map[string]string{
+					qstsv1a1.LabelAZName:  "z0",
+					qstsv1a1.LabelAZIndex: "0",
+				}
+				z0.Annotations[statefulset.AnnotationCanaryRollout] = "Done"
+				z0.Status.ReadyReplicas = 2
+				otherStatefulSets = []appsv1.StatefulSet{*z0}
+			})
+
+			JustBeforeEach(func() {
+				desiredQStatefulSet.Spec.Zones = []string{"z0", "z1"}
+			})
+
+			It("sets the zone degraded condition", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				condition := meta.FindStatusCondition(updatedStatus.Conditions, qstsv1a1.ConditionZoneDegraded)
+				Expect(condition).ToNot(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				Expect(condition.Message).To(ContainSubstring("z1 (0/2 ready)"))
+				Expect(condition.Message).ToNot(ContainSubstring("z0"))
+			})
+
+			It("lists the status of each zone", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(updatedStatus.Zones).To(Equal([]qstsv1a1.ZoneStatus{
+					{
+						Name:            "z0",
+						Index:           0,
+						StatefulSetName: "foo-z0",
+						Replicas:        2,
+						ReadyReplicas:   2,
+						UpdatedReplicas: 2,
+						RolloutState:    "Done",
+						Version:         "1",
 					},
-				},
-				Spec: appsv1.StatefulSetSpec{
-					Replicas: pointers.Int32(2),
-					Template: corev1.PodTemplateSpec{
-						Spec: corev1.PodSpec{
-							Containers: []corev1.Container{{
-								Name: "test-container",
-							}},
-						},
+					{
+						Name:            "z1",
+						Index:           1,
+						StatefulSetName: "foo-z1",
+						Replicas:        2,
+						ReadyReplicas:   0,
+						UpdatedReplicas: 2,
+						RolloutState:    "Canary",
+						Version:         "1",
 					},
-				},
-				Status: appsv1.StatefulSetStatus{
-					Replicas:      2,
-					ReadyReplicas: 2,
-				},
-			}
+				}))
+			})
 
-			client.UpdateCalls(func(context context.Context, object crc.Object, _ ...crc.UpdateOption) error {
-				switch qSts := object.(type) {
-				case *qstsv1a1.QuarksStatefulSet:
-					Expect(qSts.Status.Ready).To(BeTrue())
-				}
-				return nil
+			When("the failed rollout of one zone was rolled back", func() {
+				BeforeEach(func() {
+					sts.Annotations[statefulset.AnnotationCanaryRollout] = "Pending"
+					sts.Annotations[qstsv1a1.AnnotationRolledBackRevision] = "foo-z1-7d9c"
+				})
+
+				It("still reports both zones", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(updatedStatus.Zones).To(HaveLen(2))
+					Expect(updatedStatus.Zones[0].StatefulSetName).To(Equal("foo-z0"))
+					Expect(updatedStatus.Zones[1].StatefulSetName).To(Equal("foo-z1"))
+					Expect(updatedStatus.Selector).To(Equal("quarks.cloudfoundry.org/quarks-statefulset-name in (foo-z0,foo-z1)"))
+
+					condition := meta.FindStatusCondition(updatedStatus.Conditions, qstsv1a1.ConditionRolledBack)
+					Expect(condition).ToNot(BeNil())
+					Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				})
+			})
+
+			It("reports the replicas per zone and selects the pods of all zones", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(updatedStatus.Replicas).To(Equal(int32(2)))
+				Expect(updatedStatus.Selector).To(Equal("quarks.cloudfoundry.org/quarks-statefulset-name in (foo-z0,foo-z1)"))
+			})
+
+			When("the replicas are distributed across the zones", func() {
+				JustBeforeEach(func() {
+					desiredQStatefulSet.Spec.ZoneReplicas = &qstsv1a1.ZoneReplicasSpec{Distribute: true}
+				})
+
+				It("reports the replicas of all zones", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(updatedStatus.Replicas).To(Equal(int32(4)))
+				})
+			})
+
+			When("a zone overrides the replicas", func() {
+				BeforeEach(func() {
+					otherStatefulSets[0].Status.Replicas = 5
+				})
+
+				JustBeforeEach(func() {
+					desiredQStatefulSet.Spec.ZoneReplicas = &qstsv1a1.ZoneReplicasSpec{
+						Zones: []qstsv1a1.ZoneReplicas{{Name: "z0", Replicas: pointers.Int32(5)}},
+					}
+				})
+
+				It("reports the replicas of the zones running the template replicas", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(updatedStatus.Replicas).To(Equal(int32(2)))
+				})
+			})
+
+			It("does not report a zone failover", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+
+				condition := meta.FindStatusCondition(updatedStatus.Conditions, qstsv1a1.ConditionZoneFailover)
+				Expect(condition).ToNot(BeNil())
+				Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			})
+
+			When("a zone failed over", func() {
+				BeforeEach(func() {
+					sts.Annotations[qstsv1a1.AnnotationZoneFailedOver] = "true"
+				})
+
+				It("marks the zone and sets the zone failover condition", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(updatedStatus.Zones[0].FailedOver).To(BeFalse())
+					Expect(updatedStatus.Zones[1].FailedOver).To(BeTrue())
+
+					condition := meta.FindStatusCondition(updatedStatus.Conditions, qstsv1a1.ConditionZoneFailover)
+					Expect(condition).ToNot(BeNil())
+					Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+					Expect(condition.Reason).To(Equal("ZoneFailedOver"))
+					Expect(condition.Message).To(Equal("Zones with replicas moved to the other zones: z1"))
+				})
 			})
-			result, err := reconciler.Reconcile(context.Background(), request)
-			Expect(err).ToNot(HaveOccurred())
-			Expect(result).To(Equal(reconcile.Result{}))
 		})
 	})
 })
@@ -2,11 +2,13 @@ package quarksstatefulset
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
 	crc "sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -71,6 +73,14 @@ func GetMaxStatefulSetVersion(ctx context.Context, client crc.Client, qStatefulS
 	return result, maxVersion, nil
 }
 
+// zoneNodeLabel returns the node label containing the zone of a node
+func zoneNodeLabel(qStatefulSet *qstsv1a1.QuarksStatefulSet) string {
+	if qStatefulSet.Spec.ZoneNodeLabel == "" {
+		return qstsv1a1.DefaultZoneNodeLabel
+	}
+	return qStatefulSet.Spec.ZoneNodeLabel
+}
+
 // listStatefulSetsFromInformer gets StatefulSets cross version owned by the QuarksStatefulSet from informer
 func listStatefulSetsFromInformer(ctx context.Context, client crc.Client, qStatefulSet *qstsv1a1.QuarksStatefulSet) ([]appsv1.StatefulSet, error) {
 	allStatefulSets := &appsv1.StatefulSetList{}
@@ -106,3 +116,53 @@ func filterByOwner(qStatefulSet *qstsv1a1.QuarksStatefulSet, statefulSets []apps
 
 	return result, nil
 }
+
+// statefulSetName returns the name of the StatefulSet for the zone, or the
+// name of the QuarksStatefulSet if it has no zones
+func statefulSetName(qStatefulSet *qstsv1a1.QuarksStatefulSet, zoneIndex int) string {
+	if len(qStatefulSet.Spec.Zones) == 0 {
+		return qStatefulSet.GetName()
+	}
+	return fmt.Sprintf("%s-z%d", qStatefulSet.GetName(), zoneIndex)
+}
+
+// quarksStatefulSetOfPod returns the name of the QuarksStatefulSet of a
+// pod. Without zones, the StatefulSet has the name of the QuarksStatefulSet.
+func quarksStatefulSetOfPod(podLabels map[string]string) string {
+	if name, ok := podLabels[qstsv1a1.LabelQuarksStatefulSet]; ok {
+		return name
+	}
+	return podLabels[qstsv1a1.LabelQStsName]
+}
+
+// quarksStatefulSetPodLabels returns the labels, which select the pods of
+// all zones of the QuarksStatefulSet
+func quarksStatefulSetPodLabels(qStatefulSet *qstsv1a1.QuarksStatefulSet) map[string]string {
+	if len(qStatefulSet.Spec.Zones) > 0 {
+		return map[string]string{qstsv1a1.LabelQuarksStatefulSet: qStatefulSet.Name}
+	}
+	return map[string]string{qstsv1a1.LabelQStsName: qStatefulSet.Name}
+}
+
+// podLabelSelector returns a label selector for the pods of the
+// StatefulSets of all zones
+func podLabelSelector(qStatefulSet *qstsv1a1.QuarksStatefulSet) *metav1.LabelSelector {
+	names := []string{statefulSetName(qStatefulSet, 0)}
+	for zoneIndex := 1; zoneIndex < len(qStatefulSet.Spec.Zones); zoneIndex++ {
+		names = append(names, statefulSetName(qStatefulSet, zoneIndex))
+	}
+
+	return &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      qstsv1a1.LabelQStsName,
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   names,
+		}},
+	}
+}
+
+// podSelector returns a selector for the pods of the StatefulSets of all
+// zones
+func podSelector(qStatefulSet *qstsv1a1.QuarksStatefulSet) (labels.Selector, error) {
+	return metav1.LabelSelectorAsSelector(podLabelSelector(qStatefulSet))
+}
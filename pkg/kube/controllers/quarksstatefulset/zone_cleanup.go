@@ -0,0 +1,187 @@
+package quarksstatefulset
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
+)
+
+// reasonZoneReorderRefused is the reason of the progressing condition, if
+// the zones were reordered
+const reasonZoneReorderRefused = "ZoneReorderRefused"
+
+// checkZoneIdentity makes sure the StatefulSet of a zone index still belongs
+// to the same zone. The zone index is part of the StatefulSet name, so
+// reordering zones or removing a zone, which is not the last one, would move
+// the pods of a StatefulSet to another zone.
+func checkZoneIdentity(qStatefulSet *qstsv1a1.QuarksStatefulSet, statefulSets []appsv1.StatefulSet) error {
+	for _, statefulSet := range statefulSets {
+		zoneName, ok := statefulSet.Labels[qstsv1a1.LabelAZName]
+		if !ok {
+			continue
+		}
+		zoneIndex, err := strconv.Atoi(statefulSet.Labels[qstsv1a1.LabelAZIndex])
+		if err != nil || zoneIndex >= len(qStatefulSet.Spec.Zones) {
+			continue
+		}
+
+		if statefulSet.Name == statefulSetName(qStatefulSet, zoneIndex) && qStatefulSet.Spec.Zones[zoneIndex] != zoneName {
+			return errors.Errorf("StatefulSet '%s' runs in zone '%s', but zone index %d is now '%s'. Zones can only be appended or removed from the end",
+				statefulSet.Name, zoneName, zoneIndex, qStatefulSet.Spec.Zones[zoneIndex])
+		}
+	}
+	return nil
+}
+
+// refuseZoneReorder sets the progressing condition to false, so the refused
+// generation doesn't look like a pending spec change. The status reconciler
+// keeps the condition until the generation changes.
+func (r *ReconcileQuarksStatefulSet) refuseZoneReorder(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet, reason error) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := &qstsv1a1.QuarksStatefulSet{}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: qStatefulSet.Name, Namespace: qStatefulSet.Namespace}, latest); err != nil {
+			return err
+		}
+		if zoneReorderRefused(latest) {
+			return nil
+		}
+		meta.SetStatusCondition(&latest.Status.Conditions, metav1.Condition{
+			Type:               qstsv1a1.ConditionProgressing,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: qStatefulSet.Generation,
+			Reason:             reasonZoneReorderRefused,
+			Message:            reason.Error(),
+		})
+		return r.client.Status().Update(ctx, latest)
+	})
+}
+
+// zoneReorderRefused returns true if the reconciler refused the current
+// generation, because its zones were reordered
+func zoneReorderRefused(qStatefulSet *qstsv1a1.QuarksStatefulSet) bool {
+	condition := meta.FindStatusCondition(qStatefulSet.Status.Conditions, qstsv1a1.ConditionProgressing)
+	return condition != nil &&
+		condition.Reason == reasonZoneReorderRefused &&
+		condition.ObservedGeneration == qStatefulSet.Generation
+}
+
+// cleanupStatefulSets removes the StatefulSets, which are not desired
+// anymore, e.g. because their zone was removed. Unless disabled, the
+// StatefulSets are drained first. It returns true while a StatefulSet is
+// still draining.
+func (r *ReconcileQuarksStatefulSet) cleanupStatefulSets(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet, statefulSets []appsv1.StatefulSet, desiredStatefulSets []appsv1.StatefulSet) (bool, error) {
+	desired := map[string]bool{}
+	for _, statefulSet := range desiredStatefulSets {
+		desired[statefulSet.Name] = true
+	}
+
+	drain := true
+	pvcPolicy := qstsv1a1.PersistentVolumeClaimRetain
+	if removal := qStatefulSet.Spec.ZoneRemoval; removal != nil {
+		if removal.Drain != nil {
+			drain = *removal.Drain
+		}
+		if removal.PersistentVolumeClaimPolicy != "" {
+			pvcPolicy = removal.PersistentVolumeClaimPolicy
+		}
+	}
+
+	draining := false
+	for i := range statefulSets {
+		statefulSet := &statefulSets[i]
+		if desired[statefulSet.Name] {
+			continue
+		}
+
+		if drain {
+			if statefulSet.Spec.Replicas == nil || *statefulSet.Spec.Replicas > 0 {
+				ctxlog.Infof(ctx, "Scaling down StatefulSet '%s/%s', which is not desired anymore", statefulSet.Namespace, statefulSet.Name)
+				statefulSet.Spec.Replicas = pointers.Int32(0)
+				if err := r.client.Update(ctx, statefulSet); err != nil {
+					return draining, errors.Wrapf(err, "could not scale down StatefulSet '%s/%s'", statefulSet.Namespace, statefulSet.Name)
+				}
+				draining = true
+				continue
+			}
+			if statefulSet.Status.Replicas > 0 {
+				ctxlog.Debugf(ctx, "Waiting for the pods of StatefulSet '%s/%s' to terminate", statefulSet.Namespace, statefulSet.Name)
+				draining = true
+				continue
+			}
+		}
+
+		ctxlog.Infof(ctx, "Deleting StatefulSet '%s/%s', which is not desired anymore", statefulSet.Namespace, statefulSet.Name)
+		if err := r.client.Delete(ctx, statefulSet, crc.PropagationPolicy("Background")); err != nil && !apierrors.IsNotFound(err) {
+			return draining, errors.Wrapf(err, "could not delete StatefulSet '%s/%s'", statefulSet.Namespace, statefulSet.Name)
+		}
+
+		if pvcPolicy == qstsv1a1.PersistentVolumeClaimDelete {
+			if err := r.deletePersistentVolumeClaims(ctx, statefulSet); err != nil {
+				return draining, err
+			}
+		}
+	}
+
+	return draining, nil
+}
+
+// deletePersistentVolumeClaims deletes the claims created from the volume
+// claim templates of the StatefulSet. Their names are
+// '<template>-<statefulset>-<ordinal>' and they carry the labels of the
+// StatefulSet selector.
+func (r *ReconcileQuarksStatefulSet) deletePersistentVolumeClaims(ctx context.Context, statefulSet *appsv1.StatefulSet) error {
+	if len(statefulSet.Spec.VolumeClaimTemplates) == 0 || statefulSet.Spec.Selector == nil {
+		return nil
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	err := r.client.List(ctx, pvcs,
+		crc.InNamespace(statefulSet.Namespace),
+		crc.MatchingLabels(statefulSet.Spec.Selector.MatchLabels),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "could not list persistent volume claims of StatefulSet '%s/%s'", statefulSet.Namespace, statefulSet.Name)
+	}
+
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if !createdFromTemplate(pvc.Name, statefulSet) {
+			continue
+		}
+
+		ctxlog.Infof(ctx, "Deleting persistent volume claim '%s/%s' of StatefulSet '%s'", pvc.Namespace, pvc.Name, statefulSet.Name)
+		if err := r.client.Delete(ctx, pvc); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "could not delete persistent volume claim '%s/%s'", pvc.Namespace, pvc.Name)
+		}
+	}
+	return nil
+}
+
+// createdFromTemplate returns true if the claim name matches one of the
+// volume claim templates of the StatefulSet
+func createdFromTemplate(name string, statefulSet *appsv1.StatefulSet) bool {
+	for _, template := range statefulSet.Spec.VolumeClaimTemplates {
+		prefix := template.Name + "-" + statefulSet.Name + "-"
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimPrefix(name, prefix)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package quarksstatefulset
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	crc "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+	"code.cloudfoundry.org/quarks-utils/pkg/monitorednamespace"
+)
+
+// failedZones returns which zones, by zone index, failed over because none
+// of their nodes has been ready for longer than the failover delay. If a
+// zone is about to fail over, it also returns the time until the zone's
+// delay expires.
+//
+// Zones without any nodes are not considered, neither are zones at all, if
+// every zone failed. There would be no zone left to move the replicas to.
+func (r *ReconcileQuarksStatefulSet) failedZones(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet) ([]bool, time.Duration, error) {
+	failover := qStatefulSet.Spec.ZoneFailover
+	zones := qStatefulSet.Spec.Zones
+	if failover == nil || len(zones) < 2 {
+		return nil, 0, nil
+	}
+
+	delay := time.Duration(0)
+	if failover.Delay != nil {
+		delay = failover.Delay.Duration
+	}
+
+	label := zoneNodeLabel(qStatefulSet)
+	nodes := &corev1.NodeList{}
+	if err := r.client.List(ctx, nodes, crc.HasLabels{label}); err != nil {
+		return nil, 0, errors.Wrapf(err, "could not list nodes with label '%s'", label)
+	}
+
+	byZone := map[string][]corev1.Node{}
+	for _, node := range nodes.Items {
+		zone := node.Labels[label]
+		byZone[zone] = append(byZone[zone], node)
+	}
+
+	now := time.Now()
+	failed := make([]bool, len(zones))
+	failedCount := 0
+	requeueAfter := time.Duration(0)
+	for i, zone := range zones {
+		notReadySince, ok := zoneNotReadySince(byZone[zone])
+		if !ok {
+			continue
+		}
+
+		if remaining := notReadySince.Add(delay).Sub(now); remaining > 0 {
+			ctxlog.Debugf(ctx, "All nodes of zone '%s' are not ready, failing over in %s", zone, remaining)
+			if requeueAfter == 0 || remaining < requeueAfter {
+				requeueAfter = remaining
+			}
+			continue
+		}
+
+		failed[i] = true
+		failedCount++
+	}
+
+	if failedCount == len(zones) {
+		ctxlog.Infof(ctx, "All zones of QuarksStatefulSet '%s' are not ready, there is no zone to fail over to", qStatefulSet.GetNamespacedName())
+		return make([]bool, len(zones)), 0, nil
+	}
+
+	return failed, requeueAfter, nil
+}
+
+// zoneNotReadySince returns the time the last of the nodes became not
+// ready. It returns false, if there are no nodes or one of them is ready.
+func zoneNotReadySince(nodes []corev1.Node) (time.Time, bool) {
+	if len(nodes) == 0 {
+		return time.Time{}, false
+	}
+
+	since := time.Time{}
+	for _, node := range nodes {
+		ready, transition := nodeReady(node)
+		if ready {
+			return time.Time{}, false
+		}
+		if transition.After(since) {
+			since = transition
+		}
+	}
+	return since, true
+}
+
+// nodeReady returns true if pods can be scheduled on the node, and the
+// last transition of its Ready condition
+func nodeReady(node corev1.Node) (bool, time.Time) {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue && !node.Spec.Unschedulable, condition.LastTransitionTime.Time
+		}
+	}
+	return false, time.Time{}
+}
+
+// failoverReplicas moves the replicas of the failed zones to the other
+// zones. They are split evenly, the zones with the lower index get the
+// remainder.
+func failoverReplicas(replicas []int32, failed []bool) []int32 {
+	result := make([]int32, len(replicas))
+	copy(result, replicas)
+
+	moved := int32(0)
+	healthy := []int{}
+	for i := range replicas {
+		if i < len(failed) && failed[i] {
+			moved += replicas[i]
+			result[i] = 0
+			continue
+		}
+		healthy = append(healthy, i)
+	}
+	if moved == 0 || len(healthy) == 0 {
+		return result
+	}
+
+	share := moved / int32(len(healthy))
+	remainder := moved % int32(len(healthy))
+	for n, i := range healthy {
+		result[i] += share
+		if int32(n) < remainder {
+			result[i]++
+		}
+	}
+	return result
+}
+
+// recordFailoverEvents records an event for every zone, which failed over
+// or recovered since the StatefulSets were last updated
+func recordFailoverEvents(ctx context.Context, qStatefulSet *qstsv1a1.QuarksStatefulSet, statefulSets []appsv1.StatefulSet, failed []bool) {
+	failedOver := map[string]bool{}
+	for _, statefulSet := range statefulSets {
+		if _, ok := statefulSet.Annotations[qstsv1a1.AnnotationZoneFailedOver]; ok {
+			failedOver[statefulSet.Name] = true
+		}
+	}
+
+	for i, zone := range qStatefulSet.Spec.Zones {
+		wasFailed := failedOver[statefulSetName(qStatefulSet, i)]
+		isFailed := i < len(failed) && failed[i]
+
+		switch {
+		case isFailed && !wasFailed:
+			msg := "None of the nodes of zone '" + zone + "' are ready, moving its replicas to the other zones"
+			ctxlog.WarningEvent(ctx, qStatefulSet, "ZoneFailover", msg)
+			ctxlog.Infof(ctx, "QuarksStatefulSet '%s': %s", qStatefulSet.GetNamespacedName(), msg)
+		case !isFailed && wasFailed:
+			ctxlog.WithEvent(qStatefulSet, "ZoneRecovered").Infof(ctx, "Zone '%s' recovered, moving its replicas back", zone)
+		}
+	}
+}
+
+// nodeReconciles returns the QuarksStatefulSets in monitored namespaces,
+// which fail over zones and span the zone of the node
+func nodeReconciles(ctx context.Context, client crc.Client, node *corev1.Node, monitoredID string) ([]reconcile.Request, error) {
+	reconciles := []reconcile.Request{}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := client.List(ctx, namespaces, crc.MatchingLabels{monitorednamespace.LabelNamespace: monitoredID}); err != nil {
+		return reconciles, errors.Wrap(err, "could not list monitored namespaces")
+	}
+
+	for _, namespace := range namespaces.Items {
+		qStatefulSets := &qstsv1a1.QuarksStatefulSetList{}
+		if err := client.List(ctx, qStatefulSets, crc.InNamespace(namespace.Name)); err != nil {
+			return reconciles, errors.Wrapf(err, "could not list QuarksStatefulSets in namespace '%s'", namespace.Name)
+		}
+
+		for i := range qStatefulSets.Items {
+			qStatefulSet := &qStatefulSets.Items[i]
+			if qStatefulSet.Spec.ZoneFailover == nil {
+				continue
+			}
+
+			zone, ok := node.Labels[zoneNodeLabel(qStatefulSet)]
+			if !ok {
+				continue
+			}
+			for _, z := range qStatefulSet.Spec.Zones {
+				if z == zone {
+					reconciles = append(reconciles, reconcile.Request{
+						NamespacedName: types.NamespacedName{Name: qStatefulSet.Name, Namespace: qStatefulSet.Namespace},
+					})
+					break
+				}
+			}
+		}
+	}
+
+	return reconciles, nil
+}
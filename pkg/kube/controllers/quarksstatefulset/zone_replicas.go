@@ -0,0 +1,142 @@
+package quarksstatefulset
+
+import (
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+)
+
+// templateReplicas returns the replicas of the StatefulSet template,
+// defaulting to 1 like a StatefulSet
+func templateReplicas(qStatefulSet *qstsv1a1.QuarksStatefulSet) int32 {
+	if qStatefulSet.Spec.Template.Spec.Replicas == nil {
+		return 1
+	}
+	return *qStatefulSet.Spec.Template.Spec.Replicas
+}
+
+// zoneOverrides returns the replica settings of the zones by zone name
+func zoneOverrides(qStatefulSet *qstsv1a1.QuarksStatefulSet) map[string]qstsv1a1.ZoneReplicas {
+	overrides := map[string]qstsv1a1.ZoneReplicas{}
+	if qStatefulSet.Spec.ZoneReplicas == nil {
+		return overrides
+	}
+	for _, zone := range qStatefulSet.Spec.ZoneReplicas.Zones {
+		overrides[zone.Name] = zone
+	}
+	return overrides
+}
+
+// distributeReplicas returns true if the template replicas are the total
+// across all zones, instead of the replicas of each zone
+func distributeReplicas(qStatefulSet *qstsv1a1.QuarksStatefulSet) bool {
+	return qStatefulSet.Spec.ZoneReplicas != nil && qStatefulSet.Spec.ZoneReplicas.Distribute
+}
+
+// zoneReplicas returns the desired replicas of the StatefulSet of each zone,
+// ordered by zone index. Without zones there is a single StatefulSet.
+//
+// By default every zone runs the template replicas, unless the zone
+// overrides them. If the replicas are distributed, the template replicas
+// minus the overridden replicas are split across the other zones by weight,
+// using the largest remainder method. Ties go to the zone with the lower
+// index, so the result is stable.
+func zoneReplicas(qStatefulSet *qstsv1a1.QuarksStatefulSet) []int32 {
+	zones := qStatefulSet.Spec.Zones
+	if len(zones) == 0 {
+		return []int32{templateReplicas(qStatefulSet)}
+	}
+
+	overrides := zoneOverrides(qStatefulSet)
+	replicas := make([]int32, len(zones))
+
+	if !distributeReplicas(qStatefulSet) {
+		for i, zone := range zones {
+			replicas[i] = templateReplicas(qStatefulSet)
+			if override, ok := overrides[zone]; ok && override.Replicas != nil {
+				replicas[i] = *override.Replicas
+			}
+		}
+		return replicas
+	}
+
+	remaining := int64(templateReplicas(qStatefulSet))
+	weights := make([]int64, len(zones))
+	totalWeight := int64(0)
+	for i, zone := range zones {
+		override, ok := overrides[zone]
+		if ok && override.Replicas != nil {
+			replicas[i] = *override.Replicas
+			remaining -= int64(*override.Replicas)
+			continue
+		}
+		weights[i] = 1
+		if ok && override.Weight != nil {
+			weights[i] = int64(*override.Weight)
+		}
+		totalWeight += weights[i]
+	}
+	if remaining <= 0 || totalWeight == 0 {
+		return replicas
+	}
+
+	remainders := make([]int64, len(zones))
+	distributed := int64(0)
+	for i := range zones {
+		share := remaining * weights[i]
+		replicas[i] += int32(share / totalWeight)
+		remainders[i] = share % totalWeight
+		distributed += share / totalWeight
+	}
+
+	order := make([]int, len(zones))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for _, i := range order[:remaining-distributed] {
+		replicas[i]++
+	}
+
+	return replicas
+}
+
+// scaleReplicas returns the current replicas of the StatefulSets in terms of
+// spec.template.spec.replicas, as reported by the scale subresource. That is
+// the sum of all zones if the replicas are distributed. Otherwise it's the
+// replicas of a zone, which runs the template replicas.
+func scaleReplicas(qStatefulSet *qstsv1a1.QuarksStatefulSet, statefulSets []*appsv1.StatefulSet) int32 {
+	overrides := zoneOverrides(qStatefulSet)
+	distribute := distributeReplicas(qStatefulSet)
+
+	total := int32(0)
+	largest := int32(0)
+	largestFollowingTemplate := int32(-1)
+	for _, statefulSet := range statefulSets {
+		// GetMaxStatefulSetVersion returns an unnamed default, if there are no StatefulSets yet
+		if statefulSet.Name == "" {
+			continue
+		}
+
+		current := statefulSet.Status.Replicas
+		total += current
+		if current > largest {
+			largest = current
+		}
+		override, ok := overrides[statefulSet.Labels[qstsv1a1.LabelAZName]]
+		if (!ok || override.Replicas == nil) && current > largestFollowingTemplate {
+			largestFollowingTemplate = current
+		}
+	}
+
+	switch {
+	case distribute:
+		return total
+	case largestFollowingTemplate >= 0:
+		return largestFollowingTemplate
+	default:
+		return largest
+	}
+}
@@ -0,0 +1,103 @@
+package quarksstatefulset
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/statefulset"
+)
+
+// sequentialZones returns true if the StatefulSets of the zones are updated
+// one after the other
+func sequentialZones(annotations map[string]string) bool {
+	return annotations[statefulset.AnnotationSequentialZones] == "true"
+}
+
+// templateHash returns the hash of a pod template. It's calculated before
+// the API server adds its defaults, so it identifies the desired template of
+// a StatefulSet.
+func templateHash(template *corev1.PodTemplateSpec) (string, error) {
+	raw, err := json.Marshal(template)
+	if err != nil {
+		return "", errors.Wrap(err, "could not marshal pod template")
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(raw)), nil
+}
+
+// holdZoneRollouts keeps the pod templates of the zones after the first
+// zone, whose rollout of the desired template is not done yet, if the zones
+// are updated one after the other. It returns the name of the StatefulSet
+// the other zones wait for, and whether its rollout failed.
+//
+// StatefulSets of new zones are created with the desired template, but the
+// following zones wait for their rollout, too.
+func holdZoneRollouts(qStatefulSet *qstsv1a1.QuarksStatefulSet, existingStatefulSets []appsv1.StatefulSet, desiredStatefulSets []appsv1.StatefulSet) (string, bool) {
+	if !sequentialZones(qStatefulSet.Spec.Template.Annotations) || len(desiredStatefulSets) < 2 {
+		return "", false
+	}
+
+	existing := map[string]*appsv1.StatefulSet{}
+	for i := range existingStatefulSets {
+		existing[existingStatefulSets[i].Name] = &existingStatefulSets[i]
+	}
+
+	waitingFor := ""
+	failed := false
+	for i := range desiredStatefulSets {
+		desired := &desiredStatefulSets[i]
+		current, ok := existing[desired.Name]
+
+		if waitingFor != "" {
+			if ok {
+				desired.Spec.Template = current.Spec.Template
+				delete(desired.Annotations, qstsv1a1.AnnotationTemplateHash)
+				if hash, ok := current.Annotations[qstsv1a1.AnnotationTemplateHash]; ok {
+					desired.Annotations[qstsv1a1.AnnotationTemplateHash] = hash
+				}
+				desired.Annotations[qstsv1a1.AnnotationWaitingForZone] = waitingFor
+			}
+			continue
+		}
+
+		if ok &&
+			current.Annotations[qstsv1a1.AnnotationTemplateHash] == desired.Annotations[qstsv1a1.AnnotationTemplateHash] &&
+			zoneRolloutDone(current) {
+			continue
+		}
+
+		waitingFor = desired.Name
+		failed = ok && zoneRolloutFailed(current)
+	}
+
+	return waitingFor, failed
+}
+
+// zoneRolloutDone returns true if the current template of the StatefulSet
+// has been rolled out to all of its replicas
+func zoneRolloutDone(statefulSet *appsv1.StatefulSet) bool {
+	if statefulset.RolloutInProgress(statefulSet) || zoneRolloutFailed(statefulSet) {
+		return false
+	}
+
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	status := statefulSet.Status
+	return status.ObservedGeneration >= statefulSet.Generation &&
+		status.UpdatedReplicas >= replicas &&
+		status.ReadyReplicas >= replicas
+}
+
+// zoneRolloutFailed returns true if the rollout of the StatefulSet failed
+// or was rolled back
+func zoneRolloutFailed(statefulSet *appsv1.StatefulSet) bool {
+	_, rolledBack := statefulSet.Annotations[qstsv1a1.AnnotationRolledBackRevision]
+	return statefulset.RolloutFailed(statefulSet) || rolledBack
+}
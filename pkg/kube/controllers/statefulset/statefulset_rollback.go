@@ -0,0 +1,90 @@
+package statefulset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+	"code.cloudfoundry.org/quarks-utils/pkg/meltdown"
+)
+
+// revisionData is the part of a StatefulSet, which the StatefulSet
+// controller stores in a controller revision
+type revisionData struct {
+	Spec struct {
+		Template corev1.PodTemplateSpec `json:"template"`
+	} `json:"spec"`
+}
+
+// canRollback returns true if auto rollback is enabled and there is a
+// previous revision. A failed rollback is not rolled back again.
+func canRollback(statefulSet *appsv1.StatefulSet) bool {
+	if statefulSet.Annotations[AnnotationAutoRollback] != "true" {
+		return false
+	}
+	if _, ok := statefulSet.Annotations[qstsv1a1.AnnotationRolledBackRevision]; ok {
+		return false
+	}
+	current := statefulSet.Status.CurrentRevision
+	return current != "" && current != statefulSet.Status.UpdateRevision
+}
+
+// rollback restores the pod template of the current revision, after the
+// rollout of the update revision failed, and starts a new rollout. The
+// version of the StatefulSet is kept, the other zones of the
+// QuarksStatefulSet still have the same version.
+func (r *ReconcileStatefulSetRollout) rollback(ctx context.Context, statefulSet appsv1.StatefulSet) error {
+	failedRevision := statefulSet.Status.UpdateRevision
+	currentRevision := statefulSet.Status.CurrentRevision
+
+	template, err := r.revisionTemplate(ctx, statefulSet.Namespace, currentRevision)
+	if err != nil {
+		return errors.Wrapf(err, "could not roll back StatefulSet '%s/%s' to revision '%s'", statefulSet.Namespace, statefulSet.Name, currentRevision)
+	}
+
+	_, err = controllerutil.CreateOrUpdate(ctx, r.client, &statefulSet, func() error {
+		statefulSet.Spec.Template = *template
+		statefulSet.Annotations[qstsv1a1.AnnotationRolledBackRevision] = failedRevision
+		ConfigureStatefulSetForRollout(&statefulSet)
+		meltdown.SetLastReconcile(&statefulSet.ObjectMeta, time.Now())
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not roll back StatefulSet '%s/%s' to revision '%s'", statefulSet.Namespace, statefulSet.Name, currentRevision)
+	}
+
+	msg := fmt.Sprintf("Rollout of revision '%s' failed, StatefulSet '%s/%s' is rolled back to revision '%s'", failedRevision, statefulSet.Namespace, statefulSet.Name, currentRevision)
+	ctxlog.Info(ctx, msg)
+	ctxlog.WarningEvent(ctx, &statefulSet, "RolledBack", msg)
+	return nil
+}
+
+// revisionTemplate returns the pod template stored in a controller revision
+func (r *ReconcileStatefulSetRollout) revisionTemplate(ctx context.Context, namespace string, name string) (*corev1.PodTemplateSpec, error) {
+	revision := &appsv1.ControllerRevision{}
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, revision); err != nil {
+		return nil, errors.Wrapf(err, "could not get controller revision '%s/%s'", namespace, name)
+	}
+
+	data := revisionData{}
+	if err := json.Unmarshal(revision.Data.Raw, &data); err != nil {
+		return nil, errors.Wrapf(err, "could not parse controller revision '%s/%s'", namespace, name)
+	}
+	return &data.Spec.Template, nil
+}
+
+// rolloutFailedEvent tells about a failed rollout, which is not rolled back
+func rolloutFailedEvent(ctx context.Context, statefulSet *appsv1.StatefulSet) {
+	ctxlog.WarningEvent(ctx, statefulSet, "RolloutFailed",
+		fmt.Sprintf("Rollout of revision '%s' of StatefulSet '%s/%s' failed", statefulSet.Status.UpdateRevision, statefulSet.Namespace, statefulSet.Name))
+}
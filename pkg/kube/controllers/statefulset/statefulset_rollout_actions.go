@@ -0,0 +1,150 @@
+package statefulset
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
+)
+
+const (
+	rolloutActionPause   = "pause"
+	rolloutActionResume  = "resume"
+	rolloutActionPromote = "promote"
+	rolloutActionAbort   = "abort"
+
+	// restoreRequeueAfter is the time to wait for a restored pod of an
+	// aborted rollout, if its update doesn't trigger a reconcile
+	restoreRequeueAfter = 5 * time.Second
+)
+
+// handleRolloutAction pauses, resumes or aborts the rollout of the
+// StatefulSet. The action annotation is removed afterwards.
+func (r *ReconcileStatefulSetRollout) handleRolloutAction(ctx context.Context, statefulSet appsv1.StatefulSet, action string) (reconcile.Result, error) {
+	delete(statefulSet.Annotations, AnnotationRolloutAction)
+
+	result := reconcile.Result{}
+	state := statefulSet.Annotations[AnnotationCanaryRollout]
+	aborted := false
+	switch action {
+	case rolloutActionPause:
+		if state == rolloutStatePaused || !RolloutInProgress(&statefulSet) {
+			ctxlog.Infof(ctx, "Ignoring action '%s', StatefulSet '%s/%s' is in rollout state %s", action, statefulSet.Namespace, statefulSet.Name, state)
+			break
+		}
+		statefulSet.Annotations[AnnotationRolloutPausedState] = state
+		statefulSet.Annotations[AnnotationCanaryRollout] = rolloutStatePaused
+		ctxlog.WithEvent(&statefulSet, "RolloutPaused").Infof(ctx, "Rollout of StatefulSet '%s/%s' paused in state %s", statefulSet.Namespace, statefulSet.Name, state)
+	case rolloutActionResume, rolloutActionPromote:
+		if state != rolloutStatePaused {
+			ctxlog.Infof(ctx, "Ignoring action '%s', StatefulSet '%s/%s' is in rollout state %s", action, statefulSet.Namespace, statefulSet.Name, state)
+			break
+		}
+		resumeRollout(&statefulSet)
+		result.Requeue = true
+		ctxlog.WithEvent(&statefulSet, "RolloutResumed").Infof(ctx, "Rollout of StatefulSet '%s/%s' resumed in state %s", statefulSet.Namespace, statefulSet.Name, statefulSet.Annotations[AnnotationCanaryRollout])
+	case rolloutActionAbort:
+		if state == rolloutStateDone || state == rolloutStateAborted {
+			ctxlog.Infof(ctx, "Ignoring action '%s', StatefulSet '%s/%s' is in rollout state %s", action, statefulSet.Namespace, statefulSet.Name, state)
+			break
+		}
+		// Pods below the partition are recreated with the current revision
+		statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition = pointers.Int32(*statefulSet.Spec.Replicas)
+		statefulSet.Annotations[AnnotationCanaryRollout] = rolloutStateAborted
+		delete(statefulSet.Annotations, AnnotationRolloutPausedState)
+		aborted = true
+		ctxlog.WithEvent(&statefulSet, "RolloutAborted").Infof(ctx, "Rollout of StatefulSet '%s/%s' aborted in state %s, restoring revision '%s'", statefulSet.Namespace, statefulSet.Name, state, statefulSet.Status.CurrentRevision)
+	default:
+		ctxlog.WithEvent(&statefulSet, "RolloutActionError").Errorf(ctx, "Invalid annotation '%s' on '%s/%s': %s", AnnotationRolloutAction, statefulSet.Namespace, statefulSet.Name, action)
+	}
+
+	if err := r.updateStatefulSet(ctx, &statefulSet); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "could not handle rollout action '%s' of StatefulSet '%s/%s'", action, statefulSet.Namespace, statefulSet.Name)
+	}
+	if aborted {
+		return r.restoreAbortedRollout(ctx, &statefulSet)
+	}
+	return result, nil
+}
+
+// resumeRollout continues a paused rollout. The watch times start again.
+func resumeRollout(statefulSet *appsv1.StatefulSet) {
+	state := statefulSet.Annotations[AnnotationRolloutPausedState]
+	if state == "" {
+		state = rolloutStateRollout
+	}
+	statefulSet.Annotations[AnnotationCanaryRollout] = state
+	delete(statefulSet.Annotations, AnnotationRolloutPausedState)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	statefulSet.Annotations[AnnotationUpdateStartTime] = now
+	if _, ok := statefulSet.Annotations[AnnotationRolloutStepStartTime]; ok {
+		statefulSet.Annotations[AnnotationRolloutStepStartTime] = now
+	}
+}
+
+// restoreAbortedRollout restores the current revision of the pods of an
+// aborted rollout and requeues until all of them are restored
+func (r *ReconcileStatefulSetRollout) restoreAbortedRollout(ctx context.Context, statefulSet *appsv1.StatefulSet) (reconcile.Result, error) {
+	restoring, err := r.restoreCurrentRevision(ctx, statefulSet)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "could not restore the current revision of StatefulSet '%s/%s'", statefulSet.Namespace, statefulSet.Name)
+	}
+	if restoring {
+		return reconcile.Result{RequeueAfter: restoreRequeueAfter}, nil
+	}
+	return reconcile.Result{}, nil
+}
+
+// restoreCurrentRevision deletes one pod, which was already updated, at a
+// time. The StatefulSet controller recreates it with the current revision,
+// since it is below the partition. Like a rolling update, the pod with the
+// highest ordinal is deleted first and the next one only after all pods are
+// ready again. It returns true while pods are being restored.
+func (r *ReconcileStatefulSetRollout) restoreCurrentRevision(ctx context.Context, statefulSet *appsv1.StatefulSet) (bool, error) {
+	revision := statefulSet.Status.UpdateRevision
+	if revision == "" || revision == statefulSet.Status.CurrentRevision {
+		return false, nil
+	}
+
+	var updatedPod *corev1.Pod
+	for index := *statefulSet.Spec.Replicas - 1; index >= 0; index-- {
+		pod, ready, err := getPodWithIndex(ctx, r.client, statefulSet, index)
+		if err != nil {
+			return false, err
+		}
+		if pod == nil || pod.DeletionTimestamp != nil {
+			ctxlog.Debugf(ctx, "Waiting for pod '%s/%s-%d' to be recreated", statefulSet.Namespace, statefulSet.Name, index)
+			return true, nil
+		}
+		if pod.Labels[appsv1.StatefulSetRevisionLabel] == revision {
+			if updatedPod == nil {
+				updatedPod = pod
+			}
+			continue
+		}
+		if !ready {
+			ctxlog.Debugf(ctx, "Waiting for pod '%s/%s' to be ready", pod.Namespace, pod.Name)
+			return true, nil
+		}
+	}
+
+	if updatedPod == nil {
+		return false, nil
+	}
+
+	ctxlog.Debugf(ctx, "Deleting pod '%s/%s' of the aborted revision '%s'", updatedPod.Namespace, updatedPod.Name, revision)
+	if err := r.client.Delete(ctx, updatedPod); err != nil && !apierrors.IsNotFound(err) {
+		return false, errors.Wrapf(err, "could not delete pod '%s/%s' of the aborted revision", updatedPod.Namespace, updatedPod.Name)
+	}
+	return true, nil
+}
@@ -0,0 +1,442 @@
+package statefulset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/probe"
+	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
+)
+
+const (
+	defaultAnalysisInterval     = 10 * time.Second
+	defaultAnalysisTimeout      = 5 * time.Second
+	defaultAnalysisFailureLimit = 3
+	// maxPrometheusResponseSize limits how much of a query result is read
+	maxPrometheusResponseSize = 1024 * 1024
+)
+
+// PrometheusAddresses are the Prometheus compatible APIs, which analysis
+// gates may query. The operator sets them from its flags. Gates with other
+// addresses are rejected, since anyone who can create a QuarksStatefulSet
+// could otherwise make the operator send requests to any address it reaches.
+var PrometheusAddresses []string
+
+// allowedPrometheusAddress returns true if the address is one of the
+// configured Prometheus addresses
+func allowedPrometheusAddress(address string) bool {
+	for _, allowed := range PrometheusAddresses {
+		if strings.TrimSuffix(allowed, "/") == strings.TrimSuffix(address, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// analysisState is the progress of an analysis gate for the pod at the
+// current partition
+type analysisState struct {
+	Passed      bool  `json:"passed,omitempty"`
+	Failures    int32 `json:"failures,omitempty"`
+	LastAttempt int64 `json:"lastAttempt,omitempty"`
+}
+
+// analysisResult tells if the analysis gates passed or failed. Otherwise
+// the analysis is retried after retryAfter.
+type analysisResult struct {
+	passed     bool
+	failed     string
+	changed    bool
+	retryAfter time.Duration
+}
+
+// ParseRolloutAnalysis parses the JSON list of analysis gates
+func ParseRolloutAnalysis(value string) ([]qstsv1a1.AnalysisGate, error) {
+	gates := []qstsv1a1.AnalysisGate{}
+	if err := json.Unmarshal([]byte(value), &gates); err != nil {
+		return nil, errors.Wrap(err, "invalid rollout analysis")
+	}
+
+	names := map[string]bool{}
+	for i, gate := range gates {
+		if gate.Name == "" {
+			return nil, errors.Errorf("analysis gate %d has no name", i)
+		}
+		if names[gate.Name] {
+			return nil, errors.Errorf("duplicate analysis gate '%s'", gate.Name)
+		}
+		names[gate.Name] = true
+
+		checks := 0
+		for _, set := range []bool{gate.Exec != nil, gate.HTTP != nil, gate.Prometheus != nil} {
+			if set {
+				checks++
+			}
+		}
+		if checks != 1 {
+			return nil, errors.Errorf("analysis gate '%s' needs exactly one of exec, http or prometheus", gate.Name)
+		}
+		if gate.Exec != nil && len(gate.Exec.Command) == 0 {
+			return nil, errors.Errorf("analysis gate '%s' has no command", gate.Name)
+		}
+		if gate.Prometheus != nil {
+			if gate.Prometheus.Address == "" || gate.Prometheus.Query == "" {
+				return nil, errors.Errorf("analysis gate '%s' needs the address and query of prometheus", gate.Name)
+			}
+			if !allowedPrometheusAddress(gate.Prometheus.Address) {
+				return nil, errors.Errorf("analysis gate '%s' uses the prometheus address '%s', which is not allowed by the operator", gate.Name, gate.Prometheus.Address)
+			}
+			if _, _, err := parseSuccessCondition(gate.Prometheus.SuccessCondition); err != nil {
+				return nil, errors.Wrapf(err, "analysis gate '%s'", gate.Name)
+			}
+		}
+	}
+	return gates, nil
+}
+
+// rolloutAnalysis returns the configured analysis gates of the StatefulSet
+func rolloutAnalysis(statefulSet *appsv1.StatefulSet) ([]qstsv1a1.AnalysisGate, error) {
+	value, ok := statefulSet.Annotations[AnnotationRolloutAnalysis]
+	if !ok {
+		return nil, nil
+	}
+	return ParseRolloutAnalysis(value)
+}
+
+// analysisStates returns the progress of the analysis gates. An invalid
+// annotation starts the analysis again.
+func analysisStates(statefulSet *appsv1.StatefulSet) map[string]analysisState {
+	states := map[string]analysisState{}
+	if value, ok := statefulSet.Annotations[AnnotationRolloutAnalysisState]; ok {
+		if err := json.Unmarshal([]byte(value), &states); err != nil {
+			return map[string]analysisState{}
+		}
+	}
+	return states
+}
+
+// analyze runs the analysis gates, which didn't pass yet, against the pod
+// at the partition. A failed gate is retried after its interval, until it
+// reaches its failure limit.
+func (r *ReconcileStatefulSetRollout) analyze(ctx context.Context, statefulSet *appsv1.StatefulSet) (analysisResult, error) {
+	result := analysisResult{}
+	gates, err := rolloutAnalysis(statefulSet)
+	if err != nil {
+		return result, err
+	}
+	if len(gates) == 0 {
+		result.passed = true
+		return result, nil
+	}
+
+	partition := *statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition
+	pod, _, err := getPodWithIndex(ctx, r.client, statefulSet, partition)
+	if err != nil {
+		return result, err
+	}
+	if pod == nil {
+		return result, errors.Errorf("pod %d of StatefulSet '%s/%s' not found for analysis", partition, statefulSet.Namespace, statefulSet.Name)
+	}
+
+	states := analysisStates(statefulSet)
+	now := time.Now()
+	passed := 0
+	for _, gate := range gates {
+		state := states[gate.Name]
+		if state.Passed {
+			passed++
+			continue
+		}
+
+		interval := defaultAnalysisInterval
+		if gate.Interval != nil {
+			interval = gate.Interval.Duration
+		}
+		if state.LastAttempt > 0 {
+			if wait := time.Until(time.Unix(state.LastAttempt, 0).Add(interval)); wait > 0 {
+				requeueAnalysis(&result, wait)
+				continue
+			}
+		}
+
+		err := r.runAnalysisGate(ctx, gate, pod)
+		state.LastAttempt = now.Unix()
+		result.changed = true
+		if err == nil {
+			state.Passed = true
+			passed++
+			ctxlog.Infof(ctx, "Analysis gate '%s' passed for pod '%s/%s'", gate.Name, pod.Namespace, pod.Name)
+		} else {
+			state.Failures++
+			limit := int32(defaultAnalysisFailureLimit)
+			if gate.FailureLimit != nil {
+				limit = *gate.FailureLimit
+			}
+			ctxlog.Infof(ctx, "Analysis gate '%s' failed for pod '%s/%s' (%d/%d): %s", gate.Name, pod.Namespace, pod.Name, state.Failures, limit, err)
+			if state.Failures >= limit {
+				result.failed = fmt.Sprintf("Analysis gate '%s' failed %d times for pod '%s/%s': %s", gate.Name, state.Failures, pod.Namespace, pod.Name, err)
+			}
+			requeueAnalysis(&result, interval)
+		}
+		states[gate.Name] = state
+		if result.failed != "" {
+			break
+		}
+	}
+	result.passed = passed == len(gates)
+
+	if result.changed {
+		raw, err := json.Marshal(states)
+		if err != nil {
+			return result, errors.Wrap(err, "could not marshal the analysis state")
+		}
+		statefulSet.Annotations[AnnotationRolloutAnalysisState] = string(raw)
+	}
+	return result, nil
+}
+
+// requeueAnalysis makes sure the analysis is retried after d
+func requeueAnalysis(result *analysisResult, d time.Duration) {
+	if result.retryAfter == 0 || d < result.retryAfter {
+		result.retryAfter = d
+	}
+}
+
+// runAnalysisGate runs a single attempt of the gate against the pod
+func (r *ReconcileStatefulSetRollout) runAnalysisGate(ctx context.Context, gate qstsv1a1.AnalysisGate, pod *corev1.Pod) error {
+	timeout := defaultAnalysisTimeout
+	if gate.Timeout != nil {
+		timeout = gate.Timeout.Duration
+	}
+
+	switch {
+	case gate.Exec != nil:
+		return r.execAnalysis(ctx, gate.Exec, pod, timeout)
+	case gate.HTTP != nil:
+		return httpAnalysis(ctx, gate.HTTP, pod, timeout)
+	case gate.Prometheus != nil:
+		return prometheusAnalysis(ctx, gate.Prometheus, pod, timeout)
+	}
+	return errors.Errorf("analysis gate '%s' has no check", gate.Name)
+}
+
+func (r *ReconcileStatefulSetRollout) execAnalysis(ctx context.Context, analysis *qstsv1a1.ExecAnalysis, pod *corev1.Pod, timeout time.Duration) error {
+	container := analysis.Container
+	if container == "" && len(pod.Spec.Containers) > 0 {
+		container = pod.Spec.Containers[0].Name
+	}
+	if r.kclient == nil {
+		return errors.New("no kubernetes client to run the command")
+	}
+
+	stdout, err := probe.Exec(ctx, r.kclient, r.restConfig, pod, container, analysis.Command, timeout)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(stdout, analysis.ExpectedOutput) {
+		return errors.Errorf("output '%s' does not contain '%s'", stdout, analysis.ExpectedOutput)
+	}
+	return nil
+}
+
+func httpAnalysis(ctx context.Context, analysis *qstsv1a1.HTTPAnalysis, pod *corev1.Pod, timeout time.Duration) error {
+	action := &corev1.HTTPGetAction{
+		Path:   analysis.Path,
+		Port:   analysis.Port,
+		Scheme: analysis.Scheme,
+	}
+	resp, err := probe.HTTPGetResponse(ctx, pod, portContainer(pod, analysis.Port), action, timeout)
+	if err != nil {
+		return err
+	}
+
+	expected := resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusBadRequest
+	if len(analysis.ExpectedStatus) > 0 {
+		expected = false
+		for _, code := range analysis.ExpectedStatus {
+			if int(code) == resp.StatusCode {
+				expected = true
+			}
+		}
+	}
+	if !expected {
+		return errors.Errorf("GET '%s' returned unexpected status %d: %s", resp.URL, resp.StatusCode, resp.Body)
+	}
+	if !strings.Contains(resp.Body, analysis.ExpectedBody) {
+		return errors.Errorf("GET '%s' returned a body without '%s'", resp.URL, analysis.ExpectedBody)
+	}
+	return nil
+}
+
+// portContainer returns the container, which declares the named port
+func portContainer(pod *corev1.Pod, port intstr.IntOrString) string {
+	if port.Type == intstr.String {
+		for _, c := range pod.Spec.Containers {
+			for _, p := range c.Ports {
+				if p.Name == port.StrVal {
+					return c.Name
+				}
+			}
+		}
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+	return ""
+}
+
+// prometheusResponse is the response of the instant query API
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+func prometheusAnalysis(ctx context.Context, analysis *qstsv1a1.PrometheusAnalysis, pod *corev1.Pod, timeout time.Duration) error {
+	op, threshold, err := parseSuccessCondition(analysis.SuccessCondition)
+	if err != nil {
+		return err
+	}
+	query := strings.NewReplacer("{{pod}}", pod.Name, "{{namespace}}", pod.Namespace).Replace(analysis.Query)
+
+	value, err := queryPrometheus(ctx, analysis.Address, query, timeout)
+	if err != nil {
+		return err
+	}
+	if !compare(value, op, threshold) {
+		return errors.Errorf("result %g of query '%s' does not meet the condition '%s'", value, query, analysis.SuccessCondition)
+	}
+	return nil
+}
+
+// queryPrometheus runs an instant query and returns the first value of a
+// vector or a scalar result. Redirects are not followed.
+func queryPrometheus(ctx context.Context, address string, query string, timeout time.Duration) (float64, error) {
+	u, err := url.Parse(strings.TrimSuffix(address, "/") + "/api/v1/query")
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid prometheus address '%s'", address)
+	}
+	u.RawQuery = url.Values{"query": []string{query}}.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not create request for '%s'", u)
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		// Only the configured addresses are allowed, they must not
+		// redirect the operator to other hosts
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "query '%s' failed", query)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPrometheusResponseSize))
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not read the result of query '%s'", query)
+	}
+	result := prometheusResponse{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, errors.Wrapf(err, "invalid result of query '%s' with status %d", query, resp.StatusCode)
+	}
+	if result.Status != "success" {
+		return 0, errors.Errorf("query '%s' failed: %s", query, result.Error)
+	}
+
+	var sample []interface{}
+	switch result.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(result.Data.Result, &sample); err != nil {
+			return 0, errors.Wrapf(err, "invalid scalar result of query '%s'", query)
+		}
+	case "vector":
+		vector := []struct {
+			Value []interface{} `json:"value"`
+		}{}
+		if err := json.Unmarshal(result.Data.Result, &vector); err != nil {
+			return 0, errors.Wrapf(err, "invalid vector result of query '%s'", query)
+		}
+		if len(vector) == 0 {
+			return 0, errors.Errorf("query '%s' returned no data", query)
+		}
+		sample = vector[0].Value
+	default:
+		return 0, errors.Errorf("query '%s' returned unsupported result type '%s'", query, result.Data.ResultType)
+	}
+
+	// A sample is a timestamp and the value as a string
+	if len(sample) != 2 {
+		return 0, errors.Errorf("query '%s' returned an invalid sample", query)
+	}
+	s, ok := sample[1].(string)
+	if !ok {
+		return 0, errors.Errorf("query '%s' returned an invalid sample", query)
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "query '%s' returned an invalid value", query)
+	}
+	return value, nil
+}
+
+// parseSuccessCondition parses a condition like "< 0.05" into the operator
+// and the threshold
+func parseSuccessCondition(condition string) (string, float64, error) {
+	condition = strings.TrimSpace(condition)
+	// Two character operators first, "<=" also starts with "<"
+	for _, op := range []string{"<=", ">=", "==", "!=", "<", ">"} {
+		if !strings.HasPrefix(condition, op) {
+			continue
+		}
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(condition, op)), 64)
+		if err != nil {
+			return "", 0, errors.Wrapf(err, "invalid threshold in success condition '%s'", condition)
+		}
+		return op, threshold, nil
+	}
+	return "", 0, errors.Errorf("invalid success condition '%s', expected an operator and a number, e.g. '< 0.05'", condition)
+}
+
+func compare(value float64, op string, threshold float64) bool {
+	switch op {
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/pkg/errors"
 
 	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -23,7 +24,11 @@ import (
 // The purpose of this controller is to remove the partition of the statefulset if the canary succeeds.
 func AddStatefulSetRollout(ctx context.Context, config *config.Config, mgr manager.Manager) error {
 	ctx = ctxlog.NewContextWithRecorder(ctx, "statefulset-rollout-reconciler", mgr.GetEventRecorderFor("statefulset-rollout-recorder"))
-	r := NewStatefulSetRolloutReconciler(ctx, config, mgr)
+	kclient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed retrieving kubernetes client configuration")
+	}
+	r := NewStatefulSetRolloutReconciler(ctx, config, mgr, kclient)
 
 	// Create a new controller
 	c, err := controller.New("statefulset-rollout-controller", mgr, controller.Options{
@@ -64,7 +69,14 @@ func AddStatefulSetRollout(ctx context.Context, config *config.Config, mgr manag
 func CheckUpdate(e event.UpdateEvent) bool {
 	newSts := e.ObjectNew.(*appsv1.StatefulSet)
 	state, ok := newSts.Annotations[AnnotationCanaryRollout]
-	if !ok || state == rolloutStateDone || state == rolloutStateFailed {
+	if !ok {
+		return false
+	}
+	if _, ok := newSts.Annotations[AnnotationRolloutAction]; ok {
+		return true
+	}
+	switch state {
+	case rolloutStateDone, rolloutStateFailed, rolloutStatePaused:
 		return false
 	}
 	if state == rolloutStatePending {
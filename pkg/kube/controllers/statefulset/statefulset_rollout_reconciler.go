@@ -11,16 +11,20 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	crc "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis"
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
 	"code.cloudfoundry.org/quarks-utils/pkg/config"
 	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
 	"code.cloudfoundry.org/quarks-utils/pkg/meltdown"
 	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
+	"code.cloudfoundry.org/quarks-utils/pkg/util"
 )
 
 const (
@@ -30,6 +34,8 @@ const (
 	rolloutStateDone          = "Done"
 	rolloutStateFailed        = "Failed"
 	rolloutStateCanaryUpscale = "CanaryUpscale"
+	rolloutStatePaused        = "Paused"
+	rolloutStateAborted       = "Aborted"
 )
 
 var (
@@ -43,24 +49,64 @@ var (
 	AnnotationUpdateWatchTime = fmt.Sprintf("%s/update-watch-time-ms", apis.GroupName)
 	// AnnotationUpdateStartTime is the timestamp when the update started
 	AnnotationUpdateStartTime = fmt.Sprintf("%s/update-start-time", apis.GroupName)
+	// AnnotationCanarySize is the number or percentage of pods in the canary, by default 1
+	AnnotationCanarySize = fmt.Sprintf("%s/canary-size", apis.GroupName)
+	// AnnotationRolloutSteps is a JSON list of the rollout steps after the canary
+	AnnotationRolloutSteps = fmt.Sprintf("%s/rollout-steps", apis.GroupName)
+	// AnnotationRolloutStep is the number of rollout steps started
+	AnnotationRolloutStep = fmt.Sprintf("%s/rollout-step", apis.GroupName)
+	// AnnotationRolloutStepStartTime is the timestamp when the current rollout step started
+	AnnotationRolloutStepStartTime = fmt.Sprintf("%s/rollout-step-start-time", apis.GroupName)
+	// AnnotationRolloutStepReadyTime is the timestamp when the pods of the current rollout step were ready
+	AnnotationRolloutStepReadyTime = fmt.Sprintf("%s/rollout-step-ready-time", apis.GroupName)
+	// AnnotationPauseAfterCanary if set to "true" the rollout pauses after the canary, until it's promoted
+	AnnotationPauseAfterCanary = fmt.Sprintf("%s/pause-after-canary", apis.GroupName)
+	// AnnotationRolloutAction is set on the StatefulSet to pause, resume, promote or abort the rollout
+	AnnotationRolloutAction = fmt.Sprintf("%s/rollout-action", apis.GroupName)
+	// AnnotationRolloutPausedState is the state a paused rollout resumes with
+	AnnotationRolloutPausedState = fmt.Sprintf("%s/rollout-paused-state", apis.GroupName)
+	// AnnotationAutoRollback if set to "true" a failed rollout is rolled back to the previous pod template
+	AnnotationAutoRollback = fmt.Sprintf("%s/auto-rollback", apis.GroupName)
+	// AnnotationRolloutAnalysis is a JSON list of analysis gates, which have to pass before the partition moves on
+	AnnotationRolloutAnalysis = fmt.Sprintf("%s/rollout-analysis", apis.GroupName)
+	// AnnotationRolloutAnalysisState is the progress of the analysis gates for the pod at the partition
+	AnnotationRolloutAnalysisState = fmt.Sprintf("%s/rollout-analysis-state", apis.GroupName)
+	// AnnotationSequentialZones if set to "true" the StatefulSets of the zones are updated one after the other
+	AnnotationSequentialZones = fmt.Sprintf("%s/sequential-zones", apis.GroupName)
 )
 
+// rolloutAnnotations are changed by the rollout reconciler, besides the
+// state of the rollout
+var rolloutAnnotations = []string{
+	AnnotationUpdateStartTime,
+	AnnotationRolloutStep,
+	AnnotationRolloutStepStartTime,
+	AnnotationRolloutStepReadyTime,
+	AnnotationRolloutAction,
+	AnnotationRolloutPausedState,
+	AnnotationRolloutAnalysisState,
+}
+
 // NewStatefulSetRolloutReconciler returns a new reconcile.Reconciler
-func NewStatefulSetRolloutReconciler(ctx context.Context, config *config.Config, mgr manager.Manager) reconcile.Reconciler {
+func NewStatefulSetRolloutReconciler(ctx context.Context, config *config.Config, mgr manager.Manager, kclient kubernetes.Interface) reconcile.Reconciler {
 	return &ReconcileStatefulSetRollout{
-		ctx:    ctx,
-		config: config,
-		client: mgr.GetClient(),
-		scheme: mgr.GetScheme(),
+		ctx:        ctx,
+		config:     config,
+		client:     mgr.GetClient(),
+		kclient:    kclient,
+		scheme:     mgr.GetScheme(),
+		restConfig: mgr.GetConfig(),
 	}
 }
 
 // ReconcileStatefulSetRollout reconciles an QuarksStatefulSet object when references changes
 type ReconcileStatefulSetRollout struct {
-	ctx    context.Context
-	client crc.Client
-	scheme *runtime.Scheme
-	config *config.Config
+	ctx        context.Context
+	client     crc.Client
+	kclient    kubernetes.Interface
+	scheme     *runtime.Scheme
+	config     *config.Config
+	restConfig *rest.Config
 }
 
 // Reconcile cleans up old versions and volumeManagement statefulSet of the QuarksStatefulSet
@@ -84,9 +130,16 @@ func (r *ReconcileStatefulSetRollout) Reconcile(_ context.Context, request recon
 		return reconcile.Result{RequeueAfter: r.config.MeltdownRequeueAfter}, nil
 	}
 
+	if action, ok := statefulSet.Annotations[AnnotationRolloutAction]; ok {
+		return r.handleRolloutAction(ctx, statefulSet, action)
+	}
+
 	var status = statefulSet.Annotations[AnnotationCanaryRollout]
-	if status == rolloutStateFailed || status == rolloutStateDone {
+	switch status {
+	case rolloutStateFailed, rolloutStateDone, rolloutStatePaused:
 		return reconcile.Result{}, nil
+	case rolloutStateAborted:
+		return r.restoreAbortedRollout(ctx, &statefulSet)
 	}
 
 	var newStatus = status
@@ -124,24 +177,72 @@ func (r *ReconcileStatefulSetRollout) Reconcile(_ context.Context, request recon
 		}
 		fallthrough
 	case rolloutStateRollout:
+		steps, err := rolloutSteps(&statefulSet)
+		if err != nil {
+			ctxlog.WithEvent(&statefulSet, "RolloutStepsError").Errorf(ctx, "Invalid annotation '%s' on '%s/%s': %s", AnnotationRolloutSteps, statefulSet.Namespace, statefulSet.Name, err)
+			newStatus = rolloutStateFailed
+			break
+		}
+		stepTimeLeft := getStepTimeOut(&statefulSet, steps)
+		if stepTimeLeft < 0 {
+			newStatus = rolloutStateFailed
+			break
+		}
+
 		if resultWithRetrigger.RequeueAfter > time.Minute {
 			resultWithRetrigger.RequeueAfter = time.Minute
 		}
+		if stepTimeLeft > 0 {
+			requeueBefore(&resultWithRetrigger, stepTimeLeft)
+		}
 		ready, err := partitionPodIsReadyAndUpdated(ctx, r.client, &statefulSet)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
+		if !ready {
+			break
+		}
+
+		analysis, err := r.analyze(ctx, &statefulSet)
+		if err != nil {
+			ctxlog.WithEvent(&statefulSet, "RolloutAnalysisError").Errorf(ctx, "Could not analyze the rollout of '%s/%s': %s", statefulSet.Namespace, statefulSet.Name, err)
+			newStatus = rolloutStateFailed
+			break
+		}
+		if analysis.failed != "" {
+			ctxlog.WarningEvent(ctx, &statefulSet, "RolloutAnalysisFailed", analysis.failed)
+			newStatus = rolloutStateFailed
+			break
+		}
+		if !analysis.passed {
+			requeueBefore(&resultWithRetrigger, analysis.retryAfter)
+			dirty = analysis.changed
+			break
+		}
+
 		if *statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition == 0 {
-			if ready {
-				newStatus = rolloutStateDone
-			}
+			newStatus = rolloutStateDone
 			break
 		}
-		if !ready {
+
+		if status == rolloutStateCanary && statefulSet.Annotations[AnnotationPauseAfterCanary] == "true" {
+			statefulSet.Annotations[AnnotationRolloutPausedState] = rolloutStateRollout
+			newStatus = rolloutStatePaused
+			ctxlog.WithEvent(&statefulSet, "RolloutPaused").Infof(ctx, "Rollout of StatefulSet '%s/%s' paused after the canary, until it's promoted", statefulSet.Namespace, statefulSet.Name)
 			break
 		}
 
-		(*statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition)--
+		next := nextRolloutStep(&statefulSet, steps)
+		_, waiting := statefulSet.Annotations[AnnotationRolloutStepReadyTime]
+		if timeLeft := waitForStep(&statefulSet, next); timeLeft > 0 {
+			ctxlog.Debugf(ctx, "Statefulset rollout for '%s/%s' waits %s before the next step", statefulSet.Namespace, statefulSet.Name, timeLeft)
+			requeueBefore(&resultWithRetrigger, timeLeft)
+			dirty = !waiting || analysis.changed
+			break
+		}
+
+		*statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition = stepPartition(&statefulSet, next)
+		startRolloutStep(&statefulSet)
 		resultWithRetrigger.Requeue = true
 		dirty = true
 		newStatus = rolloutStateRollout
@@ -155,17 +256,32 @@ func (r *ReconcileStatefulSetRollout) Reconcile(_ context.Context, request recon
 			newStatus = rolloutStateCanaryUpscale
 			resultWithRetrigger.RequeueAfter = getTimeOut(ctx, statefulSet, AnnotationUpdateWatchTime)
 		} else {
+			partition, err := canaryPartition(&statefulSet)
+			if err != nil {
+				ctxlog.WithEvent(&statefulSet, "CanarySizeError").Errorf(ctx, "Invalid annotation '%s' on '%s/%s': %s", AnnotationCanarySize, statefulSet.Namespace, statefulSet.Name, err)
+				newStatus = rolloutStateFailed
+				break
+			}
 			resultWithRetrigger.RequeueAfter = getTimeOut(ctx, statefulSet, AnnotationCanaryWatchTime)
 			newStatus = rolloutStateCanary
-			(*statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition)--
+			*statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition = partition
 			dirty = true
 		}
 	}
+	if newStatus == rolloutStateFailed && canRollback(&statefulSet) {
+		if err := r.rollback(ctx, statefulSet); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, nil
+	}
 	statusChanged := newStatus != statefulSet.Annotations[AnnotationCanaryRollout]
 	ctxlog.Infof(ctx, "Statefulset rollout for '%s/%s' is in status %s", statefulSet.Namespace, statefulSet.Name, newStatus)
 	if statusChanged {
 		statefulSet.Annotations[AnnotationCanaryRollout] = newStatus
 		dirty = true
+		if newStatus == rolloutStateFailed {
+			rolloutFailedEvent(ctx, &statefulSet)
+		}
 	}
 	if dirty {
 		if err = r.updateWithPartitionMove(ctx, statefulSet, oldPartition); err != nil {
@@ -178,6 +294,10 @@ func (r *ReconcileStatefulSetRollout) Reconcile(_ context.Context, request recon
 
 func (r *ReconcileStatefulSetRollout) failIfTimedOut(ctx context.Context, statefulSet appsv1.StatefulSet, timeout string) (bool, error) {
 	if getTimeOut(ctx, statefulSet, timeout) < 0 {
+		if canRollback(&statefulSet) {
+			return true, r.rollback(ctx, statefulSet)
+		}
+		rolloutFailedEvent(ctx, &statefulSet)
 		statefulSet.Annotations[AnnotationCanaryRollout] = rolloutStateFailed
 		if err := r.updateStatefulSet(ctx, &statefulSet); err != nil {
 			return true, err
@@ -193,10 +313,14 @@ func (r *ReconcileStatefulSetRollout) updateWithPartitionMove(ctx context.Contex
 		return err
 	}
 
-	if oldPartition != *statefulset.Spec.UpdateStrategy.RollingUpdate.Partition {
-		err = CleanupNonReadyPod(ctx, r.client, &statefulset, *statefulset.Spec.UpdateStrategy.RollingUpdate.Partition)
-		if err != nil {
-			return err
+	partition := *statefulset.Spec.UpdateStrategy.RollingUpdate.Partition
+	if oldPartition != partition {
+		// A step can move the partition by more than one pod
+		for index := partition; index < util.MaxInt32(oldPartition, partition+1); index++ {
+			err = CleanupNonReadyPod(ctx, r.client, &statefulset, index)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -226,14 +350,71 @@ func getTimeOut(ctx context.Context, statefulSet appsv1.StatefulSet, watchTimeAn
 	return timeLeft
 }
 
+// getStepTimeOut returns the time left for the pods of the current rollout
+// step to become ready. It's zero if the step has no watch time or its pods
+// are ready.
+func getStepTimeOut(statefulSet *appsv1.StatefulSet, steps []qstsv1a1.RolloutStep) time.Duration {
+	step := currentRolloutStep(statefulSet, steps)
+	if step == nil || step.WatchTime == nil {
+		return 0 // never timeout
+	}
+	if _, ok := statefulSet.Annotations[AnnotationRolloutStepReadyTime]; ok {
+		return 0
+	}
+	startTime, ok := timeFromAnnotation(statefulSet, AnnotationRolloutStepStartTime)
+	if !ok {
+		return -1
+	}
+	timeLeft := time.Until(startTime.Add(step.WatchTime.Duration))
+	if timeLeft == 0 { //differ from 'never timeout'
+		timeLeft = -1
+	}
+	return timeLeft
+}
+
+// waitForStep returns how long the pods of the previous step still have to
+// be ready, before the next step starts. The first call records the time
+// the pods were ready.
+func waitForStep(statefulSet *appsv1.StatefulSet, next *qstsv1a1.RolloutStep) time.Duration {
+	if next == nil || next.WaitTime == nil {
+		return 0
+	}
+	readyTime, ok := timeFromAnnotation(statefulSet, AnnotationRolloutStepReadyTime)
+	if !ok {
+		readyTime = time.Now()
+		statefulSet.Annotations[AnnotationRolloutStepReadyTime] = strconv.FormatInt(readyTime.Unix(), 10)
+	}
+	return time.Until(readyTime.Add(next.WaitTime.Duration))
+}
+
+// requeueBefore makes sure the reconcile is triggered again after d
+func requeueBefore(result *reconcile.Result, d time.Duration) {
+	if result.RequeueAfter == 0 || d < result.RequeueAfter {
+		result.RequeueAfter = d
+	}
+}
+
 func (r *ReconcileStatefulSetRollout) updateStatefulSet(ctx context.Context, statefulSet *appsv1.StatefulSet) error {
 	meltdown.SetLastReconcile(&statefulSet.ObjectMeta, time.Now())
 
 	partition := *statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition
 	state := statefulSet.Annotations[AnnotationCanaryRollout]
+	values := map[string]string{}
+	for _, key := range rolloutAnnotations {
+		if value, ok := statefulSet.Annotations[key]; ok {
+			values[key] = value
+		}
+	}
 	_, err := controllerutil.CreateOrUpdate(ctx, r.client, statefulSet, func() error {
 		statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition = pointers.Int32(partition)
 		statefulSet.Annotations[AnnotationCanaryRollout] = state
+		for _, key := range rolloutAnnotations {
+			if value, ok := values[key]; ok {
+				statefulSet.Annotations[key] = value
+			} else {
+				delete(statefulSet.Annotations, key)
+			}
+		}
 		return nil
 	})
 	if err != nil {
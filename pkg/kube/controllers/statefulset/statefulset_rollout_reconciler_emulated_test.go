@@ -45,7 +45,7 @@ var _ = Describe("ReconcileStatefulSetRollout", func() {
 	reconciler := func() reconcile.Reconciler {
 		client = emulation.FakeClient()
 		manager.GetClientReturns(client)
-		return statefulset.NewStatefulSetRolloutReconciler(ctx, config, manager)
+		return statefulset.NewStatefulSetRolloutReconciler(ctx, config, manager, nil)
 	}
 
 	reconcile := func(reconciler reconcile.Reconciler, ev *event.UpdateEvent) {
@@ -141,6 +141,42 @@ var _ = Describe("ReconcileStatefulSetRollout", func() {
 		})
 	})
 
+	Context("Update with rollout steps", func() {
+		It("moves the partition by step", func() {
+			for ev := emulation.Reconcile(); ev != nil; ev = emulation.Reconcile() {
+			}
+			emulation.statefulSet.Annotations[statefulset.AnnotationRolloutSteps] = `[{"replicas":"75%"}]`
+
+			By("Update ")
+			r := reconciler()
+			reconcile(r, emulation.Update())
+			Expect(emulation.statefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Canary"))
+			Expect(int(*emulation.statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition)).To(Equal(3))
+
+			By("canary pod 3 gets ready")
+			r = reconciler()
+			reconcile(r, emulation.Reconcile())
+			reconcile(r, emulation.Reconcile())
+			Expect(emulation.statefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Rollout"))
+			Expect(int(*emulation.statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition)).To(Equal(1))
+
+			for i := 2; i > 0; i-- {
+				By(fmt.Sprintf("pod %d gets ready", i))
+				r = reconciler()
+				reconcile(r, emulation.Reconcile())
+				reconcile(r, emulation.Reconcile())
+			}
+			Expect(client.UpdateCallCount()).To(Equal(1))
+			Expect(int(*emulation.statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition)).To(Equal(0))
+
+			By("pod 0 gets ready")
+			for ev := emulation.Reconcile(); ev != nil; ev = emulation.Reconcile() {
+				reconcile(r, ev)
+			}
+			Expect(emulation.statefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Done"))
+		})
+	})
+
 	Context("Failed Update", func() {
 		It("It recovers from failed update", func() {
 			for ev := emulation.Reconcile(); ev != nil; ev = emulation.Reconcile() {
@@ -2,6 +2,10 @@ package statefulset_test
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -14,12 +18,14 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers"
 	cfakes "code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/fakes"
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers/statefulset"
@@ -45,6 +51,7 @@ var _ = Describe("ReconcileStatefulSetRollout", func() {
 		readyReplicas      int32
 		updatedReplicas    int32
 		updatedStatefulSet appsv1.StatefulSet
+		controllerRevision *appsv1.ControllerRevision
 	)
 	annotations := make(map[string]string)
 	timeout := 10 * time.Second
@@ -127,6 +134,13 @@ var _ = Describe("ReconcileStatefulSetRollout", func() {
 			},
 		}
 
+		controllerRevision = &appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{Name: "1", Namespace: "default"},
+			Data: runtime.RawExtension{
+				Raw: []byte(`{"spec":{"template":{"$patch":"replace","spec":{"containers":[{"name":"app","image":"app:1"}]}}}}`),
+			},
+		}
+
 		client = &cfakes.FakeClient{}
 
 		client.GetCalls(func(context context.Context, nn types.NamespacedName, object k8sclient.Object) error {
@@ -134,6 +148,12 @@ var _ = Describe("ReconcileStatefulSetRollout", func() {
 			case *appsv1.StatefulSet:
 				statefulSet.DeepCopyInto(object)
 				return nil
+			case *appsv1.ControllerRevision:
+				if controllerRevision.Name != nn.Name {
+					break
+				}
+				controllerRevision.DeepCopyInto(object)
+				return nil
 			case *corev1.Pod:
 				if replicas != readyReplicas && noneReadyPod.Name == nn.Name {
 					noneReadyPod.DeepCopyInto(object)
@@ -152,7 +172,7 @@ var _ = Describe("ReconcileStatefulSetRollout", func() {
 		})
 
 		manager.GetClientReturns(client)
-		reconciler = statefulset.NewStatefulSetRolloutReconciler(ctx, config, manager)
+		reconciler = statefulset.NewStatefulSetRolloutReconciler(ctx, config, manager, nil)
 	})
 
 	Context("if stateful set gets updated", func() {
@@ -398,5 +418,479 @@ var _ = Describe("ReconcileStatefulSetRollout", func() {
 			})
 
 		})
+
+		Context("with a canary size and rollout steps", func() {
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "default"}}
+			steps := `[{"replicas":"75%","watchTime":"5m"}]`
+
+			BeforeEach(func() {
+				replicas = 4
+				readyReplicas = 4
+				updatedReplicas = 0
+				partition = 4
+				annotations[statefulset.AnnotationCanarySize] = "50%"
+				annotations[statefulset.AnnotationRolloutSteps] = steps
+			})
+
+			AfterEach(func() {
+				for _, key := range []string{
+					statefulset.AnnotationCanarySize,
+					statefulset.AnnotationRolloutSteps,
+					statefulset.AnnotationRolloutStep,
+					statefulset.AnnotationRolloutStepStartTime,
+					statefulset.AnnotationRolloutStepReadyTime,
+				} {
+					delete(annotations, key)
+				}
+			})
+
+			It("updates the canary pods first", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Canary"))
+				Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(2))
+			})
+
+			When("the canary size is invalid", func() {
+				BeforeEach(func() {
+					annotations[statefulset.AnnotationCanarySize] = "half"
+				})
+
+				It("sets state to 'Failed'", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Failed"))
+				})
+			})
+
+			When("the canary is ready", func() {
+				BeforeEach(func() {
+					annotations[statefulset.AnnotationCanaryRollout] = "Canary"
+					partition = 2
+				})
+
+				It("starts the first step", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Rollout"))
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue(statefulset.AnnotationRolloutStep, "1"))
+					Expect(updatedStatefulSet.Annotations).To(HaveKey(statefulset.AnnotationRolloutStepStartTime))
+					Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(1))
+				})
+
+				When("the step has a wait time", func() {
+					BeforeEach(func() {
+						annotations[statefulset.AnnotationRolloutSteps] = `[{"replicas":"75%","waitTime":"10m"}]`
+					})
+
+					It("waits before the step starts", func() {
+						result, err := reconciler.Reconcile(context.Background(), request)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(result.RequeueAfter).To(And(BeNumerically("<=", timeout), BeNumerically(">", 0)))
+						Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Canary"))
+						Expect(updatedStatefulSet.Annotations).To(HaveKey(statefulset.AnnotationRolloutStepReadyTime))
+						Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(2))
+					})
+
+					It("starts the step after the wait time", func() {
+						annotations[statefulset.AnnotationRolloutStepReadyTime] = strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+						_, err := reconciler.Reconcile(context.Background(), request)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Rollout"))
+						Expect(updatedStatefulSet.Annotations).ToNot(HaveKey(statefulset.AnnotationRolloutStepReadyTime))
+						Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(1))
+					})
+				})
+			})
+
+			When("the last step is done", func() {
+				BeforeEach(func() {
+					annotations[statefulset.AnnotationCanaryRollout] = "Rollout"
+					annotations[statefulset.AnnotationRolloutStep] = "1"
+					annotations[statefulset.AnnotationRolloutStepStartTime] = strconv.FormatInt(time.Now().Unix(), 10)
+					partition = 1
+				})
+
+				It("updates the remaining pods one by one", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue(statefulset.AnnotationRolloutStep, "2"))
+					Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(0))
+				})
+			})
+
+			When("the watch time of the step is exceeded", func() {
+				BeforeEach(func() {
+					annotations[statefulset.AnnotationCanaryRollout] = "Rollout"
+					annotations[statefulset.AnnotationRolloutStep] = "1"
+					annotations[statefulset.AnnotationRolloutStepStartTime] = strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+					partition = 1
+				})
+
+				It("sets state to 'Failed'", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Failed"))
+				})
+			})
+		})
+
+		Context("with a rollout action", func() {
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "default"}}
+
+			BeforeEach(func() {
+				replicas = 3
+				readyReplicas = 3
+				updatedReplicas = 1
+				partition = 2
+				annotations[statefulset.AnnotationCanaryRollout] = "Canary"
+			})
+
+			AfterEach(func() {
+				delete(annotations, statefulset.AnnotationRolloutAction)
+				delete(annotations, statefulset.AnnotationRolloutPausedState)
+				delete(annotations, statefulset.AnnotationPauseAfterCanary)
+			})
+
+			It("pauses the rollout", func() {
+				annotations[statefulset.AnnotationRolloutAction] = "pause"
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Paused"))
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue(statefulset.AnnotationRolloutPausedState, "Canary"))
+				Expect(updatedStatefulSet.Annotations).ToNot(HaveKey(statefulset.AnnotationRolloutAction))
+				Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(2))
+			})
+
+			It("doesn't continue a paused rollout", func() {
+				annotations[statefulset.AnnotationCanaryRollout] = "Paused"
+				result, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result).To(Equal(reconcile.Result{}))
+				Expect(client.UpdateCallCount()).To(Equal(0))
+			})
+
+			It("resumes a paused rollout", func() {
+				annotations[statefulset.AnnotationCanaryRollout] = "Paused"
+				annotations[statefulset.AnnotationRolloutPausedState] = "Canary"
+				annotations[statefulset.AnnotationRolloutAction] = "resume"
+				result, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.Requeue).To(BeTrue())
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Canary"))
+				Expect(updatedStatefulSet.Annotations).ToNot(HaveKey(statefulset.AnnotationRolloutPausedState))
+			})
+
+			It("aborts the rollout and deletes the updated pod with the highest ordinal", func() {
+				annotations[statefulset.AnnotationRolloutAction] = "abort"
+				statefulSet.Status.UpdateRevision = "2"
+				readyPod.Labels = map[string]string{appsv1.StatefulSetRevisionLabel: "2"}
+				result, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Aborted"))
+				Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(3))
+				Expect(client.DeleteCallCount()).To(Equal(1))
+				_, pod, _ := client.DeleteArgsForCall(0)
+				Expect(pod.GetName()).To(Equal("foo-2"))
+			})
+
+			When("the rollout was aborted", func() {
+				var (
+					revisions map[string]string
+					ready     map[string]bool
+				)
+
+				BeforeEach(func() {
+					annotations[statefulset.AnnotationCanaryRollout] = "Aborted"
+					revisions = map[string]string{"foo-0": "2", "foo-1": "2", "foo-2": "1"}
+					ready = map[string]bool{"foo-0": true, "foo-1": true, "foo-2": true}
+				})
+
+				JustBeforeEach(func() {
+					statefulSet.Status.UpdateRevision = "2"
+					client.GetCalls(func(context context.Context, nn types.NamespacedName, object k8sclient.Object) error {
+						switch object := object.(type) {
+						case *appsv1.StatefulSet:
+							statefulSet.DeepCopyInto(object)
+							return nil
+						case *corev1.Pod:
+							revision, ok := revisions[nn.Name]
+							if !ok {
+								break
+							}
+							if ready[nn.Name] {
+								readyPod.DeepCopyInto(object)
+							} else {
+								noneReadyPod.DeepCopyInto(object)
+							}
+							object.Name = nn.Name
+							object.Labels = map[string]string{appsv1.StatefulSetRevisionLabel: revision}
+							return nil
+						}
+						return apierrors.NewNotFound(schema.GroupResource{}, nn.Name)
+					})
+				})
+
+				It("deletes only the next updated pod", func() {
+					result, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+					Expect(client.DeleteCallCount()).To(Equal(1))
+					_, pod, _ := client.DeleteArgsForCall(0)
+					Expect(pod.GetName()).To(Equal("foo-1"))
+					Expect(client.UpdateCallCount()).To(Equal(0))
+				})
+
+				It("waits until the restored pod is ready", func() {
+					ready["foo-2"] = false
+					result, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+					Expect(client.DeleteCallCount()).To(Equal(0))
+				})
+
+				It("waits until the deleted pod is recreated", func() {
+					delete(revisions, "foo-2")
+					result, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+					Expect(client.DeleteCallCount()).To(Equal(0))
+				})
+
+				It("stops when all pods are restored", func() {
+					revisions = map[string]string{"foo-0": "1", "foo-1": "1", "foo-2": "1"}
+					result, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result).To(Equal(reconcile.Result{}))
+					Expect(client.DeleteCallCount()).To(Equal(0))
+				})
+			})
+
+			It("ignores invalid actions", func() {
+				annotations[statefulset.AnnotationRolloutAction] = "rollback"
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Canary"))
+				Expect(updatedStatefulSet.Annotations).ToNot(HaveKey(statefulset.AnnotationRolloutAction))
+			})
+
+			When("the rollout pauses after the canary", func() {
+				BeforeEach(func() {
+					annotations[statefulset.AnnotationPauseAfterCanary] = "true"
+				})
+
+				It("waits until the canary is promoted", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Paused"))
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue(statefulset.AnnotationRolloutPausedState, "Rollout"))
+					Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(2))
+				})
+			})
+		})
+
+		Context("with auto rollback", func() {
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "default"}}
+
+			BeforeEach(func() {
+				replicas = 3
+				readyReplicas = 3
+				updatedReplicas = 1
+				partition = 2
+				annotations[statefulset.AnnotationCanaryRollout] = "Canary"
+				annotations[statefulset.AnnotationCanaryWatchTime] = "-1"
+				annotations[statefulset.AnnotationAutoRollback] = "true"
+				annotations[qstsv1a1.AnnotationVersion] = "3"
+			})
+
+			JustBeforeEach(func() {
+				statefulSet.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "app:2"}}
+				statefulSet.Status.UpdateRevision = "2"
+			})
+
+			AfterEach(func() {
+				delete(annotations, statefulset.AnnotationAutoRollback)
+				delete(annotations, qstsv1a1.AnnotationVersion)
+				delete(annotations, qstsv1a1.AnnotationRolledBackRevision)
+			})
+
+			It("restores the pod template of the current revision and rolls it out", func() {
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(updatedStatefulSet.Spec.Template.Spec.Containers).To(HaveLen(1))
+				Expect(updatedStatefulSet.Spec.Template.Spec.Containers[0].Image).To(Equal("app:1"))
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Pending"))
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationRolledBackRevision, "2"))
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationVersion, "3"))
+				Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(3))
+			})
+
+			It("rolls back when the update watch time is exceeded", func() {
+				annotations[statefulset.AnnotationUpdateWatchTime] = "-1"
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(updatedStatefulSet.Spec.Template.Spec.Containers[0].Image).To(Equal("app:1"))
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue(qstsv1a1.AnnotationRolledBackRevision, "2"))
+			})
+
+			It("doesn't roll back a rollback", func() {
+				annotations[qstsv1a1.AnnotationRolledBackRevision] = "0"
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(updatedStatefulSet.Spec.Template.Spec.Containers[0].Image).To(Equal("app:2"))
+				Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Failed"))
+			})
+
+			It("fails if the current revision is missing", func() {
+				controllerRevision.Name = "0"
+				_, err := reconciler.Reconcile(context.Background(), request)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("could not roll back"))
+			})
+		})
+
+		Context("with rollout analysis", func() {
+			var (
+				server *httptest.Server
+				status int
+				value  string
+				query  string
+				port   int
+			)
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "default"}}
+
+			BeforeEach(func() {
+				replicas = 3
+				readyReplicas = 3
+				updatedReplicas = 1
+				partition = 2
+				annotations[statefulset.AnnotationCanaryRollout] = "Canary"
+				status = http.StatusOK
+				value = "0.01"
+				query = ""
+
+				server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path == "/redirect/api/v1/query" {
+						http.Redirect(w, r, "/api/v1/query?"+r.URL.RawQuery, http.StatusFound)
+						return
+					}
+					if r.URL.Path == "/api/v1/query" {
+						query = r.URL.Query().Get("query")
+						fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1600000000,"%s"]}]}}`, value)
+						return
+					}
+					w.WriteHeader(status)
+					fmt.Fprint(w, "ok")
+				}))
+				u, err := url.Parse(server.URL)
+				Expect(err).ToNot(HaveOccurred())
+				port, err = strconv.Atoi(u.Port())
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			JustBeforeEach(func() {
+				readyPod.Status.PodIP = "127.0.0.1"
+			})
+
+			AfterEach(func() {
+				server.Close()
+				delete(annotations, statefulset.AnnotationRolloutAnalysis)
+				delete(annotations, statefulset.AnnotationRolloutAnalysisState)
+			})
+
+			When("the http gate succeeds", func() {
+				BeforeEach(func() {
+					annotations[statefulset.AnnotationRolloutAnalysis] = fmt.Sprintf(`[{"name":"health","http":{"path":"/health","port":%d,"expectedBody":"ok"}}]`, port)
+				})
+
+				It("moves the partition", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Rollout"))
+					Expect(updatedStatefulSet.Annotations).ToNot(HaveKey(statefulset.AnnotationRolloutAnalysisState))
+					Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(1))
+				})
+			})
+
+			When("the http gate fails", func() {
+				BeforeEach(func() {
+					status = http.StatusServiceUnavailable
+					annotations[statefulset.AnnotationRolloutAnalysis] = fmt.Sprintf(`[{"name":"health","http":{"port":%d},"interval":"30s","failureLimit":2}]`, port)
+				})
+
+				It("retries the gate after its interval", func() {
+					result, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result.RequeueAfter).To(BeNumerically("<=", 30*time.Second))
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Canary"))
+					Expect(updatedStatefulSet.Annotations[statefulset.AnnotationRolloutAnalysisState]).To(ContainSubstring(`"failures":1`))
+					Expect(*updatedStatefulSet.Spec.UpdateStrategy.RollingUpdate.Partition).To(BeEquivalentTo(2))
+				})
+
+				It("doesn't retry before the interval passed", func() {
+					annotations[statefulset.AnnotationRolloutAnalysisState] = fmt.Sprintf(`{"health":{"failures":1,"lastAttempt":%d}}`, time.Now().Unix())
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(client.UpdateCallCount()).To(Equal(0))
+				})
+
+				It("fails the rollout once the failure limit is reached", func() {
+					annotations[statefulset.AnnotationRolloutAnalysisState] = `{"health":{"failures":1,"lastAttempt":1}}`
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Failed"))
+				})
+
+				It("doesn't run gates, which already passed", func() {
+					annotations[statefulset.AnnotationRolloutAnalysisState] = `{"health":{"passed":true}}`
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Rollout"))
+				})
+			})
+
+			When("the prometheus gate is configured", func() {
+				BeforeEach(func() {
+					statefulset.PrometheusAddresses = []string{server.URL}
+					annotations[statefulset.AnnotationRolloutAnalysis] = fmt.Sprintf(`[{"name":"errors","prometheus":{"address":"%s","query":"rate(errors{pod=\"{{pod}}\"}[1m])","successCondition":"< 0.05"},"failureLimit":1}]`, server.URL)
+				})
+
+				AfterEach(func() {
+					statefulset.PrometheusAddresses = nil
+				})
+
+				It("queries the metrics of the updated pod", func() {
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(query).To(Equal(`rate(errors{pod="foo-2"}[1m])`))
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Rollout"))
+				})
+
+				It("fails the rollout if the condition is not met", func() {
+					value = "0.5"
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Failed"))
+				})
+
+				It("doesn't follow redirects", func() {
+					statefulset.PrometheusAddresses = []string{server.URL + "/redirect"}
+					annotations[statefulset.AnnotationRolloutAnalysis] = fmt.Sprintf(`[{"name":"errors","prometheus":{"address":"%s/redirect","query":"errors","successCondition":"< 0.05"},"failureLimit":1}]`, server.URL)
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(query).To(BeEmpty())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Failed"))
+				})
+
+				It("fails the rollout without querying an address, which is not allowed", func() {
+					statefulset.PrometheusAddresses = []string{"http://prometheus:9090"}
+					_, err := reconciler.Reconcile(context.Background(), request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(query).To(BeEmpty())
+					Expect(updatedStatefulSet.Annotations).To(HaveKeyWithValue("quarks.cloudfoundry.org/canary-rollout", "Failed"))
+				})
+			})
+		})
 	})
 })
@@ -0,0 +1,144 @@
+package statefulset
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	"code.cloudfoundry.org/quarks-utils/pkg/util"
+)
+
+// ParseCanarySize parses the number or percentage of pods in the canary
+func ParseCanarySize(value string) (intstr.IntOrString, error) {
+	size := intstr.Parse(value)
+	if _, err := intstr.GetScaledValueFromIntOrPercent(&size, 100, true); err != nil {
+		return size, errors.Wrapf(err, "invalid canary size '%s'", value)
+	}
+	return size, nil
+}
+
+// ParseRolloutSteps parses the JSON list of rollout steps after the canary
+func ParseRolloutSteps(value string) ([]qstsv1a1.RolloutStep, error) {
+	steps := []qstsv1a1.RolloutStep{}
+	if err := json.Unmarshal([]byte(value), &steps); err != nil {
+		return nil, errors.Wrap(err, "invalid rollout steps")
+	}
+	for i := range steps {
+		if _, err := intstr.GetScaledValueFromIntOrPercent(&steps[i].Replicas, 100, true); err != nil {
+			return nil, errors.Wrapf(err, "invalid replicas of rollout step %d", i)
+		}
+	}
+	return steps, nil
+}
+
+// scaledReplicas returns the number of pods for a number or percentage of
+// the replicas. It's at least one pod and at most all replicas.
+func scaledReplicas(value intstr.IntOrString, replicas int32) int32 {
+	n, err := intstr.GetScaledValueFromIntOrPercent(&value, int(replicas), true)
+	if err != nil || n < 1 {
+		return 1
+	}
+	if int32(n) > replicas {
+		return replicas
+	}
+	return int32(n)
+}
+
+// canaryPartition returns the partition, which updates the canary pods
+func canaryPartition(statefulSet *appsv1.StatefulSet) (int32, error) {
+	partition := *statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition
+	size := int32(1)
+	if value, ok := statefulSet.Annotations[AnnotationCanarySize]; ok {
+		canary, err := ParseCanarySize(value)
+		if err != nil {
+			return partition, err
+		}
+		size = scaledReplicas(canary, *statefulSet.Spec.Replicas)
+	}
+	if partition < size {
+		return 0, nil
+	}
+	return partition - size, nil
+}
+
+// rolloutSteps returns the configured rollout steps of the StatefulSet
+func rolloutSteps(statefulSet *appsv1.StatefulSet) ([]qstsv1a1.RolloutStep, error) {
+	value, ok := statefulSet.Annotations[AnnotationRolloutSteps]
+	if !ok {
+		return nil, nil
+	}
+	return ParseRolloutSteps(value)
+}
+
+// rolloutStepIndex returns the number of rollout steps started. It's zero
+// during the canary.
+func rolloutStepIndex(statefulSet *appsv1.StatefulSet) int {
+	index, err := strconv.Atoi(statefulSet.Annotations[AnnotationRolloutStep])
+	if err != nil || index < 0 {
+		return 0
+	}
+	return index
+}
+
+// currentRolloutStep returns the rollout step in progress. It's nil during
+// the canary and when the pods are updated one by one after the last step.
+func currentRolloutStep(statefulSet *appsv1.StatefulSet, steps []qstsv1a1.RolloutStep) *qstsv1a1.RolloutStep {
+	index := rolloutStepIndex(statefulSet)
+	if index < 1 || index > len(steps) {
+		return nil
+	}
+	return &steps[index-1]
+}
+
+// nextRolloutStep returns the next rollout step. It's nil, if the pods are
+// updated one by one.
+func nextRolloutStep(statefulSet *appsv1.StatefulSet, steps []qstsv1a1.RolloutStep) *qstsv1a1.RolloutStep {
+	index := rolloutStepIndex(statefulSet)
+	if index >= len(steps) {
+		return nil
+	}
+	return &steps[index]
+}
+
+// stepPartition returns the partition for the next rollout step. Every step
+// updates at least one more pod.
+func stepPartition(statefulSet *appsv1.StatefulSet, step *qstsv1a1.RolloutStep) int32 {
+	partition := *statefulSet.Spec.UpdateStrategy.RollingUpdate.Partition - 1
+	if step == nil {
+		return partition
+	}
+	replicas := *statefulSet.Spec.Replicas
+	return util.MinInt32(partition, replicas-scaledReplicas(step.Replicas, replicas))
+}
+
+// startRolloutStep records the start of the next rollout step
+func startRolloutStep(statefulSet *appsv1.StatefulSet) {
+	statefulSet.Annotations[AnnotationRolloutStep] = strconv.Itoa(rolloutStepIndex(statefulSet) + 1)
+	statefulSet.Annotations[AnnotationRolloutStepStartTime] = strconv.FormatInt(time.Now().Unix(), 10)
+	delete(statefulSet.Annotations, AnnotationRolloutStepReadyTime)
+	delete(statefulSet.Annotations, AnnotationRolloutAnalysisState)
+}
+
+// resetRolloutSteps removes the progress of a previous rollout
+func resetRolloutSteps(statefulSet *appsv1.StatefulSet) {
+	delete(statefulSet.Annotations, AnnotationRolloutStep)
+	delete(statefulSet.Annotations, AnnotationRolloutStepStartTime)
+	delete(statefulSet.Annotations, AnnotationRolloutStepReadyTime)
+	delete(statefulSet.Annotations, AnnotationRolloutPausedState)
+	delete(statefulSet.Annotations, AnnotationRolloutAnalysisState)
+}
+
+// timeFromAnnotation returns the timestamp of the annotation in unix seconds
+func timeFromAnnotation(statefulSet *appsv1.StatefulSet, key string) (time.Time, bool) {
+	value, err := strconv.ParseInt(statefulSet.Annotations[key], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(value, 0), true
+}
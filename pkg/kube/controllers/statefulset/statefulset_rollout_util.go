@@ -25,6 +25,7 @@ func ConfigureStatefulSetForRollout(statefulSet *appsv1.StatefulSet) {
 	}
 	statefulSet.Annotations[AnnotationCanaryRollout] = rolloutStatePending
 	statefulSet.Annotations[AnnotationUpdateStartTime] = strconv.FormatInt(time.Now().Unix(), 10)
+	resetRolloutSteps(statefulSet)
 }
 
 // ConfigureStatefulSetForInitialRollout initially configures a stateful set for canarying and rollout
@@ -36,6 +37,24 @@ func ConfigureStatefulSetForInitialRollout(statefulSet *appsv1.StatefulSet) {
 	}
 	statefulSet.Annotations[AnnotationCanaryRollout] = rolloutStateCanaryUpscale
 	statefulSet.Annotations[AnnotationUpdateStartTime] = strconv.FormatInt(time.Now().Unix(), 10)
+	resetRolloutSteps(statefulSet)
+}
+
+// CopyRolloutState copies the state of the rollout and the partition of the
+// current StatefulSet to the desired one, so updating a StatefulSet with an
+// unchanged template doesn't interfere with its rollout
+func CopyRolloutState(current *appsv1.StatefulSet, desired *appsv1.StatefulSet) {
+	if desired.Annotations == nil {
+		desired.Annotations = map[string]string{}
+	}
+	for _, key := range append([]string{AnnotationCanaryRollout}, rolloutAnnotations...) {
+		if value, ok := current.Annotations[key]; ok {
+			desired.Annotations[key] = value
+		} else {
+			delete(desired.Annotations, key)
+		}
+	}
+	desired.Spec.UpdateStrategy = *current.Spec.UpdateStrategy.DeepCopy()
 }
 
 // CleanupNonReadyPod deletes all pods, that are not ready
@@ -69,3 +88,18 @@ func getPodWithIndex(ctx context.Context, client crc.Client, statefulSet *appsv1
 	}
 	return &pod, podutil.IsPodReady(&pod), nil
 }
+
+// RolloutFailed returns true if the canary rollout of the StatefulSet failed
+func RolloutFailed(statefulSet *appsv1.StatefulSet) bool {
+	return statefulSet.Annotations[AnnotationCanaryRollout] == rolloutStateFailed
+}
+
+// RolloutInProgress returns true if the StatefulSet is still canarying or
+// rolling out, or if the rollout is paused
+func RolloutInProgress(statefulSet *appsv1.StatefulSet) bool {
+	switch statefulSet.Annotations[AnnotationCanaryRollout] {
+	case rolloutStatePending, rolloutStateCanary, rolloutStateCanaryUpscale, rolloutStateRollout, rolloutStatePaused:
+		return true
+	}
+	return false
+}
@@ -2,18 +2,20 @@ package operator
 
 import (
 	"context"
+	"strings"
 
 	"github.com/pkg/errors"
 
-	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
-	extv1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	extv1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	qstsv1a1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1alpha1"
+	qstsv1b1 "code.cloudfoundry.org/quarks-statefulset/pkg/kube/apis/quarksstatefulset/v1beta1"
 	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/controllers"
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/crd"
 	"code.cloudfoundry.org/quarks-utils/pkg/config"
-	"code.cloudfoundry.org/quarks-utils/pkg/crd"
 	credsgen "code.cloudfoundry.org/quarks-utils/pkg/credsgen/in_memory_generator"
 	"code.cloudfoundry.org/quarks-utils/pkg/ctxlog"
 )
@@ -57,20 +59,8 @@ func ApplyCRDs(ctx context.Context, config *rest.Config) error {
 		return errors.Wrap(err, "Could not get kube client")
 	}
 
-	b := crd.New(
-		qstsv1a1.QuarksStatefulSetResourceName,
-		extv1.CustomResourceDefinitionNames{
-			Kind:       qstsv1a1.QuarksStatefulSetResourceKind,
-			Plural:     qstsv1a1.QuarksStatefulSetResourcePlural,
-			ShortNames: qstsv1a1.QuarksStatefulSetResourceShortNames,
-		},
-		qstsv1a1.SchemeGroupVersion,
-	)
-
-	err = b.WithValidation(&qstsv1a1.QuarksStatefulSetValidation).
-		WithAdditionalPrinterColumns(qstsv1a1.QuarksStatefulSetAdditionalPrinterColumns).
-		Build().
-		Apply(ctx, client)
+	b := quarksStatefulSetCRDBuilder()
+	err = b.Apply(ctx, client)
 	if err != nil {
 		return errors.Wrapf(err, "failed to apply CRD '%s'", qstsv1a1.QuarksStatefulSetResourceName)
 	}
@@ -81,3 +71,32 @@ func ApplyCRDs(ctx context.Context, config *rest.Config) error {
 
 	return nil
 }
+
+// QuarksStatefulSetCRD returns the QuarksStatefulSet CRD, as applied by the
+// operator and rendered into the helm chart
+func QuarksStatefulSetCRD() *extv1.CustomResourceDefinition {
+	return quarksStatefulSetCRDBuilder().CRD
+}
+
+// quarksStatefulSetCRDBuilder builds the CRD. v1alpha1 stays the storage
+// version, v1beta1 is only served once the operator configured the
+// conversion webhook.
+// The scale subresource works on the replicas of the StatefulSet template,
+// which are the replicas of each zone.
+func quarksStatefulSetCRDBuilder() *crd.Builder {
+	return crd.New(
+		qstsv1a1.QuarksStatefulSetResourceName,
+		extv1.CustomResourceDefinitionNames{
+			Kind:       qstsv1a1.QuarksStatefulSetResourceKind,
+			ListKind:   qstsv1a1.QuarksStatefulSetResourceKind + "List",
+			Plural:     qstsv1a1.QuarksStatefulSetResourcePlural,
+			Singular:   strings.ToLower(qstsv1a1.QuarksStatefulSetResourceKind),
+			ShortNames: qstsv1a1.QuarksStatefulSetResourceShortNames,
+		},
+		qstsv1a1.SchemeGroupVersion.Group,
+	).
+		WithVersion(qstsv1a1.SchemeGroupVersion.Version, true, &qstsv1a1.QuarksStatefulSetValidation, qstsv1a1.QuarksStatefulSetAdditionalPrinterColumns).
+		WithVersion(qstsv1b1.SchemeGroupVersion.Version, false, &qstsv1b1.QuarksStatefulSetValidation, qstsv1b1.QuarksStatefulSetAdditionalPrinterColumns).
+		WithScale(".spec.template.spec.replicas", ".status.replicas", ".status.selector").
+		Build()
+}
@@ -0,0 +1,163 @@
+// Package crd handles the creation and updating of our apiextensions v1 CRDs
+// in the cluster. Unlike the v1beta1 builder from quarks-utils it supports
+// serving multiple versions of a resource.
+package crd
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	extv1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Builder builds CRDs
+type Builder struct {
+	crdName  string
+	group    string
+	names    extv1.CustomResourceDefinitionNames
+	versions []extv1.CustomResourceDefinitionVersion
+	scale    *extv1.CustomResourceSubresourceScale
+	CRD      *extv1.CustomResourceDefinition
+}
+
+// New returns a new CRD builder
+func New(
+	crdName string,
+	names extv1.CustomResourceDefinitionNames,
+	group string,
+) *Builder {
+	return &Builder{
+		crdName: crdName,
+		names:   names,
+		group:   group,
+	}
+}
+
+// WithVersion adds a version with its validation and printer columns.
+// Exactly one version has to be the storage version. The other versions
+// have to be converted, so they are only served once a conversion webhook
+// is configured.
+func (b *Builder) WithVersion(name string, storage bool, validation *extv1.CustomResourceValidation, cols []extv1.CustomResourceColumnDefinition) *Builder {
+	b.versions = append(b.versions, extv1.CustomResourceDefinitionVersion{
+		Name:    name,
+		Served:  storage,
+		Storage: storage,
+		Schema:  validation,
+		Subresources: &extv1.CustomResourceSubresources{
+			Status: &extv1.CustomResourceSubresourceStatus{},
+		},
+		AdditionalPrinterColumns: cols,
+	})
+	return b
+}
+
+// WithScale adds the scale subresource to all versions, which is used by
+// `kubectl scale` and HorizontalPodAutoscalers
+func (b *Builder) WithScale(specReplicasPath, statusReplicasPath, labelSelectorPath string) *Builder {
+	b.scale = &extv1.CustomResourceSubresourceScale{
+		SpecReplicasPath:   specReplicasPath,
+		StatusReplicasPath: statusReplicasPath,
+		LabelSelectorPath:  &labelSelectorPath,
+	}
+	return b
+}
+
+// Build the CRD
+func (b *Builder) Build() *Builder {
+	if b.scale != nil {
+		for i := range b.versions {
+			b.versions[i].Subresources.Scale = b.scale.DeepCopy()
+		}
+	}
+
+	b.CRD = &extv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.crdName,
+		},
+		Spec: extv1.CustomResourceDefinitionSpec{
+			Group:    b.group,
+			Names:    b.names,
+			Scope:    extv1.NamespaceScoped,
+			Versions: b.versions,
+			Conversion: &extv1.CustomResourceConversion{
+				Strategy: extv1.NoneConverter,
+			},
+		},
+	}
+	return b
+}
+
+// Apply CRD to cluster. A conversion webhook, which was configured by the
+// running operator, is kept together with the versions it serves.
+func (b *Builder) Apply(ctx context.Context, client extv1client.ApiextensionsV1Interface) error {
+	existing, err := client.CustomResourceDefinitions().Get(ctx, b.crdName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "getting CRD '%s'", b.crdName)
+		}
+		_, err := client.CustomResourceDefinitions().Create(ctx, b.CRD, metav1.CreateOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "creating CRD '%s'", b.crdName)
+		}
+		return nil
+	}
+
+	if existing.Spec.Conversion != nil && existing.Spec.Conversion.Strategy == extv1.WebhookConverter {
+		b.CRD.Spec.Conversion = existing.Spec.Conversion.DeepCopy()
+		ServeAllVersions(b.CRD)
+	}
+
+	if !reflect.DeepEqual(b.CRD.Spec, existing.Spec) {
+		b.CRD.ResourceVersion = existing.ResourceVersion
+		_, err = client.CustomResourceDefinitions().Update(ctx, b.CRD, metav1.UpdateOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "updating CRD '%s'", b.crdName)
+		}
+	}
+
+	return nil
+}
+
+// ServeAllVersions serves the versions, which need a conversion webhook.
+// Without the webhook, the API server would only rewrite the API version and
+// prune the fields the storage version doesn't know.
+func ServeAllVersions(crd *extv1.CustomResourceDefinition) {
+	for i := range crd.Spec.Versions {
+		crd.Spec.Versions[i].Served = true
+	}
+}
+
+// WaitForCRDReady blocks until the CRD is ready.
+func WaitForCRDReady(ctx context.Context, client extv1client.ApiextensionsV1Interface, crdName string) error {
+	err := wait.ExponentialBackoff(
+		wait.Backoff{
+			Duration: time.Second,
+			Steps:    15,
+			Factor:   1,
+		},
+		func() (bool, error) {
+			crd, err := client.CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			for _, cond := range crd.Status.Conditions {
+				if cond.Type == extv1.NamesAccepted && cond.Status == extv1.ConditionTrue {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		})
+	if err != nil {
+		return errors.Wrapf(err, "Waiting for CRD ready failed")
+	}
+
+	return nil
+}
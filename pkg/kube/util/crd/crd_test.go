@@ -0,0 +1,76 @@
+package crd_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/crd"
+)
+
+var _ = Describe("Builder", func() {
+	var builder *crd.Builder
+
+	served := func(c *extv1.CustomResourceDefinition) map[string]bool {
+		versions := map[string]bool{}
+		for _, version := range c.Spec.Versions {
+			versions[version.Name] = version.Served
+		}
+		return versions
+	}
+
+	BeforeEach(func() {
+		builder = crd.New("foos.example.com", extv1.CustomResourceDefinitionNames{Kind: "Foo", Plural: "foos"}, "example.com").
+			WithVersion("v1alpha1", true, nil, nil).
+			WithVersion("v1beta1", false, nil, nil).
+			Build()
+	})
+
+	It("only serves the storage version without a conversion webhook", func() {
+		Expect(builder.CRD.Spec.Conversion.Strategy).To(Equal(extv1.NoneConverter))
+		Expect(served(builder.CRD)).To(Equal(map[string]bool{"v1alpha1": true, "v1beta1": false}))
+	})
+
+	Describe("Apply", func() {
+		var client *fake.Clientset
+
+		getCRD := func() *extv1.CustomResourceDefinition {
+			c, err := client.ApiextensionsV1().CustomResourceDefinitions().Get(context.Background(), "foos.example.com", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			return c
+		}
+
+		BeforeEach(func() {
+			client = fake.NewSimpleClientset()
+		})
+
+		It("creates the CRD", func() {
+			Expect(builder.Apply(context.Background(), client.ApiextensionsV1())).To(Succeed())
+			Expect(served(getCRD())).To(Equal(map[string]bool{"v1alpha1": true, "v1beta1": false}))
+		})
+
+		When("the conversion webhook is configured", func() {
+			BeforeEach(func() {
+				existing := builder.CRD.DeepCopy()
+				existing.Spec.Conversion = &extv1.CustomResourceConversion{
+					Strategy: extv1.WebhookConverter,
+					Webhook:  &extv1.WebhookConversion{ConversionReviewVersions: []string{"v1beta1"}},
+				}
+				crd.ServeAllVersions(existing)
+				client = fake.NewSimpleClientset(existing)
+			})
+
+			It("keeps the webhook and serves all versions", func() {
+				Expect(builder.Apply(context.Background(), client.ApiextensionsV1())).To(Succeed())
+				c := getCRD()
+				Expect(c.Spec.Conversion.Strategy).To(Equal(extv1.WebhookConverter))
+				Expect(served(c)).To(Equal(map[string]bool{"v1alpha1": true, "v1beta1": true}))
+			})
+		})
+	})
+})
@@ -0,0 +1,184 @@
+// Package openapi generates structural OpenAPI v3 schemas for CRDs from Go
+// types, using the same json tags the API server sees when decoding objects.
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"code.cloudfoundry.org/quarks-utils/pkg/pointers"
+)
+
+// swaggerDoc is implemented by the Kubernetes API types, and by ours, to
+// describe a type ("" key) and its fields (json name as key)
+type swaggerDoc interface {
+	SwaggerDoc() map[string]string
+}
+
+// openAPISchemaType is implemented by types with a custom JSON
+// representation, e.g. metav1.Time
+type openAPISchemaType interface {
+	OpenAPISchemaType() []string
+	OpenAPISchemaFormat() string
+}
+
+var (
+	intOrStringType = reflect.TypeOf(intstr.IntOrString{})
+	quantityType    = reflect.TypeOf(resource.Quantity{})
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// SchemaOf returns the schema of the type of obj
+func SchemaOf(obj interface{}) *extv1.JSONSchemaProps {
+	g := generator{seen: map[reflect.Type]bool{}}
+	schema := g.schema(reflect.TypeOf(obj))
+	return &schema
+}
+
+// CustomResourceSchema returns the root schema of a custom resource. The
+// API server validates the metadata of the root object itself and does not
+// allow a schema for it.
+func CustomResourceSchema(obj interface{}) *extv1.JSONSchemaProps {
+	schema := SchemaOf(obj)
+	schema.Properties["metadata"] = extv1.JSONSchemaProps{Type: "object"}
+	return schema
+}
+
+type generator struct {
+	// seen holds the struct types on the current path, to stop on recursive types
+	seen map[reflect.Type]bool
+}
+
+func (g generator) schema(t reflect.Type) extv1.JSONSchemaProps {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case intOrStringType, quantityType:
+		return extv1.JSONSchemaProps{
+			XIntOrString: true,
+			AnyOf: []extv1.JSONSchemaProps{
+				{Type: "integer"},
+				{Type: "string"},
+			},
+		}
+	}
+
+	if v, ok := reflect.Zero(t).Interface().(openAPISchemaType); ok {
+		return extv1.JSONSchemaProps{
+			Type:   v.OpenAPISchemaType()[0],
+			Format: v.OpenAPISchemaFormat(),
+		}
+	}
+
+	// custom JSON, which we know nothing about, e.g. runtime.RawExtension
+	if t.Kind() == reflect.Struct && (t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType)) {
+		return preserveUnknownFields()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return extv1.JSONSchemaProps{Type: "boolean"}
+	case reflect.String:
+		return extv1.JSONSchemaProps{Type: "string"}
+	case reflect.Int32, reflect.Uint32, reflect.Int16, reflect.Uint16, reflect.Int8, reflect.Uint8:
+		return extv1.JSONSchemaProps{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return extv1.JSONSchemaProps{Type: "integer", Format: "int64"}
+	case reflect.Int, reflect.Uint:
+		return extv1.JSONSchemaProps{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return extv1.JSONSchemaProps{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return extv1.JSONSchemaProps{Type: "string", Format: "byte"}
+		}
+		items := g.schema(t.Elem())
+		return extv1.JSONSchemaProps{
+			Type:  "array",
+			Items: &extv1.JSONSchemaPropsOrArray{Schema: &items},
+		}
+	case reflect.Map:
+		values := g.schema(t.Elem())
+		return extv1.JSONSchemaProps{
+			Type:                 "object",
+			AdditionalProperties: &extv1.JSONSchemaPropsOrBool{Allows: true, Schema: &values},
+		}
+	case reflect.Struct:
+		if g.seen[t] {
+			return preserveUnknownFields()
+		}
+		g.seen[t] = true
+		defer delete(g.seen, t)
+
+		schema := extv1.JSONSchemaProps{
+			Type:       "object",
+			Properties: map[string]extv1.JSONSchemaProps{},
+		}
+		g.addProperties(&schema, t)
+		return schema
+	}
+
+	return preserveUnknownFields()
+}
+
+// addProperties adds the fields of struct t to schema, inlined structs are
+// flattened like encoding/json does
+func (g generator) addProperties(schema *extv1.JSONSchemaProps, t reflect.Type) {
+	docs := map[string]string{}
+	if v, ok := reflect.Zero(t).Interface().(swaggerDoc); ok {
+		docs = v.SwaggerDoc()
+	}
+	if schema.Description == "" {
+		schema.Description = docs[""]
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		name, inline := jsonName(field)
+		if name == "-" {
+			continue
+		}
+		if inline {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			g.addProperties(schema, ft)
+			continue
+		}
+
+		prop := g.schema(field.Type)
+		if doc, ok := docs[name]; ok {
+			prop.Description = doc
+		}
+		schema.Properties[name] = prop
+	}
+}
+
+// jsonName returns the name of a field in JSON and whether it is inlined
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		return field.Name, field.Anonymous || strings.Contains(tag, ",inline")
+	}
+	return name, false
+}
+
+func preserveUnknownFields() extv1.JSONSchemaProps {
+	return extv1.JSONSchemaProps{
+		Type:                   "object",
+		XPreserveUnknownFields: pointers.Bool(true),
+	}
+}
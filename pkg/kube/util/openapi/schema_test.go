@@ -0,0 +1,114 @@
+package openapi_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/openapi"
+)
+
+type testSpec struct {
+	Template appsv1.StatefulSet          `json:"template"`
+	Probes   map[string]corev1.Probe     `json:"probes,omitempty"`
+	Watch    *metav1.Duration            `json:"watch,omitempty"`
+	Labels   map[string]string           `json:"labels,omitempty"`
+	Skipped  string                      `json:"-"`
+	Nested   *testSpec                   `json:"nested,omitempty"`
+	Extra    map[string]metav1.Condition `json:"extra,omitempty"`
+}
+
+func (testSpec) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":         "the test spec",
+		"template": "the template",
+	}
+}
+
+type testResource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec testSpec `json:"spec"`
+}
+
+var _ = Describe("Schema", func() {
+	var schema *extv1.JSONSchemaProps
+
+	BeforeEach(func() {
+		schema = openapi.CustomResourceSchema(testResource{})
+	})
+
+	It("is a structural schema", func() {
+		internal := &apiextensions.JSONSchemaProps{}
+		Expect(extv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(schema, internal, nil)).To(Succeed())
+
+		structural, err := structuralschema.NewStructural(internal)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(structuralschema.ValidateStructural(field.NewPath("schema"), structural)).To(BeEmpty())
+	})
+
+	It("inlines the type meta and keeps the root metadata opaque", func() {
+		Expect(schema.Properties).To(HaveKey("apiVersion"))
+		Expect(schema.Properties).To(HaveKey("kind"))
+		Expect(schema.Properties["metadata"]).To(Equal(extv1.JSONSchemaProps{Type: "object"}))
+	})
+
+	It("uses the json names and skips ignored fields", func() {
+		spec := schema.Properties["spec"]
+		Expect(spec.Properties).To(HaveKey("template"))
+		Expect(spec.Properties).ToNot(HaveKey("Skipped"))
+		Expect(spec.Properties).ToNot(HaveKey("-"))
+	})
+
+	It("adds the descriptions of the types", func() {
+		spec := schema.Properties["spec"]
+		Expect(spec.Description).To(Equal("the test spec"))
+		Expect(spec.Properties["template"].Description).To(Equal("the template"))
+
+		replicas := spec.Properties["template"].Properties["spec"].Properties["replicas"]
+		Expect(replicas.Description).To(ContainSubstring("desired number of replicas"))
+	})
+
+	It("generates the embedded Kubernetes types", func() {
+		template := schema.Properties["spec"].Properties["template"]
+		Expect(template.XPreserveUnknownFields).To(BeNil())
+
+		replicas := template.Properties["spec"].Properties["replicas"]
+		Expect(replicas.Type).To(Equal("integer"))
+		Expect(replicas.Format).To(Equal("int32"))
+
+		containers := template.Properties["spec"].Properties["template"].Properties["spec"].Properties["containers"]
+		Expect(containers.Type).To(Equal("array"))
+		Expect(containers.Items.Schema.Properties["image"].Type).To(Equal("string"))
+
+		labels := template.Properties["metadata"].Properties["labels"]
+		Expect(labels.AdditionalProperties.Schema.Type).To(Equal("string"))
+	})
+
+	It("uses the OpenAPI types of types with a custom JSON representation", func() {
+		spec := schema.Properties["spec"]
+		Expect(spec.Properties["watch"].Type).To(Equal("string"))
+
+		lastTransitionTime := spec.Properties["extra"].AdditionalProperties.Schema.Properties["lastTransitionTime"]
+		Expect(lastTransitionTime.Type).To(Equal("string"))
+		Expect(lastTransitionTime.Format).To(Equal("date-time"))
+
+		port := spec.Properties["probes"].AdditionalProperties.Schema.Properties["httpGet"].Properties["port"]
+		Expect(port.XIntOrString).To(BeTrue())
+		Expect(port.Type).To(BeEmpty())
+	})
+
+	It("stops on recursive types", func() {
+		nested := schema.Properties["spec"].Properties["nested"]
+		Expect(nested.Type).To(Equal("object"))
+		Expect(*nested.XPreserveUnknownFields).To(BeTrue())
+	})
+})
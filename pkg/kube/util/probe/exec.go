@@ -0,0 +1,119 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	apispdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/kubernetes"
+	clientscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// Exec runs the command in the container and returns its output. The
+// output is kept in bounded buffers and added to the error, if the command
+// fails. Like the kubelet, the command fails if it doesn't finish within
+// the timeout. On timeout or cancellation the connection to the API server
+// is closed, which ends the stream instead of leaving it running in the
+// background.
+func Exec(ctx context.Context, kclient kubernetes.Interface, restConfig *rest.Config, pod *corev1.Pod, container string, command []string, timeout time.Duration) (string, error) {
+	req := kclient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     false,
+			Stdout:    true,
+			Stderr:    true,
+		}, clientscheme.ParameterCodec)
+
+	transport, upgrader, err := spdy.RoundTripperFor(restConfig)
+	if err != nil {
+		return "", errors.New("failed to initialize remote command executor")
+	}
+	if rt, ok := upgrader.(*apispdy.SpdyRoundTripper); ok {
+		rt.Dialer = &net.Dialer{Timeout: timeout}
+	}
+	conn := &closableUpgrader{Upgrader: upgrader}
+	defer conn.Close()
+
+	executor, err := remotecommand.NewSPDYExecutorForTransports(transport, conn, "POST", req.URL())
+	if err != nil {
+		return "", errors.New("failed to initialize remote command executor")
+	}
+
+	stdout := NewLimitedBuffer(MaxOutputSize)
+	stderr := NewLimitedBuffer(MaxOutputSize)
+	done := make(chan error, 1)
+	go func() {
+		done <- executor.Stream(remotecommand.StreamOptions{Stdout: stdout, Stderr: stderr, Tty: false})
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		err = errors.Errorf("command timed out after %s", timeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		return stdout.String(), errors.Wrapf(err, "failed executing command in pod: '%s/%s', container: %s, stdout: '%s', stderr: '%s'",
+			pod.Namespace,
+			pod.Name,
+			container,
+			stdout,
+			stderr,
+		)
+	}
+	return stdout.String(), nil
+}
+
+// closableUpgrader keeps the connection it upgraded, so Exec can close it
+// after the command timed out. A connection, which is upgraded after Close,
+// is closed right away.
+type closableUpgrader struct {
+	spdy.Upgrader
+
+	mu     sync.Mutex
+	conn   httpstream.Connection
+	closed bool
+}
+
+// NewConnection upgrades the response and keeps the connection.
+func (u *closableUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		conn.Close()
+		return nil, errors.New("connection closed before the command started")
+	}
+	u.conn = conn
+	return conn, nil
+}
+
+// Close closes the upgraded connection, which ends the stream.
+func (u *closableUpgrader) Close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closed = true
+	if u.conn != nil {
+		u.conn.Close()
+	}
+}
@@ -0,0 +1,80 @@
+package probe_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	remotecommandconsts "k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/probe"
+)
+
+var _ = Describe("Exec", func() {
+	var (
+		ctx        context.Context
+		pod        *corev1.Pod
+		server     *httptest.Server
+		restConfig *rest.Config
+		kclient    kubernetes.Interface
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo-0", Namespace: "default"}}
+
+		// The server starts the command, but it never finishes.
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := httpstream.Handshake(r, w, []string{remotecommandconsts.StreamProtocolV4Name}); err != nil {
+				return
+			}
+			conn := spdy.NewResponseUpgrader().UpgradeResponse(w, r, func(httpstream.Stream, <-chan struct{}) error {
+				return nil
+			})
+			if conn == nil {
+				return
+			}
+			<-conn.CloseChan()
+		}))
+
+		restConfig = &rest.Config{Host: server.URL}
+		var err error
+		kclient, err = kubernetes.NewForConfig(restConfig)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("fails after the timeout without leaving the stream running", func() {
+		goroutines := runtime.NumGoroutine()
+
+		_, err := probe.Exec(ctx, kclient, restConfig, pod, "main", []string{"sleep", "60"}, 100*time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("command timed out after 100ms")))
+
+		Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", goroutines))
+	})
+
+	It("fails on cancellation without leaving the stream running", func() {
+		goroutines := runtime.NumGoroutine()
+
+		ctx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(100*time.Millisecond, cancel)
+		_, err := probe.Exec(ctx, kclient, restConfig, pod, "main", []string{"sleep", "60"}, time.Minute)
+		Expect(err).To(MatchError(ContainSubstring("context canceled")))
+
+		Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", goroutines))
+	})
+})
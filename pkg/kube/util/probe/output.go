@@ -0,0 +1,51 @@
+package probe
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// MaxOutputSize limits how much of the output of an exec probe is kept
+const MaxOutputSize = 1024
+
+// LimitedBuffer keeps the first bytes written to it and discards the rest,
+// so the output of a probe doesn't grow the memory of the operator
+type LimitedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	size      int
+	truncated bool
+}
+
+// NewLimitedBuffer returns a buffer, which keeps up to size bytes
+func NewLimitedBuffer(size int) *LimitedBuffer {
+	return &LimitedBuffer{size: size}
+}
+
+// Write never fails, so the command writing the output isn't interrupted
+// once the buffer is full
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	if free := b.size - b.buf.Len(); len(p) > free {
+		p = p[:free]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+// String returns the trimmed output, followed by '...' if it was truncated
+func (b *LimitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := strings.TrimSpace(b.buf.String())
+	if b.truncated {
+		s += "..."
+	}
+	return s
+}
@@ -0,0 +1,29 @@
+package probe_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/probe"
+)
+
+var _ = Describe("LimitedBuffer", func() {
+	It("keeps the output", func() {
+		buf := probe.NewLimitedBuffer(16)
+		fmt.Fprintln(buf, "role: primary")
+		Expect(buf.String()).To(Equal("role: primary"))
+	})
+
+	It("truncates the output without failing", func() {
+		buf := probe.NewLimitedBuffer(8)
+		n, err := buf.Write([]byte("0123456"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(7))
+		n, err = buf.Write([]byte("789"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(buf.String()).To(Equal("01234567..."))
+	})
+})
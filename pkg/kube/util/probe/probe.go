@@ -0,0 +1,195 @@
+// Package probe runs the network handlers of probes against the IP of a pod,
+// the same way the kubelet runs them
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// maxBodySize limits how much of a response is read
+const maxBodySize = 10 * 1024
+
+// Timeout returns the timeout of the probe. Like the kubelet, it defaults
+// to one second.
+func Timeout(probe corev1.Probe) time.Duration {
+	if probe.TimeoutSeconds <= 0 {
+		return time.Second
+	}
+	return time.Duration(probe.TimeoutSeconds) * time.Second
+}
+
+// HTTPGet succeeds if the GET request to the container returns a status
+// code between 200 and 399
+func HTTPGet(ctx context.Context, pod *corev1.Pod, container string, action *corev1.HTTPGetAction, timeout time.Duration) error {
+	resp, err := HTTPGetResponse(ctx, pod, container, action, timeout)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return errors.Errorf("GET '%s' returned status %d: %s", resp.URL, resp.StatusCode, resp.Body)
+	}
+	return nil
+}
+
+// Response is the status code and the beginning of the body of a response
+type Response struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+// HTTPGetResponse sends the GET request of the action to the container and
+// returns the response, regardless of its status code
+func HTTPGetResponse(ctx context.Context, pod *corev1.Pod, container string, action *corev1.HTTPGetAction, timeout time.Duration) (*Response, error) {
+	host, port, err := address(pod, container, action.Host, action.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := strings.ToLower(string(action.Scheme))
+	if scheme == "" {
+		scheme = "http"
+	}
+	path := action.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid path '%s'", action.Path)
+	}
+	u.Scheme = scheme
+	u.Host = net.JoinHostPort(host, strconv.Itoa(port))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create request for '%s'", u)
+	}
+	for _, header := range action.HTTPHeaders {
+		if strings.EqualFold(header.Name, "host") {
+			req.Host = header.Value
+			continue
+		}
+		req.Header.Add(header.Name, header.Value)
+	}
+
+	transport := &http.Transport{
+		// Like the kubelet, the certificate of the container is not verified
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GET '%s' failed", u)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	return &Response{URL: u.String(), StatusCode: resp.StatusCode, Body: string(body)}, nil
+}
+
+// TCPSocket succeeds if a TCP connection to the container can be opened
+func TCPSocket(ctx context.Context, pod *corev1.Pod, container string, action *corev1.TCPSocketAction, timeout time.Duration) error {
+	host, port, err := address(pod, container, action.Host, action.Port)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "could not connect to '%s'", addr)
+	}
+	return conn.Close()
+}
+
+// GRPC succeeds if the standard gRPC health service of the container
+// reports the service as SERVING. The connection uses plain text.
+func GRPC(ctx context.Context, pod *corev1.Pod, port int32, service string, timeout time.Duration) error {
+	host, p, err := address(pod, "", "", intstr.FromInt(int(port)))
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(p))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return errors.Wrapf(err, "could not connect to '%s'", addr)
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return errors.Wrapf(err, "gRPC health check of '%s' failed", addr)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return errors.Errorf("gRPC service '%s' at '%s' is not serving, status %s", service, addr, resp.Status)
+	}
+	return nil
+}
+
+// address returns the host and port number to probe. The host defaults to
+// the IP of the pod, named ports are looked up in the container.
+func address(pod *corev1.Pod, container string, host string, port intstr.IntOrString) (string, int, error) {
+	if host == "" {
+		host = pod.Status.PodIP
+	}
+	if host == "" {
+		return "", 0, errors.Errorf("pod '%s/%s' has no IP", pod.Namespace, pod.Name)
+	}
+
+	number, err := portNumber(pod, container, port)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, number, nil
+}
+
+func portNumber(pod *corev1.Pod, container string, port intstr.IntOrString) (int, error) {
+	number := -1
+	if port.Type == intstr.Int {
+		number = port.IntValue()
+	} else {
+		for _, c := range pod.Spec.Containers {
+			if c.Name != container {
+				continue
+			}
+			for _, p := range c.Ports {
+				if p.Name == port.StrVal {
+					number = int(p.ContainerPort)
+				}
+			}
+		}
+		if number == -1 {
+			if n, err := strconv.Atoi(port.StrVal); err == nil {
+				number = n
+			}
+		}
+	}
+
+	if number <= 0 || number > 65535 {
+		return 0, errors.Errorf("invalid port '%s' for container '%s' of pod '%s/%s'", port.String(), container, pod.Namespace, pod.Name)
+	}
+	return number, nil
+}
@@ -0,0 +1,192 @@
+package probe_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"google.golang.org/grpc"
+	healthserver "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"code.cloudfoundry.org/quarks-statefulset/pkg/kube/util/probe"
+)
+
+var _ = Describe("Probe", func() {
+	var (
+		ctx     context.Context
+		pod     *corev1.Pod
+		server  *httptest.Server
+		port    int
+		handler http.HandlerFunc
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		handler = func(w http.ResponseWriter, r *http.Request) {}
+	})
+
+	JustBeforeEach(func() {
+		server = httptest.NewServer(handler)
+		_, p, err := net.SplitHostPort(server.Listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		port, err = strconv.Atoi(p)
+		Expect(err).ToNot(HaveOccurred())
+
+		pod = &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "db", Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: int32(port)}}},
+				},
+			},
+			Status: corev1.PodStatus{PodIP: "127.0.0.1"},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Timeout", func() {
+		It("defaults to one second", func() {
+			Expect(probe.Timeout(corev1.Probe{})).To(Equal(time.Second))
+			Expect(probe.Timeout(corev1.Probe{TimeoutSeconds: 3})).To(Equal(3 * time.Second))
+		})
+	})
+
+	Describe("HTTPGet", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/healthz" || r.Header.Get("X-Role") != "primary" {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}
+		})
+
+		It("succeeds for a successful status code", func() {
+			action := &corev1.HTTPGetAction{
+				Path:        "/healthz",
+				Port:        intstr.FromString("http"),
+				HTTPHeaders: []corev1.HTTPHeader{{Name: "X-Role", Value: "primary"}},
+			}
+			Expect(probe.HTTPGet(ctx, pod, "db", action, time.Second)).To(Succeed())
+		})
+
+		It("fails for an error status code", func() {
+			action := &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(port)}
+			err := probe.HTTPGet(ctx, pod, "db", action, time.Second)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("returned status 503"))
+		})
+
+		It("fails for an unknown named port", func() {
+			action := &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromString("grpc")}
+			err := probe.HTTPGet(ctx, pod, "db", action, time.Second)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid port 'grpc'"))
+		})
+
+		Context("when the container does not respond in time", func() {
+			BeforeEach(func() {
+				handler = func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(200 * time.Millisecond)
+				}
+			})
+
+			It("fails after the timeout", func() {
+				action := &corev1.HTTPGetAction{Path: "/", Port: intstr.FromInt(port)}
+				Expect(probe.HTTPGet(ctx, pod, "db", action, 50*time.Millisecond)).ToNot(Succeed())
+			})
+		})
+
+		It("fails if the pod has no IP", func() {
+			pod.Status.PodIP = ""
+			action := &corev1.HTTPGetAction{Path: "/", Port: intstr.FromInt(port)}
+			err := probe.HTTPGet(ctx, pod, "db", action, time.Second)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("has no IP"))
+		})
+	})
+
+	Describe("TCPSocket", func() {
+		It("succeeds if the port is open", func() {
+			action := &corev1.TCPSocketAction{Port: intstr.FromString("http")}
+			Expect(probe.TCPSocket(ctx, pod, "db", action, time.Second)).To(Succeed())
+		})
+
+		It("fails if the port is closed", func() {
+			server.Close()
+			action := &corev1.TCPSocketAction{Port: intstr.FromInt(port)}
+			Expect(probe.TCPSocket(ctx, pod, "db", action, time.Second)).ToNot(Succeed())
+		})
+	})
+
+	Describe("GRPC", func() {
+		var (
+			grpcServer *grpc.Server
+			health     *healthserver.Server
+			grpcPort   int32
+		)
+
+		BeforeEach(func() {
+			grpcServer = grpc.NewServer()
+			health = healthserver.NewServer()
+			health.SetServingStatus("db", healthpb.HealthCheckResponse_SERVING)
+			healthpb.RegisterHealthServer(grpcServer, health)
+		})
+
+		JustBeforeEach(func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			grpcPort = int32(listener.Addr().(*net.TCPAddr).Port)
+			go func() { _ = grpcServer.Serve(listener) }()
+		})
+
+		AfterEach(func() {
+			grpcServer.Stop()
+		})
+
+		It("succeeds if the service is serving", func() {
+			Expect(probe.GRPC(ctx, pod, grpcPort, "db", time.Second)).To(Succeed())
+		})
+
+		Context("when the service is not serving", func() {
+			BeforeEach(func() {
+				health.SetServingStatus("db", healthpb.HealthCheckResponse_NOT_SERVING)
+			})
+
+			It("fails", func() {
+				err := probe.GRPC(ctx, pod, grpcPort, "db", time.Second)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("is not serving, status NOT_SERVING"))
+			})
+		})
+
+		Context("when the health service is not implemented", func() {
+			BeforeEach(func() {
+				grpcServer = grpc.NewServer()
+			})
+
+			It("fails with the gRPC status", func() {
+				err := probe.GRPC(ctx, pod, grpcPort, "", time.Second)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("code = Unimplemented"))
+			})
+		})
+
+		It("fails after the timeout if the port is closed", func() {
+			grpcServer.Stop()
+			err := probe.GRPC(ctx, pod, grpcPort, "db", 100*time.Millisecond)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("could not connect to"))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package probe_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestProbe(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Probe Suite")
+}